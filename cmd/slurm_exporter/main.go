@@ -16,47 +16,123 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>. */
 package main
 
 import (
+	"fmt"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/alecthomas/kingpin/v2"
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/collectors"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/common/version"
 	"github.com/prometheus/exporter-toolkit/web"
 	webflag "github.com/prometheus/exporter-toolkit/web/kingpinflag"
 
 	"github.com/sckyzo/slurm_exporter/internal/collector"
 	"github.com/sckyzo/slurm_exporter/internal/logger"
+	"github.com/sckyzo/slurm_exporter/internal/slurmrest"
 )
 
 var (
 	// Command-line flags for application configuration
-	commandTimeout = kingpin.Flag("command.timeout", "Timeout for executing Slurm commands.").Default("5s").Duration()
-	logLevel       = kingpin.Flag("log.level", "Only log messages with the given severity or above. One of: [debug, info, warn, error]").Default("info").Enum("debug", "info", "warn", "error")
-	logFormat      = kingpin.Flag("log.format", "Log format. One of: [json, text]").Default("text").Enum("json", "text")
-	toolkitFlags   = webflag.AddFlags(kingpin.CommandLine, ":9341")
+	configFile         = kingpin.Flag("config.file", "YAML configuration file, reloaded on SIGHUP or POST /-/reload.").Default("").String()
+	commandTimeout     = kingpin.Flag("command.timeout", "Timeout for executing Slurm commands.").Default("5s").Duration()
+	commandRetries     = kingpin.Flag("command.retries", "How often a failed or timed out Slurm command is retried.").Default("0").Int()
+	commandBackoff     = kingpin.Flag("command.retry-backoff", "Wait before the first retry of a Slurm command, doubled for each next retry.").Default("1s").Duration()
+	logLevel           = kingpin.Flag("log.level", "Only log messages with the given severity or above. One of: [debug, info, warn, error]").Default("info").Enum("debug", "info", "warn", "error")
+	logFormat          = kingpin.Flag("log.format", "Log format. One of: [json, text]").Default("text").Enum("json", "text")
+	slurmClusters      = kingpin.Flag("slurm.clusters", "Comma-separated clusters of the slurmdbd to query with -M, each labeled with cluster. Empty to query the default cluster without label.").Default("").String()
+	slurmBackend       = kingpin.Flag("slurm.backend", "Backend used to query Slurm. One of: [cli, rest]").Default("cli").Enum("cli", "rest")
+	restURL            = kingpin.Flag("slurm.rest.url", "Base URL of slurmrestd, used with --slurm.backend=rest.").Default("http://localhost:6820").String()
+	restAPIVersion     = kingpin.Flag("slurm.rest.api-version", "slurmrestd OpenAPI version to query.").Default(slurmrest.DefaultAPIVersion).String()
+	restUser           = kingpin.Flag("slurm.rest.user", "User name sent to slurmrestd in the X-SLURM-USER-NAME header.").Default("").String()
+	restTokenFile      = kingpin.Flag("slurm.rest.token-file", "File containing the slurmrestd JWT. Defaults to the SLURM_JWT environment variable.").Default("").String()
+	scrapeMode         = kingpin.Flag("scrape.mode", "How metrics are collected. One of: [sync, background]. In background mode collectors refresh on their own interval and /metrics serves the last successful refresh.").Default("sync").Enum("sync", "background")
+	scrapeInterval     = kingpin.Flag("scrape.interval", "Default refresh interval of the collectors in background mode.").Default("30s").Duration()
+	collectorIntervals = kingpin.Flag("scrape.collector-interval", "Refresh interval of a single collector in background mode, as <collector>=<duration>. Can be repeated.").StringMap()
+	sacctLookback      = kingpin.Flag("collector.sacct.lookback", "How far back the sacct collector reads finished jobs when it has no high-water mark, or after a long downtime.").Default("1h").Duration()
+	sacctStateFile     = kingpin.Flag("collector.sacct.state-file", "File persisting the sacct high-water mark across restarts. Empty to keep it in memory only.").Default("").String()
+	efficiencyLookback = kingpin.Flag("collector.efficiency.lookback", "How far back the efficiency collector reads finished jobs.").Default("1h").Duration()
+	efficiencyPerJob   = kingpin.Flag("collector.efficiency.per-job", "Also export the CPU and memory efficiency of every job.").Default("false").Bool()
+	gpusPerNode        = kingpin.Flag("collector.gpus.per-node", "Also export the total and used GPUs of every node by GPU type.").Default("false").Bool()
+	gpusPerPartition   = kingpin.Flag("collector.gpus.per-partition", "Also export the GPU metrics of every partition by GPU type.").Default("false").Bool()
+	queueLabelFlags    = kingpin.Flag("collector.queue.labels", "Label dimensions of a queue metric family, as <family>=<dimension>,... with dimensions among user, account, partition, qos, reason and state. The family all sets every other family. Can be repeated.").StringMap()
+	sprioPerJob        = kingpin.Flag("collector.sprio.per-job", "Also export the priority components of every pending job.").Default("false").Bool()
+	toolkitFlags       = webflag.AddFlags(kingpin.CommandLine, ":9341")
 
 	// collectorState stores the enabled/disabled state of each collector
 	collectorState = make(map[string]*bool)
 )
 
+// collectorConstructor creates a collector querying cluster, empty for the
+// default one. labels are the label dimensions of the queue collector, from
+// --collector.queue.labels or the configuration file.
+type collectorConstructor func(l *logger.Logger, cluster string, labels map[string][]string) collector.Collector
+
+// loggerOnly adapts the constructor of a collector that only needs a logger.
+func loggerOnly[C collector.Collector](newCollector func(*logger.Logger) C) collectorConstructor {
+	return func(l *logger.Logger, cluster string, labels map[string][]string) collector.Collector {
+		return newCollector(l)
+	}
+}
+
 // collectorConstructors maps collector names to their constructor functions
-var collectorConstructors = map[string]func(logger *logger.Logger) prometheus.Collector{
-	"accounts":     func(l *logger.Logger) prometheus.Collector { return collector.NewAccountsCollector(l) },
-	"cpus":         func(l *logger.Logger) prometheus.Collector { return collector.NewCPUsCollector(l) },
-	"nodes":        func(l *logger.Logger) prometheus.Collector { return collector.NewNodesCollector(l) },
-	"node":         func(l *logger.Logger) prometheus.Collector { return collector.NewNodeCollector(l) },
-	"job":          func(l *logger.Logger) prometheus.Collector { return collector.NewJobCollector(l) },
-	"partitions":   func(l *logger.Logger) prometheus.Collector { return collector.NewPartitionsCollector(l) },
-	"queue":        func(l *logger.Logger) prometheus.Collector { return collector.NewQueueCollector(l) },
-	"scheduler":    func(l *logger.Logger) prometheus.Collector { return collector.NewSchedulerCollector(l) },
-	"fairshare":    func(l *logger.Logger) prometheus.Collector { return collector.NewFairShareCollector(l) },
-	"users":        func(l *logger.Logger) prometheus.Collector { return collector.NewUsersCollector(l) },
-	"info":         func(l *logger.Logger) prometheus.Collector { return collector.NewSlurmInfoCollector(l) },
-	"gpus":         func(l *logger.Logger) prometheus.Collector { return collector.NewGPUsCollector(l) },
-	"reservations": func(l *logger.Logger) prometheus.Collector { return collector.NewReservationsCollector(l) },
+var collectorConstructors = map[string]collectorConstructor{
+	"accounts": loggerOnly(collector.NewAccountsCollector),
+	"controller": func(l *logger.Logger, cluster string, labels map[string][]string) collector.Collector {
+		// slurmrestd does not print the configuration, and slurmdbd is
+		// checked once, by the first cluster.
+		return collector.NewControllerCollector(l, *slurmBackend != "rest", cluster == clusters()[0])
+	},
+	"cpus": loggerOnly(collector.NewCPUsCollector),
+	"efficiency": func(l *logger.Logger, cluster string, labels map[string][]string) collector.Collector {
+		return collector.NewEfficiencyCollector(l, *efficiencyLookback, *efficiencyPerJob)
+	},
+	"nodes":        loggerOnly(collector.NewNodesCollector),
+	"node":         loggerOnly(collector.NewNodeCollector),
+	"node_details": loggerOnly(collector.NewNodeDetailsCollector),
+	"job":          loggerOnly(collector.NewJobCollector),
+	"partitions":   loggerOnly(collector.NewPartitionsCollector),
+	"pending":      loggerOnly(collector.NewPendingCollector),
+	"queue": func(l *logger.Logger, cluster string, labels map[string][]string) collector.Collector {
+		return collector.NewQueueCollector(l, labels)
+	},
+	"scheduler": loggerOnly(collector.NewSchedulerCollector),
+	"fairshare": loggerOnly(collector.NewFairShareCollector),
+	"users":     loggerOnly(collector.NewUsersCollector),
+	"info":      loggerOnly(collector.NewSlurmInfoCollector),
+	"licenses":  loggerOnly(collector.NewLicensesCollector),
+	"limits":    loggerOnly(collector.NewLimitsCollector),
+	"gpus": func(l *logger.Logger, cluster string, labels map[string][]string) collector.Collector {
+		return collector.NewGPUsCollector(l, *gpusPerNode, *gpusPerPartition)
+	},
+	"reservations": loggerOnly(collector.NewReservationsCollector),
+	"sacct": func(l *logger.Logger, cluster string, labels map[string][]string) collector.Collector {
+		return collector.NewSacctCollector(l, *sacctLookback, clusterStateFile(*sacctStateFile, cluster))
+	},
+	"sprio": func(l *logger.Logger, cluster string, labels map[string][]string) collector.Collector {
+		return collector.NewSprioCollector(l, *sprioPerJob)
+	},
+}
+
+// defaultDisabled lists the collectors that must be enabled explicitly,
+// because they query slurmdbd, need a priority plugin other than basic or
+// export many series per node.
+var defaultDisabled = map[string]bool{
+	"efficiency":   true,
+	"limits":       true,
+	"node_details": true,
+	"sacct":        true,
+	"sprio":        true,
+}
+
+// statefulCollectors lists the collectors that keep state across scrapes:
+// the sacct high-water mark, the sdiag counter bases and the node state and
+// resume history. They are kept across reloads.
+var statefulCollectors = map[string]bool{
+	"node":      true,
+	"sacct":     true,
+	"scheduler": true,
 }
 
 // indexHTML is the HTML content displayed on the root page
@@ -68,22 +144,40 @@ const indexHTML = `<html>
 	</body>
 </html>`
 
-// registerCollectors registers enabled collectors with Prometheus
-func registerCollectors(logger *logger.Logger) {
-	for name, constructor := range collectorConstructors {
-		if *collectorState[name] {
-			prometheus.MustRegister(constructor(logger))
-			logger.Info("Collector enabled", "collector", name)
-		} else {
-			logger.Info("Collector disabled", "collector", name)
+// clusterStateFile returns the state file of a cluster, inserting its name
+// before the extension of path, e.g. sacct.json becomes sacct.alpha.json.
+func clusterStateFile(path, cluster string) string {
+	if path == "" || cluster == "" {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + cluster + ext
+}
+
+// parseCollectorIntervals parses the values of --scrape.collector-interval.
+func parseCollectorIntervals(values map[string]string) (map[string]time.Duration, error) {
+	intervals := make(map[string]time.Duration, len(values))
+	for name, value := range values {
+		if _, ok := collectorConstructors[name]; !ok {
+			return nil, fmt.Errorf("unknown collector %q in --scrape.collector-interval", name)
+		}
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid interval %q for collector %q", value, name)
 		}
+		intervals[name] = interval
 	}
+	return intervals, nil
 }
 
 func main() {
 	// Dynamically create command-line flags for each collector
 	for name := range collectorConstructors {
-		collectorState[name] = kingpin.Flag("collector."+name, "Enable the "+name+" collector.").Default("true").Bool()
+		enabled := "true"
+		if defaultDisabled[name] {
+			enabled = "false"
+		}
+		collectorState[name] = kingpin.Flag("collector."+name, "Enable the "+name+" collector.").Default(enabled).Bool()
 	}
 
 	// Configure kingpin command-line parser
@@ -99,14 +193,38 @@ func main() {
 		log = logger.NewTextLogger(*logLevel)
 	}
 
-	// Configure global command timeout for all collectors
+	// Configure the default command timeout and retries for all collectors
 	collector.SetCommandTimeout(*commandTimeout)
+	collector.SetCommandRetries(*commandRetries, *commandBackoff)
 
-	// Register Prometheus build info collector
-	prometheus.MustRegister(collectors.NewBuildInfoCollector())
+	// Serve command output from slurmrestd instead of the local Slurm binaries
+	if *slurmBackend == "rest" {
+		if *slurmClusters != "" {
+			log.Error("--slurm.clusters is not supported by the slurmrestd backend")
+			os.Exit(1)
+		}
+		client, err := slurmrest.NewClient(slurmrest.Config{
+			URL:        *restURL,
+			APIVersion: *restAPIVersion,
+			User:       *restUser,
+			TokenFile:  *restTokenFile,
+			Token:      os.Getenv("SLURM_JWT"),
+		})
+		if err != nil {
+			log.Error("Failed to configure slurmrestd backend", "err", err)
+			os.Exit(1)
+		}
+		collector.SetRunner(client.Run)
+		log.Info("Using slurmrestd backend", "url", *restURL, "api_version", *restAPIVersion)
+	}
 
 	// Register enabled Slurm collectors
-	registerCollectors(log)
+	exp := newExporter(log)
+	if err := exp.reload(); err != nil {
+		log.Error("Failed to register collectors", "err", err)
+		os.Exit(1)
+	}
+	go exp.reloadOnSIGHUP()
 
 	// Log server startup information
 	log.Info("Starting Slurm Exporter server...")
@@ -117,7 +235,8 @@ func main() {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte(indexHTML))
 	})
-	http.Handle("/metrics", promhttp.Handler())
+	http.Handle("/metrics", exp)
+	http.HandleFunc("/-/reload", exp.handleReload)
 
 	// Start HTTP server with exporter toolkit (supports TLS, Basic Auth, etc.)
 	server := &http.Server{}
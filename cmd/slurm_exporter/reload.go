@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/sckyzo/slurm_exporter/internal/collector"
+	"github.com/sckyzo/slurm_exporter/internal/config"
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// exporter serves the metrics of the enabled collectors. On reload it builds
+// them again from the flags and the configuration file, registers them in a
+// fresh registry and swaps the /metrics handler, so that scrapes in flight
+// finish on the previous registry. The collectors that keep state across
+// scrapes are built once and only wrapped again.
+type exporter struct {
+	logger *logger.Logger
+	// handlerMetrics holds the promhttp_metric_handler_* metrics, shared by
+	// filtered and unfiltered scrapes.
+	handlerMetrics *prometheus.Registry
+
+	mu        sync.Mutex // serializes reloads
+	cancel    context.CancelFunc
+	state     atomic.Pointer[exporterState]
+	instances map[string]map[string]collector.Collector // stateful collectors by cluster and name
+}
+
+// filterCollector is implemented by SlurmCollector and BackgroundCollector.
+type filterCollector interface {
+	prometheus.Collector
+	Filter(names []string) prometheus.Collector
+}
+
+// exporterState is the result of a reload.
+type exporterState struct {
+	handler http.Handler
+	// slurm holds the Slurm collector of every cluster, by cluster name. The
+	// default cluster has an empty name and its series no cluster label.
+	slurm      map[string]filterCollector
+	collectors map[string]collector.Collector
+}
+
+// register registers the Slurm collectors of every cluster in reg, with the
+// execution counters. filter selects some collectors when not empty.
+func (s *exporterState) register(reg prometheus.Registerer, filter []string) error {
+	if err := reg.Register(collector.CommandExecutions()); err != nil {
+		return err
+	}
+	for cluster, c := range s.slurm {
+		var pc prometheus.Collector = c
+		if len(filter) > 0 {
+			pc = c.Filter(filter)
+		}
+		r := reg
+		if cluster != "" {
+			r = prometheus.WrapRegistererWith(prometheus.Labels{"cluster": cluster}, reg)
+		}
+		if err := r.Register(pc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newExporter(logger *logger.Logger) *exporter {
+	return &exporter{
+		logger:         logger,
+		handlerMetrics: prometheus.NewRegistry(),
+		instances:      make(map[string]map[string]collector.Collector),
+	}
+}
+
+// ServeHTTP serves the metrics of every enabled collector or, like
+// node_exporter, only those of the collectors selected with collect[]
+// query parameters, e.g. /metrics?collect[]=nodes&collect[]=gpus.
+func (e *exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	state := e.state.Load()
+	names := r.URL.Query()["collect[]"]
+	if len(names) == 0 {
+		state.handler.ServeHTTP(w, r)
+		return
+	}
+
+	for _, name := range names {
+		if _, ok := state.collectors[name]; !ok {
+			http.Error(w, fmt.Sprintf("collector %q is unknown or disabled", name), http.StatusBadRequest)
+			return
+		}
+	}
+	reg := prometheus.NewRegistry()
+	if err := state.register(reg, names); err != nil {
+		http.Error(w, fmt.Sprintf("failed to register collectors: %s", err), http.StatusInternalServerError)
+		return
+	}
+	e.instrument(reg).ServeHTTP(w, r)
+}
+
+// instrument returns the handler serving the metrics of reg along with the
+// promhttp_metric_handler_* metrics counting its requests.
+func (e *exporter) instrument(reg prometheus.Gatherer) http.Handler {
+	gatherers := prometheus.Gatherers{reg, e.handlerMetrics}
+	return promhttp.InstrumentMetricHandler(e.handlerMetrics, promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{}))
+}
+
+// reload loads the configuration file and swaps in the new collectors. The
+// previous collectors, and the stateful instances, are kept when the
+// configuration is invalid.
+func (e *exporter) reload() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	cfg := &config.Config{}
+	if *configFile != "" {
+		var err error
+		if cfg, err = config.Load(*configFile); err != nil {
+			return err
+		}
+	}
+	state := &exporterState{slurm: make(map[string]filterCollector)}
+	// The stateful instances are swapped in with the state, so that a
+	// failed reload leaves none half-built for the next one.
+	instances := make(map[string]map[string]collector.Collector)
+	var background []*collector.BackgroundCollector
+	for _, cluster := range clusters() {
+		clusterLogger := e.logger
+		if cluster != "" {
+			clusterLogger = e.logger.With("cluster", cluster)
+		}
+		instances[cluster] = maps.Clone(e.instances[cluster])
+		if instances[cluster] == nil {
+			instances[cluster] = make(map[string]collector.Collector)
+		}
+		enabled, intervals, err := buildCollectors(clusterLogger, cfg, cluster, instances[cluster])
+		if err != nil {
+			return err
+		}
+		state.collectors = enabled
+		if *scrapeMode == "sync" {
+			state.slurm[cluster] = collector.NewSlurmCollector(clusterLogger, cluster, enabled)
+		} else {
+			bc := collector.NewBackgroundCollector(clusterLogger, cluster, enabled, *scrapeInterval, intervals)
+			state.slurm[cluster] = bc
+			background = append(background, bc)
+		}
+	}
+
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(collectors.NewBuildInfoCollector()); err != nil {
+		return err
+	}
+	if err := reg.Register(collectors.NewGoCollector()); err != nil {
+		return err
+	}
+	if err := reg.Register(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{})); err != nil {
+		return err
+	}
+
+	if err := state.register(reg, nil); err != nil {
+		return err
+	}
+
+	collector.SetCommandPaths(cfg.Commands)
+	collector.SetCommandPolicies(commandPolicies(cfg))
+	ctx, cancel := context.WithCancel(context.Background())
+	for _, bc := range background {
+		// Unlike at startup, the previous collectors are serving: keep them
+		// until the new ones have metrics.
+		if e.state.Load() != nil {
+			bc.Prime()
+		}
+		bc.Start(ctx)
+	}
+	if len(background) > 0 {
+		e.logger.Info("Collecting metrics in the background", "interval", *scrapeInterval)
+	}
+
+	state.handler = e.instrument(reg)
+	e.state.Store(state)
+	e.instances = instances
+	if e.cancel != nil {
+		e.cancel()
+	}
+	e.cancel = cancel
+	return nil
+}
+
+// reloadOnSIGHUP reloads the configuration whenever the process receives SIGHUP.
+func (e *exporter) reloadOnSIGHUP() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		if err := e.reload(); err != nil {
+			e.logger.Error("Failed to reload configuration", "err", err)
+			continue
+		}
+		e.logger.Info("Configuration reloaded", "file", *configFile)
+	}
+}
+
+// handleReload reloads the configuration on POST /-/reload.
+func (e *exporter) handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Only POST requests allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := e.reload(); err != nil {
+		e.logger.Error("Failed to reload configuration", "err", err)
+		http.Error(w, fmt.Sprintf("failed to reload configuration: %s", err), http.StatusInternalServerError)
+		return
+	}
+	e.logger.Info("Configuration reloaded", "file", *configFile)
+}
+
+// commandPolicies completes the command policies of the configuration file
+// with the defaults of the command-line flags.
+func commandPolicies(cfg *config.Config) map[string]collector.CommandPolicy {
+	policies := make(map[string]collector.CommandPolicy, len(cfg.CommandPolicies))
+	for command, p := range cfg.CommandPolicies {
+		policy := collector.CommandPolicy{Timeout: *commandTimeout, Retries: *commandRetries, Backoff: *commandBackoff}
+		if p.Timeout > 0 {
+			policy.Timeout = p.Timeout
+		}
+		if p.Retries != nil {
+			policy.Retries = *p.Retries
+		}
+		if p.RetryBackoff > 0 {
+			policy.Backoff = p.RetryBackoff
+		}
+		policies[command] = policy
+	}
+	return policies
+}
+
+// clusters returns the clusters given with --slurm.clusters, or only the
+// default cluster, with an empty name.
+func clusters() []string {
+	var names []string
+	for _, name := range strings.Split(*slurmClusters, ",") {
+		if name = strings.TrimSpace(name); name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return []string{""}
+	}
+	return names
+}
+
+// buildCollectors creates the enabled collectors of a cluster, wrapped with
+// the timeout and label filters of the configuration file, and returns them
+// with their refresh intervals in background mode. The stateful collectors
+// are taken from instances when they exist there, and stored in it when
+// created, so that their state survives reloads.
+func buildCollectors(logger *logger.Logger, cfg *config.Config, cluster string, instances map[string]collector.Collector) (map[string]collector.Collector, map[string]time.Duration, error) {
+	for name, cc := range cfg.Collectors {
+		if _, ok := collectorConstructors[name]; !ok {
+			return nil, nil, fmt.Errorf("unknown collector %q in %s", name, *configFile)
+		}
+		if cc.Labels != nil && name != "queue" {
+			return nil, nil, fmt.Errorf("collector %q: labels are only supported by the queue collector", name)
+		}
+	}
+
+	intervals, err := parseCollectorIntervals(*collectorIntervals)
+	if err != nil {
+		return nil, nil, err
+	}
+	labels := *queueLabelFlags
+	if cc, ok := cfg.Collectors["queue"]; ok && cc.Labels != nil {
+		labels = cc.Labels
+	}
+	queueLabels, err := collector.ParseQueueLabels(labels)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	enabled := make(map[string]collector.Collector)
+	for name, constructor := range collectorConstructors {
+		cc := cfg.Collectors[name]
+		on := *collectorState[name]
+		if cc.Enabled != nil {
+			on = *cc.Enabled
+		}
+		if !on {
+			delete(instances, name)
+			logger.Info("Collector disabled", "collector", name)
+			continue
+		}
+
+		c, ok := instances[name]
+		if !ok {
+			c = constructor(logger, cluster, queueLabels)
+			if statefulCollectors[name] {
+				instances[name] = c
+			}
+		}
+		// The filters were validated by config.Load.
+		include, _ := config.CompileFilters(cc.IncludeLabels)
+		exclude, _ := config.CompileFilters(cc.ExcludeLabels)
+		c = collector.WithLabelFilters(c, include, exclude)
+		enabled[name] = collector.WithTimeout(c, cc.Timeout)
+		if cc.Interval > 0 {
+			intervals[name] = cc.Interval
+		}
+		logger.Info("Collector enabled", "collector", name)
+	}
+	return enabled, intervals, nil
+}
@@ -2,78 +2,84 @@ package collector
 
 import (
 	"regexp"
-	"strconv"
 	"strings"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sckyzo/slurm_exporter/internal/logger"
 )
 
-/*
-AccountsData executes the squeue command to retrieve job information by account.
-Expected squeue output format: "%A|%a|%T|%C" (Job ID|Account|State|CPUs).
-*/
-func AccountsData(logger *logger.Logger) ([]byte, error) {
-	return Execute(logger, "squeue", []string{"-a", "-r", "-h", "-o", "%A|%a|%T|%C"})
-}
-
 type AccountJobMetrics struct {
-	pending      float64
-	running      float64
-	running_cpus float64
-	suspended    float64
+	pending       float64
+	running       float64
+	running_cpus  float64
+	suspended     float64
+	running_mem   float64
+	running_nodes float64
+	running_gpus  map[string]float64
+	pending_gpus  map[string]float64
 }
 
 /*
-ParseAccountsMetrics parses the output of the squeue command for account-specific job metrics.
-It expects input in the format: "JobID|Account|State|CPUs".
+ParseAccountsMetrics aggregates the jobs of the squeue snapshot by account.
 */
-func ParseAccountsMetrics(input []byte) map[string]*AccountJobMetrics {
+func ParseAccountsMetrics(jobs []Job) map[string]*AccountJobMetrics {
 	accounts := make(map[string]*AccountJobMetrics)
-	lines := strings.Split(string(input), "\n")
-	for _, line := range lines {
-		if strings.Contains(line, "|") {
-			account := strings.Split(line, "|")[1]
-			_, key := accounts[account]
-			if !key {
-				accounts[account] = &AccountJobMetrics{0, 0, 0, 0}
+	for _, job := range jobs {
+		account := job.Account
+		_, key := accounts[account]
+		if !key {
+			accounts[account] = &AccountJobMetrics{running_gpus: make(map[string]float64), pending_gpus: make(map[string]float64)}
+		}
+		state := strings.ToLower(job.State)
+		pending := regexp.MustCompile(`^pending`)
+		running := regexp.MustCompile(`^running`)
+		suspended := regexp.MustCompile(`^suspended`)
+		switch {
+		case pending.MatchString(state):
+			accounts[account].pending++
+			for gpuType, gpus := range jobGPUTypes(job) {
+				accounts[account].pending_gpus[gpuType] += gpus
 			}
-			state := strings.Split(line, "|")[2]
-			state = strings.ToLower(state)
-			cpus, _ := strconv.ParseFloat(strings.Split(line, "|")[3], 64)
-			pending := regexp.MustCompile(`^pending`)
-			running := regexp.MustCompile(`^running`)
-			suspended := regexp.MustCompile(`^suspended`)
-			switch {
-			case pending.MatchString(state):
-				accounts[account].pending++
-			case running.MatchString(state):
-				accounts[account].running++
-				accounts[account].running_cpus += cpus
-			case suspended.MatchString(state):
-				accounts[account].suspended++
+		case running.MatchString(state):
+			accounts[account].running++
+			accounts[account].running_cpus += job.CPUs
+			accounts[account].running_mem += job.TRES["mem"]
+			accounts[account].running_nodes += job.Nodes
+			for gpuType, gpus := range jobGPUTypes(job) {
+				accounts[account].running_gpus[gpuType] += gpus
 			}
+		case suspended.MatchString(state):
+			accounts[account].suspended++
 		}
 	}
 	return accounts
 }
 
 type AccountsCollector struct {
-	pending      *prometheus.Desc
-	running      *prometheus.Desc
-	running_cpus *prometheus.Desc
-	suspended    *prometheus.Desc
-	logger       *logger.Logger
+	pending       *prometheus.Desc
+	running       *prometheus.Desc
+	running_cpus  *prometheus.Desc
+	suspended     *prometheus.Desc
+	running_mem   *prometheus.Desc
+	running_nodes *prometheus.Desc
+	running_gpus  *prometheus.Desc
+	pending_gpus  *prometheus.Desc
+	logger        *logger.Logger
 }
 
 func NewAccountsCollector(logger *logger.Logger) *AccountsCollector {
 	labels := []string{"account"}
+	gpuLabels := []string{"account", "gpu_type"}
 	return &AccountsCollector{
-		pending:      prometheus.NewDesc("slurm_account_jobs_pending", "Pending jobs for account", labels, nil),
-		running:      prometheus.NewDesc("slurm_account_jobs_running", "Running jobs for account", labels, nil),
-		running_cpus: prometheus.NewDesc("slurm_account_cpus_running", "Running cpus for account", labels, nil),
-		suspended:    prometheus.NewDesc("slurm_account_jobs_suspended", "Suspended jobs for account", labels, nil),
-		logger:       logger,
+		pending:       prometheus.NewDesc("slurm_account_jobs_pending", "Pending jobs for account", labels, nil),
+		running:       prometheus.NewDesc("slurm_account_jobs_running", "Running jobs for account", labels, nil),
+		running_cpus:  prometheus.NewDesc("slurm_account_cpus_running", "Running cpus for account", labels, nil),
+		suspended:     prometheus.NewDesc("slurm_account_jobs_suspended", "Suspended jobs for account", labels, nil),
+		running_mem:   prometheus.NewDesc("slurm_account_mem_running", "Running memory for account in MB", labels, nil),
+		running_nodes: prometheus.NewDesc("slurm_account_nodes_running", "Running nodes for account", labels, nil),
+		running_gpus:  prometheus.NewDesc("slurm_account_gpus_running", "Running gpus for account", gpuLabels, nil),
+		pending_gpus:  prometheus.NewDesc("slurm_account_gpus_pending", "Pending gpus for account", gpuLabels, nil),
+		logger:        logger,
 	}
 }
 
@@ -82,15 +88,18 @@ func (ac *AccountsCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- ac.running
 	ch <- ac.running_cpus
 	ch <- ac.suspended
+	ch <- ac.running_mem
+	ch <- ac.running_nodes
+	ch <- ac.running_gpus
+	ch <- ac.pending_gpus
 }
 
-func (ac *AccountsCollector) Collect(ch chan<- prometheus.Metric) {
-	data, err := AccountsData(ac.logger)
+func (ac *AccountsCollector) Update(s *Snapshot, ch chan<- prometheus.Metric) error {
+	jobs, err := s.Jobs()
 	if err != nil {
-		ac.logger.Error("Failed to get accounts data", "err", err)
-		return
+		return err
 	}
-	am := ParseAccountsMetrics(data)
+	am := ParseAccountsMetrics(jobs)
 	for a := range am {
 		if am[a].pending > 0 {
 			ch <- prometheus.MustNewConstMetric(ac.pending, prometheus.GaugeValue, am[a].pending, a)
@@ -104,5 +113,18 @@ func (ac *AccountsCollector) Collect(ch chan<- prometheus.Metric) {
 		if am[a].suspended > 0 {
 			ch <- prometheus.MustNewConstMetric(ac.suspended, prometheus.GaugeValue, am[a].suspended, a)
 		}
+		if am[a].running_mem > 0 {
+			ch <- prometheus.MustNewConstMetric(ac.running_mem, prometheus.GaugeValue, am[a].running_mem, a)
+		}
+		if am[a].running_nodes > 0 {
+			ch <- prometheus.MustNewConstMetric(ac.running_nodes, prometheus.GaugeValue, am[a].running_nodes, a)
+		}
+		for gpuType, gpus := range am[a].running_gpus {
+			ch <- prometheus.MustNewConstMetric(ac.running_gpus, prometheus.GaugeValue, gpus, a, gpuType)
+		}
+		for gpuType, gpus := range am[a].pending_gpus {
+			ch <- prometheus.MustNewConstMetric(ac.pending_gpus, prometheus.GaugeValue, gpus, a, gpuType)
+		}
 	}
+	return nil
 }
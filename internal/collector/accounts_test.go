@@ -0,0 +1,20 @@
+package collector
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAccountsMetrics(t *testing.T) {
+	data, err := os.ReadFile("../../test_data/squeue.txt")
+	assert.NoError(t, err)
+
+	accounts := ParseAccountsMetrics(ParseJobs(data))
+	assert.Len(t, accounts, 2)
+	assert.Equal(t, 19*48*1024.0, accounts["physics"].running_mem)
+	assert.Equal(t, 10.0, accounts["chemistry"].running_nodes)
+	assert.Equal(t, map[string]float64{"a100": 20}, accounts["chemistry"].running_gpus)
+	assert.Equal(t, map[string]float64{"h100": 8}, accounts["chemistry"].pending_gpus)
+}
@@ -0,0 +1,243 @@
+package collector
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// collectorResult holds the metrics of the last successful run of a collector.
+type collectorResult struct {
+	metrics   []prometheus.Metric
+	timestamp time.Time
+}
+
+// collectorStatus describes the last run of a collector, successful or not.
+type collectorStatus struct {
+	duration time.Duration
+	success  bool
+}
+
+// BackgroundCollector refreshes every collector on its own interval and
+// serves the metrics of its last successful refresh, so that scrapes never
+// reach slurmctld. Collectors that are due at the same time share a Snapshot.
+type BackgroundCollector struct {
+	cluster    string
+	collectors map[string]Collector
+	intervals  map[string]time.Duration
+	logger     *logger.Logger
+
+	dataAge     *prometheus.Desc
+	lastRefresh *prometheus.Desc
+
+	mu      sync.RWMutex
+	results map[string]*collectorResult
+	status  map[string]collectorStatus
+	running map[string]bool
+}
+
+// NewBackgroundCollector creates a BackgroundCollector querying the given
+// cluster, or the default one when cluster is empty. Collectors without an
+// entry in intervals are refreshed every defaultInterval.
+func NewBackgroundCollector(logger *logger.Logger, cluster string, collectors map[string]Collector, defaultInterval time.Duration, intervals map[string]time.Duration) *BackgroundCollector {
+	all := make(map[string]time.Duration, len(collectors))
+	for name := range collectors {
+		all[name] = defaultInterval
+		if interval, ok := intervals[name]; ok && interval > 0 {
+			all[name] = interval
+		}
+	}
+	return &BackgroundCollector{
+		cluster:    cluster,
+		collectors: collectors,
+		intervals:  all,
+		logger:     logger,
+		dataAge: prometheus.NewDesc("slurm_exporter_collector_data_age_seconds",
+			"Age of the metrics served for a collector, in seconds since its last successful refresh", []string{"collector"}, nil),
+		lastRefresh: prometheus.NewDesc("slurm_exporter_collector_last_refresh_timestamp_seconds",
+			"Unix timestamp of the last successful refresh of a collector", []string{"collector"}, nil),
+		results: make(map[string]*collectorResult),
+		status:  make(map[string]collectorStatus),
+		running: make(map[string]bool),
+	}
+}
+
+// Prime refreshes every collector once and waits for the refreshes to
+// complete, so that metrics are served as soon as bc is registered.
+func (bc *BackgroundCollector) Prime() {
+	names := make([]string, 0, len(bc.collectors))
+	for name := range bc.collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	bc.refresh(names).Wait()
+}
+
+// Start refreshes the collectors until ctx is cancelled. All collectors are
+// refreshed immediately, unless Prime already did, then each one whenever its
+// interval has elapsed. A refresh is skipped while the previous one of the
+// same collector is running.
+func (bc *BackgroundCollector) Start(ctx context.Context) {
+	next := make(map[string]time.Time, len(bc.collectors))
+	now := time.Now()
+	bc.mu.RLock()
+	for name := range bc.collectors {
+		next[name] = now
+		if result, ok := bc.results[name]; ok {
+			next[name] = result.timestamp.Add(bc.intervals[name])
+		}
+	}
+	bc.mu.RUnlock()
+
+	go func() {
+		timer := time.NewTimer(0)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+
+			now := time.Now()
+			var due []string
+			for name, at := range next {
+				if at.After(now) {
+					continue
+				}
+				due = append(due, name)
+				next[name] = at.Add(bc.intervals[name])
+				if next[name].Before(now) {
+					next[name] = now.Add(bc.intervals[name])
+				}
+			}
+			sort.Strings(due)
+			bc.refresh(due)
+
+			wake := now.Add(time.Hour)
+			for _, at := range next {
+				if at.Before(wake) {
+					wake = at
+				}
+			}
+			timer.Reset(time.Until(wake))
+		}
+	}()
+}
+
+// refresh runs the given collectors concurrently on a shared Snapshot. The
+// returned WaitGroup is done once all of them have completed.
+func (bc *BackgroundCollector) refresh(names []string) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	snapshot := NewClusterSnapshot(bc.logger, bc.cluster)
+	for _, name := range names {
+		bc.mu.Lock()
+		if bc.running[name] {
+			bc.mu.Unlock()
+			bc.logger.Warn("Skipping refresh, previous one still running", "collector", name)
+			continue
+		}
+		bc.running[name] = true
+		bc.mu.Unlock()
+
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			begin := time.Now()
+			result, err := runCollector(bc.collectors[name], snapshot)
+
+			bc.mu.Lock()
+			defer bc.mu.Unlock()
+			bc.running[name] = false
+			bc.status[name] = collectorStatus{duration: time.Since(begin), success: err == nil}
+			if err != nil {
+				bc.logger.Error("Collector failed, serving previous data", "collector", name, "err", err)
+				return
+			}
+			bc.results[name] = result
+		}(name)
+	}
+	return &wg
+}
+
+// runCollector runs a collector and buffers its metrics.
+func runCollector(c Collector, s *Snapshot) (*collectorResult, error) {
+	ch := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	result := &collectorResult{}
+	go func() {
+		for m := range ch {
+			result.metrics = append(result.metrics, m)
+		}
+		close(done)
+	}()
+	err := c.Update(s, ch)
+	close(ch)
+	<-done
+	result.timestamp = time.Now()
+	return result, err
+}
+
+func (bc *BackgroundCollector) Describe(ch chan<- *prometheus.Desc) {
+	bc.describe(ch, bc.collectors)
+}
+
+func (bc *BackgroundCollector) Collect(ch chan<- prometheus.Metric) {
+	bc.collect(ch, bc.collectors)
+}
+
+// Filter returns a view of bc serving only the last metrics of the named
+// collectors. Names that are not part of bc are ignored.
+func (bc *BackgroundCollector) Filter(names []string) prometheus.Collector {
+	return &backgroundFilter{bc: bc, collectors: filterCollectors(bc.collectors, names)}
+}
+
+// backgroundFilter serves a subset of the collectors of a BackgroundCollector.
+type backgroundFilter struct {
+	bc         *BackgroundCollector
+	collectors map[string]Collector
+}
+
+func (bf *backgroundFilter) Describe(ch chan<- *prometheus.Desc) {
+	bf.bc.describe(ch, bf.collectors)
+}
+
+func (bf *backgroundFilter) Collect(ch chan<- prometheus.Metric) {
+	bf.bc.collect(ch, bf.collectors)
+}
+
+func (bc *BackgroundCollector) describe(ch chan<- *prometheus.Desc, collectors map[string]Collector) {
+	for _, c := range collectors {
+		c.Describe(ch)
+	}
+	ch <- bc.dataAge
+	ch <- bc.lastRefresh
+	ch <- collectorDurationDesc
+	ch <- collectorSuccessDesc
+}
+
+// collect serves the last metrics and the status of the given collectors.
+func (bc *BackgroundCollector) collect(ch chan<- prometheus.Metric, collectors map[string]Collector) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	now := time.Now()
+	for name, result := range bc.results {
+		if _, ok := collectors[name]; !ok {
+			continue
+		}
+		for _, m := range result.metrics {
+			ch <- m
+		}
+		ch <- prometheus.MustNewConstMetric(bc.dataAge, prometheus.GaugeValue, now.Sub(result.timestamp).Seconds(), name)
+		ch <- prometheus.MustNewConstMetric(bc.lastRefresh, prometheus.GaugeValue, float64(result.timestamp.UnixNano())/1e9, name)
+	}
+	for name, status := range bc.status {
+		if _, ok := collectors[name]; ok {
+			sendCollectorStatus(ch, name, status.duration, status.success)
+		}
+	}
+}
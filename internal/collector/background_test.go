@@ -0,0 +1,135 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeCollector emits a single gauge holding the number of successful updates.
+type fakeCollector struct {
+	desc *prometheus.Desc
+
+	mu      sync.Mutex
+	updates int
+	fail    bool
+}
+
+func newFakeCollector(name string) *fakeCollector {
+	return &fakeCollector{desc: prometheus.NewDesc(name, "Number of updates", nil, nil)}
+}
+
+func (fc *fakeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- fc.desc
+}
+
+func (fc *fakeCollector) Update(s *Snapshot, ch chan<- prometheus.Metric) error {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if fc.fail {
+		return errors.New("slurm_load_jobs error: Socket timed out")
+	}
+	fc.updates++
+	ch <- prometheus.MustNewConstMetric(fc.desc, prometheus.GaugeValue, float64(fc.updates))
+	return nil
+}
+
+func (fc *fakeCollector) setFail(fail bool) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.fail = fail
+}
+
+func TestBackgroundCollector(t *testing.T) {
+	fast := newFakeCollector("test_fast")
+	slow := newFakeCollector("test_slow")
+	bc := NewBackgroundCollector(logger.NewLogger("error"), "",
+		map[string]Collector{"fast": fast, "slow": slow},
+		20*time.Millisecond, map[string]time.Duration{"slow": time.Hour})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bc.Start(ctx)
+
+	// The fast collector keeps refreshing, the slow one only ran at startup.
+	assert.Eventually(t, func() bool {
+		return gaugeValue(t, bc, "test_fast") >= 3
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, 1.0, gaugeValue(t, bc, "test_slow"))
+
+	// A failing refresh keeps serving the previous data, which gets older.
+	fast.setFail(true)
+	time.Sleep(25 * time.Millisecond)
+	served := gaugeValue(t, bc, "test_fast")
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, served, gaugeValue(t, bc, "test_fast"))
+	assert.GreaterOrEqual(t, gaugeValue(t, bc, "slurm_exporter_collector_data_age_seconds", "fast"), 0.03)
+	assert.Less(t, gaugeValue(t, bc, "slurm_exporter_collector_data_age_seconds", "slow"), 1.0)
+}
+
+func TestBackgroundCollectorFilter(t *testing.T) {
+	bc := NewBackgroundCollector(logger.NewLogger("error"), "",
+		map[string]Collector{"fast": newFakeCollector("test_fast"), "slow": newFakeCollector("test_slow")},
+		time.Hour, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bc.Start(ctx)
+	assert.Eventually(t, func() bool {
+		return gaugeValue(t, bc, "test_fast") == 1 && gaugeValue(t, bc, "test_slow") == 1
+	}, time.Second, 5*time.Millisecond)
+
+	filtered := bc.Filter([]string{"slow"})
+	assert.Equal(t, 1.0, gaugeValue(t, filtered, "test_slow"))
+	assert.Equal(t, -1.0, gaugeValue(t, filtered, "test_fast"))
+	assert.Equal(t, -1.0, gaugeValue(t, filtered, "slurm_exporter_collector_data_age_seconds", "fast"))
+	assert.Equal(t, 1.0, gaugeValue(t, filtered, "slurm_exporter_collector_success", "slow"))
+}
+
+func TestBackgroundCollectorPrime(t *testing.T) {
+	fc := newFakeCollector("test_fast")
+	bc := NewBackgroundCollector(logger.NewLogger("error"), "", map[string]Collector{"fast": fc}, time.Hour, nil)
+
+	// Prime serves metrics right away, and Start waits for the interval.
+	bc.Prime()
+	assert.Equal(t, 1.0, gaugeValue(t, bc, "test_fast"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bc.Start(ctx)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 1.0, gaugeValue(t, bc, "test_fast"))
+}
+
+// gaugeValue gathers c and returns the value of the named gauge, optionally
+// selecting the series of the given collector label.
+func gaugeValue(t *testing.T, c prometheus.Collector, name string, collectorLabel ...string) float64 {
+	t.Helper()
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error: %v", err)
+	}
+	for _, mf := range families {
+		if mf.GetName() != name {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			if len(collectorLabel) == 0 {
+				return m.GetGauge().GetValue()
+			}
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "collector" && l.GetValue() == collectorLabel[0] {
+					return m.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,96 @@
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// Collector is implemented by every Slurm collector. Update sends the
+// collector's metrics to ch, reading squeue and sinfo data from the snapshot
+// of the current scrape.
+type Collector interface {
+	Describe(ch chan<- *prometheus.Desc)
+	Update(s *Snapshot, ch chan<- prometheus.Metric) error
+}
+
+var (
+	collectorDurationDesc = prometheus.NewDesc("slurm_exporter_collector_duration_seconds",
+		"Duration of the last run of a collector, in seconds", []string{"collector"}, nil)
+	collectorSuccessDesc = prometheus.NewDesc("slurm_exporter_collector_success",
+		"Whether the last run of a collector succeeded (1) or failed (0)", []string{"collector"}, nil)
+)
+
+// SlurmCollector implements the Prometheus Collector interface for a set of
+// named Slurm collectors. Every scrape runs the collectors concurrently on a
+// fresh Snapshot, so squeue and sinfo are executed at most once per scrape.
+type SlurmCollector struct {
+	cluster    string
+	collectors map[string]Collector
+	logger     *logger.Logger
+}
+
+// NewSlurmCollector creates a SlurmCollector querying the given cluster of
+// the slurmdbd with -M, or the default cluster when cluster is empty.
+func NewSlurmCollector(logger *logger.Logger, cluster string, collectors map[string]Collector) *SlurmCollector {
+	return &SlurmCollector{
+		cluster:    cluster,
+		collectors: collectors,
+		logger:     logger,
+	}
+}
+
+// Filter returns a SlurmCollector running only the named collectors. Names
+// that are not part of sc are ignored.
+func (sc *SlurmCollector) Filter(names []string) prometheus.Collector {
+	return NewSlurmCollector(sc.logger, sc.cluster, filterCollectors(sc.collectors, names))
+}
+
+// filterCollectors returns the named collectors of collectors.
+func filterCollectors(collectors map[string]Collector, names []string) map[string]Collector {
+	filtered := make(map[string]Collector, len(names))
+	for _, name := range names {
+		if c, ok := collectors[name]; ok {
+			filtered[name] = c
+		}
+	}
+	return filtered
+}
+
+func (sc *SlurmCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range sc.collectors {
+		c.Describe(ch)
+	}
+	ch <- collectorDurationDesc
+	ch <- collectorSuccessDesc
+}
+
+func (sc *SlurmCollector) Collect(ch chan<- prometheus.Metric) {
+	snapshot := NewClusterSnapshot(sc.logger, sc.cluster)
+	var wg sync.WaitGroup
+	for name, c := range sc.collectors {
+		wg.Add(1)
+		go func(name string, c Collector) {
+			defer wg.Done()
+			begin := time.Now()
+			err := c.Update(snapshot, ch)
+			sendCollectorStatus(ch, name, time.Since(begin), err == nil)
+			if err != nil {
+				sc.logger.Error("Collector failed", "collector", name, "err", err)
+			}
+		}(name, c)
+	}
+	wg.Wait()
+}
+
+// sendCollectorStatus sends the duration and success metrics of a collector run.
+func sendCollectorStatus(ch chan<- prometheus.Metric, name string, duration time.Duration, success bool) {
+	value := 0.0
+	if success {
+		value = 1
+	}
+	ch <- prometheus.MustNewConstMetric(collectorDurationDesc, prometheus.GaugeValue, duration.Seconds(), name)
+	ch <- prometheus.MustNewConstMetric(collectorSuccessDesc, prometheus.GaugeValue, value, name)
+}
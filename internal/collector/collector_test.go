@@ -0,0 +1,148 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlurmCollectorStatus(t *testing.T) {
+	failing := newFakeCollector("test_failing")
+	failing.setFail(true)
+	sc := NewSlurmCollector(logger.NewLogger("error"), "", map[string]Collector{
+		"working": newFakeCollector("test_working"),
+		"failing": failing,
+	})
+
+	assert.Equal(t, 1.0, gaugeValue(t, sc, "slurm_exporter_collector_success", "working"))
+	assert.Equal(t, 0.0, gaugeValue(t, sc, "slurm_exporter_collector_success", "failing"))
+	assert.GreaterOrEqual(t, gaugeValue(t, sc, "slurm_exporter_collector_duration_seconds", "failing"), 0.0)
+	assert.Equal(t, -1.0, gaugeValue(t, sc, "test_failing"))
+}
+
+func TestSlurmCollectorFilter(t *testing.T) {
+	sc := NewSlurmCollector(logger.NewLogger("error"), "", map[string]Collector{
+		"nodes": newFakeCollector("test_nodes"),
+		"gpus":  newFakeCollector("test_gpus"),
+	})
+
+	filtered := sc.Filter([]string{"gpus", "unknown"})
+	assert.Equal(t, 1.0, gaugeValue(t, filtered, "test_gpus"))
+	assert.Equal(t, -1.0, gaugeValue(t, filtered, "test_nodes"))
+	assert.Equal(t, -1.0, gaugeValue(t, filtered, "slurm_exporter_collector_success", "nodes"))
+}
+
+func TestExecuteCounters(t *testing.T) {
+	oldRunner, oldTimeout := runner, commandTimeout
+	defer func() { runner, commandTimeout = oldRunner, oldTimeout }()
+	SetCommandTimeout(20 * time.Millisecond)
+	testLogger := logger.NewLogger("error")
+
+	counter := func(result string) float64 {
+		return testutil.ToFloat64(commandExecutions.WithLabelValues("sprobe", result))
+	}
+	success, failure, timeout := counter("success"), counter("error"), counter("timeout")
+
+	SetRunner(func(ctx context.Context, command string, args []string) ([]byte, error) {
+		return []byte("ok"), nil
+	})
+	_, err := Execute(testLogger, "sprobe", nil)
+	assert.NoError(t, err)
+
+	SetRunner(func(ctx context.Context, command string, args []string) ([]byte, error) {
+		return nil, errors.New("exit status 1")
+	})
+	_, err = Execute(testLogger, "sprobe", nil)
+	assert.Error(t, err)
+
+	SetRunner(func(ctx context.Context, command string, args []string) ([]byte, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	_, err = Execute(testLogger, "sprobe", nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	assert.Equal(t, success+1, counter("success"))
+	assert.Equal(t, failure+1, counter("error"))
+	assert.Equal(t, timeout+1, counter("timeout"))
+}
+
+func TestExecuteRetries(t *testing.T) {
+	oldRunner, oldRetries, oldBackoff := runner, commandRetries, commandBackoff
+	defer func() { runner, commandRetries, commandBackoff = oldRunner, oldRetries, oldBackoff }()
+	testLogger := logger.NewLogger("error")
+
+	attempts := 0
+	SetRunner(func(ctx context.Context, command string, args []string) ([]byte, error) {
+		attempts++
+		if attempts == 1 {
+			return []byte("slurm_load_jobs error: Socket timed out on send/recv operation"), errors.New("exit status 1")
+		}
+		return []byte("ok"), nil
+	})
+
+	SetCommandRetries(0, 0)
+	_, err := Execute(testLogger, "sprobe", nil)
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts)
+
+	attempts = 0
+	SetCommandRetries(1, time.Millisecond)
+	out, err := Execute(testLogger, "sprobe", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", string(out))
+	assert.Equal(t, 2, attempts)
+}
+
+func TestExecuteStatusOutput(t *testing.T) {
+	oldRunner, oldTimeout, oldRetries, oldBackoff := runner, commandTimeout, commandRetries, commandBackoff
+	defer func() {
+		runner, commandTimeout, commandRetries, commandBackoff = oldRunner, oldTimeout, oldRetries, oldBackoff
+	}()
+	testLogger := logger.NewLogger("error")
+	SetCommandTimeout(time.Second)
+
+	attempts := 0
+	SetRunner(func(ctx context.Context, command string, args []string) ([]byte, error) {
+		attempts++
+		return []byte("Slurmctld(primary) at ctl01 is UP\nSlurmctld(backup) at ctl02 is DOWN\n"), errors.New("exit status 1")
+	})
+	SetCommandRetries(2, time.Millisecond)
+
+	// The output of a failed command is kept, and a status is not retried.
+	out, err := executeOn(testLogger, "cluster01", "scontrol", []string{"ping"})
+	assert.Error(t, err)
+	assert.Contains(t, string(out), "ctl02 is DOWN")
+	assert.Equal(t, 1, attempts)
+
+	attempts = 0
+	_, err = Execute(testLogger, "sprobe", nil)
+	assert.Error(t, err)
+	assert.Equal(t, 3, attempts)
+}
+
+func TestCommandPolicy(t *testing.T) {
+	oldTimeout, oldRetries, oldBackoff := commandTimeout, commandRetries, commandBackoff
+	defer func() {
+		commandTimeout, commandRetries, commandBackoff = oldTimeout, oldRetries, oldBackoff
+		SetCommandPolicies(nil)
+	}()
+	SetCommandTimeout(5 * time.Second)
+	SetCommandRetries(1, time.Second)
+	SetCommandPolicies(map[string]CommandPolicy{
+		"sacctmgr":                {Timeout: time.Minute},
+		"scontrol":                {Timeout: 10 * time.Second},
+		"scontrol show assoc_mgr": {Timeout: 30 * time.Second, Retries: 2},
+	})
+
+	assert.Equal(t, CommandPolicy{Timeout: 5 * time.Second, Retries: 1, Backoff: time.Second}, commandPolicy("sinfo", []string{"-h"}))
+	assert.Equal(t, time.Minute, commandPolicy("sacctmgr", []string{"show", "qos"}).Timeout)
+	assert.Equal(t, 10*time.Second, commandPolicy("scontrol", []string{"show", "nodes", "-o"}).Timeout)
+	assert.Equal(t, CommandPolicy{Timeout: 30 * time.Second, Retries: 2}, commandPolicy("scontrol", []string{"show", "assoc_mgr", "flags=assoc,qos"}))
+	assert.Equal(t, 10*time.Second, commandPolicy("scontrol", nil).Timeout)
+}
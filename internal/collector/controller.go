@@ -0,0 +1,157 @@
+package collector
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// ControllerStatus is the answer of a slurmctld to "scontrol ping".
+type ControllerStatus struct {
+	Hostname string
+	Mode     string // "primary", "backup" or "backup<n>"
+	Up       bool
+}
+
+// pingLineRegex matches a line of "scontrol ping" such as
+// "Slurmctld(primary) at ctl01 is UP".
+var pingLineRegex = regexp.MustCompile(`^Slurmctld\(([^)]*)\) at (\S+) is (\S+)`)
+
+// ControllerPingData executes "scontrol ping" to check the primary and backup controllers.
+func ControllerPingData(logger *logger.Logger, cluster string) ([]byte, error) {
+	return executeOn(logger, cluster, "scontrol", []string{"ping"})
+}
+
+// ControllerConfigData executes "scontrol show config" to read the boot time of slurmctld.
+func ControllerConfigData(logger *logger.Logger, cluster string) ([]byte, error) {
+	return executeOn(logger, cluster, "scontrol", []string{"show", "config"})
+}
+
+/*
+SlurmdbdData executes sacctmgr to list the clusters registered in slurmdbd,
+which fails when slurmdbd cannot be reached. slurmdbd serves every cluster,
+so the command does not use -M.
+*/
+func SlurmdbdData(logger *logger.Logger) ([]byte, error) {
+	return Execute(logger, "sacctmgr", []string{"-n", "-P", "show", "cluster", "format=Cluster"})
+}
+
+// ParseControllerPing parses the output of "scontrol ping", one status per controller.
+func ParseControllerPing(input []byte) []ControllerStatus {
+	var controllers []ControllerStatus
+	for _, line := range strings.Split(string(input), "\n") {
+		match := pingLineRegex.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+		controllers = append(controllers, ControllerStatus{
+			Hostname: match[2],
+			Mode:     match[1],
+			Up:       match[3] == "UP",
+		})
+	}
+	return controllers
+}
+
+// ParseBootTime returns the BOOT_TIME of "scontrol show config", the time
+// slurmctld started. The zero time is returned when it is missing.
+func ParseBootTime(input []byte) time.Time {
+	for _, line := range strings.Split(string(input), "\n") {
+		key, value, found := strings.Cut(line, "=")
+		if found && strings.TrimSpace(key) == "BOOT_TIME" {
+			return parseSlurmTime(strings.TrimSpace(value))
+		}
+	}
+	return time.Time{}
+}
+
+/*
+ * Implement the Prometheus Collector interface and feed the
+ * Slurm controller health metrics into it.
+ * https://godoc.org/github.com/prometheus/client_golang/prometheus#Collector
+ */
+
+// ControllerCollector exports the availability of slurmctld and slurmdbd. A
+// controller or slurmdbd that does not answer is reported as down rather than
+// failing the collector, so that alerts can tell an outage of Slurm from a
+// broken exporter.
+type ControllerCollector struct {
+	up               *prometheus.Desc
+	reachable        *prometheus.Desc
+	pingDuration     *prometheus.Desc
+	uptime           *prometheus.Desc
+	slurmdbdUp       *prometheus.Desc
+	slurmdbdDuration *prometheus.Desc
+	// bootTime tells whether the backend prints "scontrol show config",
+	// slurmdbd whether this collector checks the slurmdbd shared by all
+	// the clusters.
+	bootTime bool
+	slurmdbd bool
+	logger   *logger.Logger
+}
+
+func NewControllerCollector(logger *logger.Logger, bootTime, slurmdbd bool) *ControllerCollector {
+	return &ControllerCollector{
+		up:               prometheus.NewDesc("slurm_controller_up", "Whether the controller answered scontrol ping (1) or not (0)", []string{"hostname", "mode"}, nil),
+		reachable:        prometheus.NewDesc("slurm_controller_reachable", "Whether at least one controller answered scontrol ping (1) or not (0)", nil, nil),
+		pingDuration:     prometheus.NewDesc("slurm_controller_ping_duration_seconds", "Time taken by scontrol ping", nil, nil),
+		uptime:           prometheus.NewDesc("slurm_controller_uptime_seconds", "Time since the slurmctld answering the commands started", nil, nil),
+		slurmdbdUp:       prometheus.NewDesc("slurm_slurmdbd_up", "Whether slurmdbd answered sacctmgr show cluster (1) or not (0)", nil, nil),
+		slurmdbdDuration: prometheus.NewDesc("slurm_slurmdbd_ping_duration_seconds", "Time taken by sacctmgr show cluster", nil, nil),
+		bootTime:         bootTime,
+		slurmdbd:         slurmdbd,
+		logger:           logger,
+	}
+}
+
+func (cc *ControllerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cc.up
+	ch <- cc.reachable
+	ch <- cc.pingDuration
+	ch <- cc.uptime
+	ch <- cc.slurmdbdUp
+	ch <- cc.slurmdbdDuration
+}
+
+func (cc *ControllerCollector) Update(s *Snapshot, ch chan<- prometheus.Metric) error {
+	// scontrol ping exits with an error when a controller is down, its
+	// output still tells which ones answered. Without output, no controller
+	// could be reached.
+	start := time.Now()
+	data, _ := ControllerPingData(cc.logger, s.Cluster())
+	ch <- prometheus.MustNewConstMetric(cc.pingDuration, prometheus.GaugeValue, time.Since(start).Seconds())
+	reachable := 0.0
+	for _, c := range ParseControllerPing(data) {
+		up := 0.0
+		if c.Up {
+			up, reachable = 1, 1
+		}
+		ch <- prometheus.MustNewConstMetric(cc.up, prometheus.GaugeValue, up, c.Hostname, c.Mode)
+	}
+	ch <- prometheus.MustNewConstMetric(cc.reachable, prometheus.GaugeValue, reachable)
+
+	if reachable == 1 && cc.bootTime {
+		config, err := ControllerConfigData(cc.logger, s.Cluster())
+		if err == nil {
+			if boot := ParseBootTime(config); !boot.IsZero() {
+				ch <- prometheus.MustNewConstMetric(cc.uptime, prometheus.GaugeValue, time.Since(boot).Seconds())
+			}
+		}
+	}
+
+	if !cc.slurmdbd {
+		return nil
+	}
+	start = time.Now()
+	_, err := SlurmdbdData(cc.logger)
+	ch <- prometheus.MustNewConstMetric(cc.slurmdbdDuration, prometheus.GaugeValue, time.Since(start).Seconds())
+	slurmdbdUp := 0.0
+	if err == nil {
+		slurmdbdUp = 1
+	}
+	ch <- prometheus.MustNewConstMetric(cc.slurmdbdUp, prometheus.GaugeValue, slurmdbdUp)
+	return nil
+}
@@ -0,0 +1,107 @@
+package collector
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseControllerPing(t *testing.T) {
+	data, err := os.ReadFile("../../test_data/scontrol_ping.txt")
+	assert.NoError(t, err)
+
+	assert.Equal(t, []ControllerStatus{
+		{Hostname: "ctl01", Mode: "primary", Up: true},
+		{Hostname: "ctl02", Mode: "backup", Up: false},
+	}, ParseControllerPing(data))
+}
+
+func TestParseBootTime(t *testing.T) {
+	data, err := os.ReadFile("../../test_data/scontrol_config.txt")
+	assert.NoError(t, err)
+
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local), ParseBootTime(data))
+	assert.True(t, ParseBootTime([]byte("ClusterName = cluster01\n")).IsZero())
+}
+
+func TestControllerCollector(t *testing.T) {
+	oldExecute := Execute
+	defer func() { Execute = oldExecute }()
+	slurmdbdDown, slurmctldDown := false, false
+	Execute = func(logger *logger.Logger, command string, args []string) ([]byte, error) {
+		switch {
+		case command == "sacctmgr" && slurmdbdDown:
+			return nil, errors.New("exit status 1")
+		case command == "sacctmgr":
+			return []byte("cluster01\n"), nil
+		case slurmctldDown:
+			return nil, errors.New("exit status 1")
+		case args[0] == "ping":
+			// scontrol ping exits with an error as the backup is down
+			data, _ := os.ReadFile("../../test_data/scontrol_ping.txt")
+			return data, errors.New("exit status 1")
+		}
+		return os.ReadFile("../../test_data/scontrol_config.txt")
+	}
+
+	cc := NewControllerCollector(logger.NewLogger("error"), true, true)
+	expected := `
+# HELP slurm_controller_reachable Whether at least one controller answered scontrol ping (1) or not (0)
+# TYPE slurm_controller_reachable gauge
+slurm_controller_reachable 1
+# HELP slurm_controller_up Whether the controller answered scontrol ping (1) or not (0)
+# TYPE slurm_controller_up gauge
+slurm_controller_up{hostname="ctl01",mode="primary"} 1
+slurm_controller_up{hostname="ctl02",mode="backup"} 0
+# HELP slurm_slurmdbd_up Whether slurmdbd answered sacctmgr show cluster (1) or not (0)
+# TYPE slurm_slurmdbd_up gauge
+slurm_slurmdbd_up 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(updater{cc}, strings.NewReader(expected),
+		"slurm_controller_reachable", "slurm_controller_up", "slurm_slurmdbd_up"))
+	assert.Equal(t, 1, testutil.CollectAndCount(updater{cc}, "slurm_controller_uptime_seconds"))
+
+	// An unreachable slurmdbd is reported, not a failure of the collector
+	slurmdbdDown = true
+	expected = `
+# HELP slurm_slurmdbd_up Whether slurmdbd answered sacctmgr show cluster (1) or not (0)
+# TYPE slurm_slurmdbd_up gauge
+slurm_slurmdbd_up 0
+`
+	assert.NoError(t, testutil.CollectAndCompare(updater{cc}, strings.NewReader(expected), "slurm_slurmdbd_up"))
+
+	// Without an answering controller, the uptime is unknown
+	slurmctldDown = true
+	expected = `
+# HELP slurm_controller_reachable Whether at least one controller answered scontrol ping (1) or not (0)
+# TYPE slurm_controller_reachable gauge
+slurm_controller_reachable 0
+`
+	assert.NoError(t, testutil.CollectAndCompare(updater{cc}, strings.NewReader(expected), "slurm_controller_reachable"))
+	assert.Equal(t, 0, testutil.CollectAndCount(updater{cc}, "slurm_controller_uptime_seconds"))
+}
+
+// TestControllerCollectorOptions checks that the configuration is not read
+// without bootTime, as with slurmrestd, and that only the collector checking
+// slurmdbd runs sacctmgr.
+func TestControllerCollectorOptions(t *testing.T) {
+	oldExecute := Execute
+	defer func() { Execute = oldExecute }()
+	var commands []string
+	Execute = func(logger *logger.Logger, command string, args []string) ([]byte, error) {
+		commands = append(commands, command+" "+strings.Join(args, " "))
+		return os.ReadFile("../../test_data/scontrol_ping.txt")
+	}
+
+	cc := NewControllerCollector(logger.NewLogger("error"), false, false)
+	assert.Equal(t, 1, testutil.CollectAndCount(updater{cc}, "slurm_controller_reachable"))
+	assert.Equal(t, []string{"scontrol ping"}, commands)
+	assert.Equal(t, 0, testutil.CollectAndCount(updater{cc}, "slurm_controller_uptime_seconds"))
+	assert.Equal(t, 0, testutil.CollectAndCount(updater{cc}, "slurm_slurmdbd_up"))
+}
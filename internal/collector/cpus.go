@@ -15,14 +15,6 @@ type CPUsMetrics struct {
 	total float64
 }
 
-func CPUsGetMetrics(logger *logger.Logger) (*CPUsMetrics, error) {
-	data, err := CPUsData(logger)
-	if err != nil {
-		return nil, err
-	}
-	return ParseCPUsMetrics(data), nil
-}
-
 /*
 ParseCPUsMetrics parses the output of the sinfo command for CPU metrics.
 Expected input format: "allocated/idle/other/total".
@@ -39,13 +31,19 @@ func ParseCPUsMetrics(input []byte) *CPUsMetrics {
 	return &cm
 }
 
-
 /*
-CPUsData executes the sinfo command to retrieve CPU information.
-Expected sinfo output format: "%C" (allocated/idle/other/total CPUs).
+SumCPUsMetrics adds up the CPU states of the sinfo snapshot, counting nodes
+listed in several partitions only once like "sinfo -o %C" does.
 */
-func CPUsData(logger *logger.Logger) ([]byte, error) {
-	return Execute(logger, "sinfo", []string{"-h", "-o", "%C"})
+func SumCPUsMetrics(nodes []NodeRecord) *CPUsMetrics {
+	var cm CPUsMetrics
+	for _, node := range uniqueNodes(nodes) {
+		cm.alloc += node.CPUs.alloc
+		cm.idle += node.CPUs.idle
+		cm.other += node.CPUs.other
+		cm.total += node.CPUs.total
+	}
+	return &cm
 }
 
 /*
@@ -72,21 +70,21 @@ type CPUsCollector struct {
 	logger *logger.Logger
 }
 
-
 func (cc *CPUsCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- cc.alloc
 	ch <- cc.idle
 	ch <- cc.other
 	ch <- cc.total
 }
-func (cc *CPUsCollector) Collect(ch chan<- prometheus.Metric) {
-	cm, err := CPUsGetMetrics(cc.logger)
+func (cc *CPUsCollector) Update(s *Snapshot, ch chan<- prometheus.Metric) error {
+	nodes, err := s.Nodes()
 	if err != nil {
-		cc.logger.Error("Failed to get CPUs metrics", "err", err)
-		return
+		return err
 	}
+	cm := SumCPUsMetrics(nodes)
 	ch <- prometheus.MustNewConstMetric(cc.alloc, prometheus.GaugeValue, cm.alloc)
 	ch <- prometheus.MustNewConstMetric(cc.idle, prometheus.GaugeValue, cm.idle)
 	ch <- prometheus.MustNewConstMetric(cc.other, prometheus.GaugeValue, cm.other)
 	ch <- prometheus.MustNewConstMetric(cc.total, prometheus.GaugeValue, cm.total)
+	return nil
 }
@@ -0,0 +1,309 @@
+package collector
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// efficiencyStates are the job states read by the efficiency collector, as
+// passed to "sacct --state": running jobs and the final states of sacctStates.
+const efficiencyStates = "R," + sacctStates
+
+// sstatBatchSize is the number of job IDs passed to a single sstat call,
+// keeping its command line short on clusters with many running jobs.
+const sstatBatchSize = 500
+
+// StepUsage is the resource usage of a job step.
+type StepUsage struct {
+	CPUTime float64 // CPU time of all the tasks in seconds
+	Mem     float64 // Peak resident memory of the largest task (MaxRSS) in MB
+}
+
+// JobEfficiency holds the allocation of a job and the usage of its steps.
+type JobEfficiency struct {
+	JobID   string
+	User    string
+	Account string
+	Running bool
+	Elapsed float64 // Elapsed time in seconds
+	CPUs    float64 // Allocated CPUs
+	Mem     float64 // Allocated memory in MB
+	Steps   map[string]StepUsage
+}
+
+/*
+EfficiencyJobsData executes the sacct command to retrieve the jobs and steps that ran between start and end.
+Expected sacct output format: "JobIDRaw|User|Account|State|Elapsed|AllocCPUS|AllocTRES|TRESUsageInTot|MaxRSS".
+*/
+func EfficiencyJobsData(logger *logger.Logger, cluster string, start, end time.Time) ([]byte, error) {
+	args := []string{
+		"-a", "-n", "-P",
+		"-S", start.Format(slurmTimeLayout),
+		"-E", end.Format(slurmTimeLayout),
+		"-s", efficiencyStates,
+		"-o", "JobIDRaw,User,Account,State,Elapsed,AllocCPUS,AllocTRES,TRESUsageInTot,MaxRSS",
+	}
+	return executeOn(logger, cluster, "sacct", args)
+}
+
+/*
+EfficiencyStepsData executes the sstat command to retrieve the usage of the running steps of jobIDs.
+The job IDs are queried sstatBatchSize at a time and the outputs joined; the output of the batches
+that succeeded is returned along with the errors of the others.
+Expected sstat output format: "JobID|TRESUsageInTot|MaxRSS".
+*/
+func EfficiencyStepsData(logger *logger.Logger, cluster string, jobIDs []string) ([]byte, error) {
+	var out []byte
+	var errs []error
+	for start := 0; start < len(jobIDs); start += sstatBatchSize {
+		batch := jobIDs[start:min(start+sstatBatchSize, len(jobIDs))]
+		data, err := executeOn(logger, cluster, "sstat", []string{"-a", "-n", "-P", "-j", strings.Join(batch, ","), "-o", "JobID,TRESUsageInTot,MaxRSS"})
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		out = append(out, data...)
+		if len(out) > 0 && out[len(out)-1] != '\n' {
+			out = append(out, '\n')
+		}
+	}
+	return out, errors.Join(errs...)
+}
+
+/*
+ParseEfficiencyJobs parses the output of EfficiencyJobsData.
+Step lines ("<job>.<step>") are attached to their job. Jobs that never ran are left out.
+*/
+func ParseEfficiencyJobs(input []byte) []*JobEfficiency {
+	var jobs []*JobEfficiency
+	byID := make(map[string]*JobEfficiency)
+	for _, line := range strings.Split(string(input), "\n") {
+		fields := strings.Split(line, "|")
+		if len(fields) < 9 {
+			continue
+		}
+		jobID, step, isStep := strings.Cut(fields[0], ".")
+		if isStep {
+			if job, ok := byID[jobID]; ok && fields[7] != "" {
+				job.Steps[step] = parseStepUsage(fields[7], fields[8])
+			}
+			continue
+		}
+		elapsed := parseSlurmDuration(fields[4])
+		cpus, _ := strconv.ParseFloat(fields[5], 64)
+		if elapsed <= 0 || cpus <= 0 {
+			continue
+		}
+		job := &JobEfficiency{
+			JobID:   jobID,
+			User:    fields[1],
+			Account: fields[2],
+			Running: fields[3] == "RUNNING",
+			Elapsed: elapsed,
+			CPUs:    cpus,
+			Mem:     ParseNodeTRES(fields[6])["mem"],
+			Steps:   make(map[string]StepUsage),
+		}
+		byID[jobID] = job
+		jobs = append(jobs, job)
+	}
+	return jobs
+}
+
+/*
+ParseStepUsage parses the output of EfficiencyStepsData into the usage of every step, by step ID.
+*/
+func ParseStepUsage(input []byte) map[string]StepUsage {
+	steps := make(map[string]StepUsage)
+	for _, line := range strings.Split(string(input), "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "|")
+		if len(fields) < 3 || !strings.Contains(fields[0], ".") {
+			continue
+		}
+		steps[fields[0]] = parseStepUsage(fields[1], fields[2])
+	}
+	return steps
+}
+
+// parseStepUsage parses the CPU time of a TRESUsageInTot value such as
+// "cpu=00:01:40,energy=0,fs/disk=2104,mem=1.50M,pages=0,vmem=2.10M" and a
+// MaxRSS value such as "1536K". The mem of TRESUsageInTot is summed over the
+// tasks, so the peak memory is taken from MaxRSS, as seff does.
+func parseStepUsage(tres, maxRSS string) StepUsage {
+	var usage StepUsage
+	for _, item := range strings.Split(tres, ",") {
+		name, count, _ := strings.Cut(item, "=")
+		if name == "cpu" {
+			usage.CPUTime = parseSlurmDuration(count)
+		}
+	}
+	usage.Mem, _ = parseTRESCount(maxRSS)
+	return usage
+}
+
+// parseSlurmDuration parses a Slurm duration such as "2-03:04:05",
+// "03:04:05" or "04:05.123" into seconds. Invalid values return 0.
+func parseSlurmDuration(value string) float64 {
+	days := 0.0
+	if d, rest, found := strings.Cut(value, "-"); found {
+		var err error
+		if days, err = strconv.ParseFloat(d, 64); err != nil {
+			return 0
+		}
+		value = rest
+	}
+	parts := strings.Split(value, ":")
+	if len(parts) > 3 {
+		return 0
+	}
+	seconds := 0.0
+	for _, part := range parts {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0
+		}
+		seconds = seconds*60 + v
+	}
+	return days*86400 + seconds
+}
+
+// jobUsage returns the CPU time used by all steps of a job and the peak
+// memory of its largest step.
+func jobUsage(job *JobEfficiency) (cpuTime, mem float64) {
+	for _, step := range job.Steps {
+		cpuTime += step.CPUTime
+		if step.Mem > mem {
+			mem = step.Mem
+		}
+	}
+	return cpuTime, mem
+}
+
+/*
+ * Implement the Prometheus Collector interface and feed the
+ * Slurm job efficiency metrics into it.
+ * https://godoc.org/github.com/prometheus/client_golang/prometheus#Collector
+ */
+
+// efficiencyTotals accumulates the usage and allocation of the jobs of a
+// user and account in one state.
+type efficiencyTotals struct {
+	jobs, cpuUsed, cpuAlloc, memUsed, memAlloc float64
+}
+
+// EfficiencyCollector compares the CPU time and peak memory of jobs with
+// their allocation. Running jobs are sampled with sstat, jobs that finished
+// in the lookback window are read from sacct.
+type EfficiencyCollector struct {
+	jobs     *prometheus.Desc
+	cpuUsed  *prometheus.Desc
+	cpuAlloc *prometheus.Desc
+	memUsed  *prometheus.Desc
+	memAlloc *prometheus.Desc
+	jobCPU   *prometheus.Desc
+	jobMem   *prometheus.Desc
+	lookback time.Duration
+	perJob   bool
+	logger   *logger.Logger
+}
+
+// NewEfficiencyCollector creates an EfficiencyCollector reading the jobs
+// that finished in the last lookback. perJob enables the per-job ratios.
+func NewEfficiencyCollector(logger *logger.Logger, lookback time.Duration, perJob bool) *EfficiencyCollector {
+	labels := []string{"user", "account", "state"}
+	jobLabels := []string{"job_id", "user", "account", "state"}
+	return &EfficiencyCollector{
+		jobs:     prometheus.NewDesc("slurm_efficiency_jobs", "Jobs accounted in the efficiency metrics", labels, nil),
+		cpuUsed:  prometheus.NewDesc("slurm_efficiency_cpu_used_seconds", "CPU time used by the jobs", labels, nil),
+		cpuAlloc: prometheus.NewDesc("slurm_efficiency_cpu_allocated_seconds", "Elapsed time multiplied by the allocated CPUs of the jobs", labels, nil),
+		memUsed:  prometheus.NewDesc("slurm_efficiency_mem_used", "Peak memory used by the jobs in MB", labels, nil),
+		memAlloc: prometheus.NewDesc("slurm_efficiency_mem_allocated", "Memory allocated to the jobs in MB", labels, nil),
+		jobCPU:   prometheus.NewDesc("slurm_job_cpu_efficiency", "CPU time used by the job over its elapsed time multiplied by its allocated CPUs", jobLabels, nil),
+		jobMem:   prometheus.NewDesc("slurm_job_mem_efficiency", "Peak memory used by the job over its allocated memory", jobLabels, nil),
+		lookback: lookback,
+		perJob:   perJob,
+		logger:   logger,
+	}
+}
+
+func (ec *EfficiencyCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- ec.jobs
+	ch <- ec.cpuUsed
+	ch <- ec.cpuAlloc
+	ch <- ec.memUsed
+	ch <- ec.memAlloc
+	ch <- ec.jobCPU
+	ch <- ec.jobMem
+}
+
+func (ec *EfficiencyCollector) Update(s *Snapshot, ch chan<- prometheus.Metric) error {
+	end := time.Now().Truncate(time.Second)
+	data, err := EfficiencyJobsData(ec.logger, s.Cluster(), end.Add(-ec.lookback), end)
+	if err != nil {
+		return err
+	}
+	jobs := ParseEfficiencyJobs(data)
+
+	// sacct only knows the usage of finished steps, running steps are
+	// sampled with sstat on the cluster of the snapshot.
+	running := make(map[string]*JobEfficiency)
+	var runningIDs []string
+	for _, job := range jobs {
+		if job.Running {
+			running[job.JobID] = job
+			runningIDs = append(runningIDs, job.JobID)
+		}
+	}
+	if len(runningIDs) > 0 {
+		data, err := EfficiencyStepsData(ec.logger, s.Cluster(), runningIDs)
+		if err != nil {
+			ec.logger.Warn("Failed to sample running steps, only finished steps are accounted", "err", err)
+		}
+		for id, usage := range ParseStepUsage(data) {
+			jobID, step, _ := strings.Cut(id, ".")
+			if job, ok := running[jobID]; ok {
+				job.Steps[step] = usage
+			}
+		}
+	}
+
+	type key struct{ user, account, state string }
+	totals := make(map[key]*efficiencyTotals)
+	for _, job := range jobs {
+		state := "finished"
+		if job.Running {
+			state = "running"
+		}
+		cpuTime, mem := jobUsage(job)
+		k := key{job.User, job.Account, state}
+		if totals[k] == nil {
+			totals[k] = &efficiencyTotals{}
+		}
+		t := totals[k]
+		t.jobs++
+		t.cpuUsed += cpuTime
+		t.cpuAlloc += job.Elapsed * job.CPUs
+		t.memUsed += mem
+		t.memAlloc += job.Mem
+
+		if ec.perJob {
+			ch <- prometheus.MustNewConstMetric(ec.jobCPU, prometheus.GaugeValue, cpuTime/(job.Elapsed*job.CPUs), job.JobID, job.User, job.Account, state)
+			if job.Mem > 0 {
+				ch <- prometheus.MustNewConstMetric(ec.jobMem, prometheus.GaugeValue, mem/job.Mem, job.JobID, job.User, job.Account, state)
+			}
+		}
+	}
+	for k, t := range totals {
+		ch <- prometheus.MustNewConstMetric(ec.jobs, prometheus.GaugeValue, t.jobs, k.user, k.account, k.state)
+		ch <- prometheus.MustNewConstMetric(ec.cpuUsed, prometheus.GaugeValue, t.cpuUsed, k.user, k.account, k.state)
+		ch <- prometheus.MustNewConstMetric(ec.cpuAlloc, prometheus.GaugeValue, t.cpuAlloc, k.user, k.account, k.state)
+		ch <- prometheus.MustNewConstMetric(ec.memUsed, prometheus.GaugeValue, t.memUsed, k.user, k.account, k.state)
+		ch <- prometheus.MustNewConstMetric(ec.memAlloc, prometheus.GaugeValue, t.memAlloc, k.user, k.account, k.state)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSlurmDuration(t *testing.T) {
+	assert.Equal(t, 3723.0, parseSlurmDuration("01:02:03"))
+	assert.Equal(t, 2*86400+3723.0, parseSlurmDuration("2-01:02:03"))
+	assert.Equal(t, 65.5, parseSlurmDuration("01:05.500"))
+	assert.Equal(t, 0.0, parseSlurmDuration("INVALID"))
+}
+
+func TestParseEfficiencyJobs(t *testing.T) {
+	data, err := os.ReadFile("../../test_data/sacct_efficiency.txt")
+	assert.NoError(t, err)
+
+	// The cancelled job 2003 never ran.
+	jobs := ParseEfficiencyJobs(data)
+	assert.Len(t, jobs, 3)
+
+	assert.Equal(t, "2001", jobs[0].JobID)
+	assert.Equal(t, "alice", jobs[0].User)
+	assert.False(t, jobs[0].Running)
+	assert.Equal(t, 3600.0, jobs[0].Elapsed)
+	assert.Equal(t, 4.0, jobs[0].CPUs)
+	assert.Equal(t, 16384.0, jobs[0].Mem)
+	assert.Equal(t, StepUsage{CPUTime: 7200, Mem: 8192}, jobs[0].Steps["batch"])
+
+	// Running steps have no usage in sacct.
+	assert.True(t, jobs[1].Running)
+	assert.Len(t, jobs[1].Steps, 1)
+	cpuTime, mem := jobUsage(jobs[2])
+	assert.Equal(t, 86400.0, cpuTime)
+	assert.Equal(t, 3900.0, mem)
+}
+
+func TestEfficiencyCollector(t *testing.T) {
+	oldExecute := Execute
+	defer func() { Execute = oldExecute }()
+	Execute = func(logger *logger.Logger, command string, args []string) ([]byte, error) {
+		if command == "sstat" {
+			assert.Equal(t, "2002", args[4])
+			return os.ReadFile("../../test_data/sstat.txt")
+		}
+		return os.ReadFile("../../test_data/sacct_efficiency.txt")
+	}
+
+	ec := NewEfficiencyCollector(logger.NewLogger("error"), time.Hour, true)
+	expected := `
+# HELP slurm_efficiency_cpu_used_seconds CPU time used by the jobs
+# TYPE slurm_efficiency_cpu_used_seconds gauge
+slurm_efficiency_cpu_used_seconds{account="chemistry",state="running",user="bob"} 39660
+slurm_efficiency_cpu_used_seconds{account="physics",state="finished",user="alice"} 93600
+# HELP slurm_job_mem_efficiency Peak memory used by the job over its allocated memory
+# TYPE slurm_job_mem_efficiency gauge
+slurm_job_mem_efficiency{account="chemistry",job_id="2002",state="running",user="bob"} 0.78125
+slurm_job_mem_efficiency{account="physics",job_id="2001",state="finished",user="alice"} 0.5
+slurm_job_mem_efficiency{account="physics",job_id="2004",state="finished",user="alice"} 0.975
+`
+	assert.NoError(t, testutil.CollectAndCompare(updater{ec}, strings.NewReader(expected),
+		"slurm_efficiency_cpu_used_seconds", "slurm_job_mem_efficiency"))
+	assert.Equal(t, 3, testutil.CollectAndCount(updater{ec}, "slurm_job_cpu_efficiency"))
+}
+
+func TestEfficiencyStepsDataBatches(t *testing.T) {
+	oldExecute := Execute
+	defer func() { Execute = oldExecute }()
+	var batches [][]string
+	Execute = func(logger *logger.Logger, command string, args []string) ([]byte, error) {
+		ids := strings.Split(args[4], ",")
+		batches = append(batches, ids)
+		if len(batches) == 2 {
+			return nil, errors.New("exit status 1")
+		}
+		return []byte(ids[0] + ".0|cpu=00:01:00,mem=1M|1024K"), nil
+	}
+
+	var jobIDs []string
+	for i := 0; i < 2*sstatBatchSize+1; i++ {
+		jobIDs = append(jobIDs, fmt.Sprint(1000+i))
+	}
+	data, err := EfficiencyStepsData(logger.NewLogger("error"), "", jobIDs)
+	assert.Error(t, err)
+	assert.Len(t, batches, 3)
+	assert.Len(t, batches[0], sstatBatchSize)
+	assert.Equal(t, []string{"2000"}, batches[2])
+
+	// The steps of the batches that succeeded are kept.
+	steps := ParseStepUsage(data)
+	assert.Len(t, steps, 2)
+	assert.Contains(t, steps, "1000.0")
+	assert.Contains(t, steps, "2000.0")
+}
+
+func TestEfficiencyCollectorCluster(t *testing.T) {
+	oldExecute := Execute
+	defer func() { Execute = oldExecute }()
+	var sstatArgs []string
+	Execute = func(logger *logger.Logger, command string, args []string) ([]byte, error) {
+		if command == "sstat" {
+			sstatArgs = args
+			return os.ReadFile("../../test_data/sstat.txt")
+		}
+		return os.ReadFile("../../test_data/sacct_efficiency.txt")
+	}
+
+	ec := NewEfficiencyCollector(logger.NewLogger("error"), time.Hour, false)
+	ch := make(chan prometheus.Metric, 100)
+	assert.NoError(t, ec.Update(NewClusterSnapshot(logger.NewLogger("error"), "beta"), ch))
+	// Running jobs are sampled on the cluster of the snapshot.
+	assert.Equal(t, []string{"-M", "beta"}, sstatArgs[:2])
+}
@@ -3,40 +3,189 @@ package collector
 import (
 	"context"
 	"os/exec"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sckyzo/slurm_exporter/internal/logger"
 )
 
 var (
 	commandTimeout time.Duration
+	commandRetries int
+	commandBackoff time.Duration
+	runner         Runner = runCommand
+
+	// commandPolicies overrides the default timeout and retries of some
+	// Slurm commands, see SetCommandPolicies.
+	commandPoliciesMu sync.RWMutex
+	commandPolicies   map[string]CommandPolicy
+
+	// commandPaths maps Slurm commands to the binary executed by runCommand.
+	commandPathsMu sync.RWMutex
+	commandPaths   map[string]string
+
+	// commandExecutions counts the executions of every Slurm command by
+	// result: "success", "error" or "timeout".
+	commandExecutions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "slurm_exporter_command_executions_total",
+		Help: "Number of Slurm command executions by command and result",
+	}, []string{"command", "result"})
 )
 
+// Runner produces the output of a Slurm command. The default runner executes
+// the command locally; alternative backends (e.g. slurmrestd) render the same
+// output from another data source so that every collector keeps its parser.
+type Runner func(ctx context.Context, command string, args []string) ([]byte, error)
+
+// CommandPolicy sets how long a Slurm command may run and how often it is
+// retried when it fails or times out.
+type CommandPolicy struct {
+	Timeout time.Duration
+	Retries int           // Additional attempts after a failure
+	Backoff time.Duration // Wait before the first retry, doubled for each next one
+}
+
 // SetCommandTimeout sets the timeout for external commands.
 func SetCommandTimeout(t time.Duration) {
 	commandTimeout = t
 }
 
-// Execute is a wrapper around exec.CommandContext to provide logging and a timeout.
+// SetCommandRetries sets how often failed commands are retried, and the wait
+// before the first retry.
+func SetCommandRetries(retries int, backoff time.Duration) {
+	commandRetries = retries
+	commandBackoff = backoff
+}
+
+// SetCommandPolicies overrides the default timeout and retries of the
+// commands matching the keys of policies: a command name such as "sacctmgr",
+// or a command followed by its leading arguments such as
+// "scontrol show assoc_mgr". The longest matching key wins.
+func SetCommandPolicies(policies map[string]CommandPolicy) {
+	commandPoliciesMu.Lock()
+	defer commandPoliciesMu.Unlock()
+	commandPolicies = policies
+}
+
+// commandPolicy returns the policy of a command line.
+func commandPolicy(command string, args []string) CommandPolicy {
+	commandPoliciesMu.RLock()
+	defer commandPoliciesMu.RUnlock()
+	policy := CommandPolicy{Timeout: commandTimeout, Retries: commandRetries, Backoff: commandBackoff}
+	longest := 0
+	for key, p := range commandPolicies {
+		fields := strings.Fields(key)
+		if len(fields) == 0 || fields[0] != command || len(fields)-1 > len(args) || len(fields) <= longest {
+			continue
+		}
+		if slices.Equal(fields[1:], args[:len(fields)-1]) {
+			policy, longest = p, len(fields)
+		}
+	}
+	return policy
+}
+
+// SetRunner replaces the backend used by Execute to obtain command output.
+func SetRunner(r Runner) {
+	runner = r
+}
+
+// SetCommandPaths sets the binaries executed for Slurm commands, such as
+// "squeue": "/opt/slurm/bin/squeue". Commands without a path are looked up
+// in $PATH.
+func SetCommandPaths(paths map[string]string) {
+	commandPathsMu.Lock()
+	defer commandPathsMu.Unlock()
+	commandPaths = paths
+}
+
+// runCommand executes the command locally and returns its combined output.
+func runCommand(ctx context.Context, command string, args []string) ([]byte, error) {
+	commandPathsMu.RLock()
+	if path, ok := commandPaths[command]; ok && path != "" {
+		command = path
+	}
+	commandPathsMu.RUnlock()
+	return exec.CommandContext(ctx, command, args...).CombinedOutput()
+}
+
+// reportsStatus reports whether a command line reports the state of Slurm
+// through its exit status, such as "scontrol ping" exiting with an error when
+// a controller is down. Its output is an answer even when it fails.
+func reportsStatus(command string, args []string) bool {
+	return command == "scontrol" && slices.Contains(args, "ping")
+}
+
+// Execute is a wrapper around the configured Runner to provide logging, a
+// timeout and retries, as set by the policy of the command. The output of a
+// failed command is returned with the error. Commands that report a status
+// are not retried once they printed something.
 var Execute = func(logger *logger.Logger, command string, args []string) ([]byte, error) {
+	policy := commandPolicy(command, args)
+	backoff := policy.Backoff
+	for attempt := 1; ; attempt++ {
+		out, err := executeOnce(logger, command, args, policy.Timeout)
+		if err == nil || attempt > policy.Retries || (len(out) > 0 && reportsStatus(command, args)) {
+			return out, err
+		}
+		logger.Warn("Retrying command", "command", command, "attempt", attempt, "backoff", backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// executeOn runs a Slurm command on the given cluster with -M, or on the
+// default cluster when cluster is empty. The "CLUSTER: <name>" header that
+// some commands print with -M is removed, so that the output parses as usual.
+func executeOn(logger *logger.Logger, cluster, command string, args []string) ([]byte, error) {
+	if cluster == "" {
+		return Execute(logger, command, args)
+	}
+	out, err := Execute(logger, command, append([]string{"-M", cluster}, args...))
+	if out == nil {
+		return nil, err
+	}
+	lines := strings.Split(string(out), "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "CLUSTER: ") {
+			kept = append(kept, line)
+		}
+	}
+	return []byte(strings.Join(kept, "\n")), err
+}
+
+// CommandExecutions returns the collector of the command execution counters,
+// registered once next to the Slurm collectors of every cluster.
+func CommandExecutions() prometheus.Collector {
+	return commandExecutions
+}
+
+// executeOnce runs a command once with the given timeout. The output of a
+// command that exits with an error is returned with the error.
+func executeOnce(logger *logger.Logger, command string, args []string, timeout time.Duration) ([]byte, error) {
 	logger.Debug("Executing command", "command", command, "args", strings.Join(args, " "))
 
-	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, command, args...)
-	out, err := cmd.CombinedOutput()
+	out, err := runner(ctx, command, args)
 	if err != nil {
 		// Check if the error is due to the context deadline exceeding.
 		if ctx.Err() == context.DeadlineExceeded {
-			logger.Error("Command timed out", "command", command, "args", strings.Join(args, " "), "timeout", commandTimeout)
+			commandExecutions.WithLabelValues(command, "timeout").Inc()
+			logger.Error("Command timed out", "command", command, "args", strings.Join(args, " "), "timeout", timeout)
 			return nil, ctx.Err()
 		}
+		commandExecutions.WithLabelValues(command, "error").Inc()
 		logger.Error("Failed to execute command", "command", command, "args", strings.Join(args, " "), "output", string(out), "err", err)
-		return nil, err
+		return out, err
 	}
 
+	commandExecutions.WithLabelValues(command, "success").Inc()
 	logger.Debug("Command executed successfully", "command", command)
 	return out, nil
 }
@@ -9,68 +9,160 @@ import (
 )
 
 /*
-FairShareData executes the sshare command to retrieve fairshare information.
-Expected sshare output format: "account,fairshare".
+FairShareData executes the sshare command to retrieve the whole association tree.
+Expected sshare output format: a header line followed by "Account|User|Partition|RawShares|NormShares|RawUsage|NormUsage|EffectvUsage|FairShare|LevelFS|...".
 */
-func FairShareData(logger *logger.Logger) ([]byte, error) {
-	return Execute(logger, "sshare", []string{"-n", "-P", "-o", "account,fairshare"})
+func FairShareData(logger *logger.Logger, cluster string) ([]byte, error) {
+	return executeOn(logger, cluster, "sshare", []string{"-a", "-l", "-m", "-P"})
 }
 
-type FairShareMetrics struct {
-	fairshare float64
+// ShareMetrics holds the values of one association of the sshare tree.
+// Values that sshare leaves empty, such as the FairShare of accounts with
+// the Fair Tree algorithm, are absent from the values map. Partition is
+// only set for the associations of a single partition. Depth is 0 for the
+// root account and grows by one per level of the account tree.
+type ShareMetrics struct {
+	Account   string
+	User      string
+	Partition string
+	Parent    string
+	Depth     int
+	values    map[string]float64
 }
 
+// shareColumns lists the sshare columns exported by the FairShareCollector.
+var shareColumns = []string{"RawShares", "NormShares", "RawUsage", "EffectvUsage", "FairShare", "LevelFS"}
+
 /*
-ParseFairShareMetrics parses the output of the sshare command for fairshare metrics.
-It expects input in the format: "account|fairshare".
+ParseShares parses the output of the sshare command.
+Columns are located by the header line, as "sshare -l" prints different columns
+across Slurm versions. Account names are indented by one space per level of the
+tree and user associations by one more than their account, which gives the parent
+of every association. A user has one row per partition association, told apart by
+the Partition column.
 */
-func ParseFairShareMetrics(logger *logger.Logger) (map[string]*FairShareMetrics, error) {
-	accounts := make(map[string]*FairShareMetrics)
-	fairShareData, err := FairShareData(logger)
-	if err != nil {
-		return nil, err
+func ParseShares(input []byte) []ShareMetrics {
+	lines := strings.Split(string(input), "\n")
+	if len(lines) == 0 {
+		return nil
+	}
+	columns := make(map[string]int)
+	for i, name := range strings.Split(lines[0], "|") {
+		columns[strings.TrimSpace(name)] = i
+	}
+	accountCol, ok := columns["Account"]
+	if !ok {
+		return nil
+	}
+	userCol, ok := columns["User"]
+	if !ok {
+		return nil
 	}
-	lines := strings.Split(string(fairShareData), "\n")
-	for _, line := range lines {
-		if !strings.HasPrefix(line, "  ") {
-			if strings.Contains(line, "|") {
-				account := strings.Trim(strings.Split(line, "|")[0], " ")
-				_, key := accounts[account]
-				if !key {
-					accounts[account] = &FairShareMetrics{0}
-				}
-				fairshare, _ := strconv.ParseFloat(strings.Split(line, "|")[1], 64)
-				accounts[account].fairshare = fairshare
+	partitionCol, hasPartition := columns["Partition"]
+
+	var shares []ShareMetrics
+	// path holds the account at each depth of the branch being read.
+	var path []string
+	for _, line := range lines[1:] {
+		fields := strings.Split(line, "|")
+		if len(fields) < len(columns) {
+			continue
+		}
+		account := strings.TrimSpace(fields[accountCol])
+		user := strings.TrimSpace(fields[userCol])
+		depth := len(fields[accountCol]) - len(strings.TrimLeft(fields[accountCol], " "))
+		if user != "" {
+			// User associations are listed one level below their account.
+			depth--
+		}
+		if depth < 0 || depth > len(path) {
+			continue
+		}
+		path = append(path[:depth], account)
+		parent := ""
+		if depth > 0 {
+			parent = path[depth-1]
+		}
+
+		share := ShareMetrics{Account: account, User: user, Parent: parent, Depth: depth, values: make(map[string]float64)}
+		if hasPartition {
+			share.Partition = strings.TrimSpace(fields[partitionCol])
+		}
+		for _, column := range shareColumns {
+			i, ok := columns[column]
+			if !ok {
+				continue
+			}
+			// RawShares is "parent" for accounts sharing their parent's shares.
+			value, err := strconv.ParseFloat(strings.TrimSpace(fields[i]), 64)
+			if err != nil {
+				continue
 			}
+			share.values[column] = value
 		}
+		shares = append(shares, share)
+	}
+	return shares
+}
+
+// accountFairShare returns the FairShare of an account, or its LevelFS when
+// sshare leaves the FairShare empty, as the Fair Tree algorithm does for
+// accounts.
+func accountFairShare(share ShareMetrics) float64 {
+	if value, ok := share.values["FairShare"]; ok {
+		return value
 	}
-	return accounts, nil
+	return share.values["LevelFS"]
 }
 
 type FairShareCollector struct {
 	fairshare *prometheus.Desc
+	shares    map[string]*prometheus.Desc
 	logger    *logger.Logger
 }
 
 func NewFairShareCollector(logger *logger.Logger) *FairShareCollector {
 	labels := []string{"account"}
+	shareLabels := []string{"account", "user", "partition", "parent"}
 	return &FairShareCollector{
 		fairshare: prometheus.NewDesc("slurm_account_fairshare", "FairShare for account", labels, nil),
-		logger:    logger,
+		shares: map[string]*prometheus.Desc{
+			"RawShares":    prometheus.NewDesc("slurm_share_raw_shares", "Shares assigned to the association", shareLabels, nil),
+			"NormShares":   prometheus.NewDesc("slurm_share_norm_shares", "Shares of the association normalized among its siblings", shareLabels, nil),
+			"RawUsage":     prometheus.NewDesc("slurm_share_raw_usage", "Decayed usage of the association, in TRES-seconds", shareLabels, nil),
+			"EffectvUsage": prometheus.NewDesc("slurm_share_effective_usage", "Usage of the association normalized among its siblings", shareLabels, nil),
+			"FairShare":    prometheus.NewDesc("slurm_share_fairshare", "FairShare factor of the association", shareLabels, nil),
+			"LevelFS":      prometheus.NewDesc("slurm_share_level_fs", "LevelFS of the association, its shares over its usage among its siblings", shareLabels, nil),
+		},
+		logger: logger,
 	}
 }
 
 func (fsc *FairShareCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- fsc.fairshare
+	for _, desc := range fsc.shares {
+		ch <- desc
+	}
 }
 
-func (fsc *FairShareCollector) Collect(ch chan<- prometheus.Metric) {
-	fsm, err := ParseFairShareMetrics(fsc.logger)
+func (fsc *FairShareCollector) Update(s *Snapshot, ch chan<- prometheus.Metric) error {
+	data, err := FairShareData(fsc.logger, s.Cluster())
 	if err != nil {
-		fsc.logger.Error("Failed to parse fairshare metrics", "err", err)
-		return
+		return err
 	}
-	for f := range fsm {
-		ch <- prometheus.MustNewConstMetric(fsc.fairshare, prometheus.GaugeValue, fsm[f].fairshare, f)
+	accounts := make(map[string]bool)
+	for _, share := range ParseShares(data) {
+		// slurm_account_fairshare keeps to the root and top-level accounts,
+		// the full tree being under the slurm_share_* metrics. Only the first
+		// row of an account is kept, as the account label alone does not tell
+		// partition associations apart.
+		if share.User == "" && share.Depth <= 1 && !accounts[share.Account] {
+			accounts[share.Account] = true
+			ch <- prometheus.MustNewConstMetric(fsc.fairshare, prometheus.GaugeValue, accountFairShare(share), share.Account)
+		}
+		for column, value := range share.values {
+			ch <- prometheus.MustNewConstMetric(fsc.shares[column], prometheus.GaugeValue, value, share.Account, share.User, share.Partition, share.Parent)
+		}
 	}
-}
\ No newline at end of file
+	return nil
+}
@@ -0,0 +1,100 @@
+package collector
+
+import (
+	"math"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseShares(t *testing.T) {
+	data, err := os.ReadFile("../../test_data/sshare.txt")
+	assert.NoError(t, err)
+
+	shares := ParseShares(data)
+	assert.Len(t, shares, 10)
+
+	byAssoc := make(map[string]ShareMetrics)
+	for _, s := range shares {
+		byAssoc[s.Account+"/"+s.User] = s
+	}
+
+	root := byAssoc["root/"]
+	assert.Equal(t, "", root.Parent)
+	assert.Equal(t, 0, root.Depth)
+	assert.Equal(t, 1500000.0, root.values["RawUsage"])
+	assert.NotContains(t, root.values, "RawShares")
+
+	physics := byAssoc["physics/"]
+	assert.Equal(t, "root", physics.Parent)
+	assert.Equal(t, 40.0, physics.values["RawShares"])
+	assert.Equal(t, 0.666667, physics.values["LevelFS"])
+	// Fair Tree leaves the FairShare of accounts empty.
+	assert.NotContains(t, physics.values, "FairShare")
+
+	alice := byAssoc["physics/alice"]
+	assert.Equal(t, "root", alice.Parent)
+	assert.Equal(t, 0.5, alice.values["NormShares"])
+	assert.Equal(t, 600000.0, alice.values["RawUsage"])
+	assert.Equal(t, 0.666667, alice.values["EffectvUsage"])
+	assert.Equal(t, 0.25, alice.values["FairShare"])
+	assert.Equal(t, 0.75, alice.values["LevelFS"])
+
+	// A user has one row per partition association.
+	var bob []string
+	for _, s := range shares {
+		if s.User == "bob" {
+			assert.Equal(t, "root", s.Parent)
+			bob = append(bob, s.Partition)
+		}
+	}
+	assert.Equal(t, []string{"batch", "gpu"}, bob)
+	assert.Equal(t, "", alice.Partition)
+
+	// Sub-accounts and their users hang below the parent account.
+	theory := byAssoc["theory/"]
+	assert.Equal(t, "physics", theory.Parent)
+	assert.Equal(t, 2, theory.Depth)
+	assert.NotContains(t, theory.values, "RawShares")
+	assert.True(t, math.IsInf(theory.values["LevelFS"], 1))
+	assert.Equal(t, "physics", byAssoc["theory/carol"].Parent)
+
+	// The tree goes back up after a deeper branch.
+	assert.Equal(t, "root", byAssoc["chemistry/"].Parent)
+	assert.Equal(t, "root", byAssoc["chemistry/dave"].Parent)
+}
+
+func TestFairShareCollector(t *testing.T) {
+	oldExecute := Execute
+	defer func() { Execute = oldExecute }()
+	Execute = func(logger *logger.Logger, command string, args []string) ([]byte, error) {
+		return os.ReadFile("../../test_data/sshare.txt")
+	}
+
+	fsc := NewFairShareCollector(logger.NewLogger("error"))
+	expected := `
+# HELP slurm_account_fairshare FairShare for account
+# TYPE slurm_account_fairshare gauge
+slurm_account_fairshare{account="chemistry"} 1.5
+slurm_account_fairshare{account="physics"} 0.666667
+slurm_account_fairshare{account="root"} 0
+# HELP slurm_share_raw_usage Decayed usage of the association, in TRES-seconds
+# TYPE slurm_share_raw_usage gauge
+slurm_share_raw_usage{account="chemistry",parent="root",partition="",user=""} 600000
+slurm_share_raw_usage{account="chemistry",parent="root",partition="",user="dave"} 600000
+slurm_share_raw_usage{account="physics",parent="root",partition="",user=""} 900000
+slurm_share_raw_usage{account="physics",parent="root",partition="",user="alice"} 600000
+slurm_share_raw_usage{account="physics",parent="root",partition="batch",user="bob"} 200000
+slurm_share_raw_usage{account="physics",parent="root",partition="gpu",user="bob"} 100000
+slurm_share_raw_usage{account="root",parent="",partition="",user=""} 1.5e+06
+slurm_share_raw_usage{account="root",parent="",partition="",user="root"} 0
+slurm_share_raw_usage{account="theory",parent="physics",partition="",user=""} 0
+slurm_share_raw_usage{account="theory",parent="physics",partition="",user="carol"} 0
+`
+	err := testutil.CollectAndCompare(updater{fsc}, strings.NewReader(expected), "slurm_account_fairshare", "slurm_share_raw_usage")
+	assert.NoError(t, err)
+}
@@ -13,219 +13,182 @@ import (
 type GPUsMetrics struct {
 	alloc       float64 // Number of allocated GPUs
 	idle        float64 // Number of idle GPUs
-	other       float64 // Number of GPUs in other states (mixed, down, etc.)
+	other       float64 // Number of GPUs of drained, down or not responding nodes
 	total       float64 // Total number of GPUs in the cluster
 	utilization float64 // GPU utilization ratio (allocated/total)
 }
 
-// GPUsGetMetrics retrieves and parses GPU metrics from Slurm
-func GPUsGetMetrics(logger *logger.Logger) (*GPUsMetrics, error) {
-	return ParseGPUsMetrics(logger)
-}
-
-// ParseAllocatedGPUs parses the output of sinfo command to count allocated GPUs
-// Expected input format examples:
-//   - slurm>=20.11.8: "3 gpu:2"
-//   - slurm 21.08.5:  "1 gpu:(null):3(IDX:0-7)"
-//   - slurm 21.08.5:  "13 gpu:A30:4(IDX:0-3),gpu:Q6K:4(IDX:0-3)"
-func ParseAllocatedGPUs(data []byte) float64 {
-	var numGPUs = 0.0
-	sinfoLines := string(data)
-	// Regex to match GPU specifications: gpu:type:count or gpu:count
-	re := regexp.MustCompile(`gpu:(\(null\)|[^:(]*):?([0-9]+)(\([^)]*\))?`)
-	if len(sinfoLines) > 0 {
-		for _, line := range strings.Split(sinfoLines, "\n") {
-			if len(line) > 0 && strings.Contains(line, "gpu:") {
-				fields := strings.Fields(line)
-				if len(fields) < 2 {
-					continue
-				}
-
-				numNodes, _ := strconv.ParseFloat(fields[0], 64)
-				nodeActiveGPUs := fields[1]
-				numNodeActiveGPUs := 0.0
-
-				// Parse GPU specifications separated by commas
-				for _, gpuSpec := range strings.Split(nodeActiveGPUs, ",") {
-					if strings.Contains(gpuSpec, "gpu:") {
-						matches := re.FindStringSubmatch(gpuSpec)
-						if len(matches) > 2 {
-							gpuCount, _ := strconv.ParseFloat(matches[2], 64)
-							numNodeActiveGPUs += gpuCount
-						}
-					}
-				}
-				numGPUs += numNodes * numNodeActiveGPUs
-			}
-		}
-	}
-
-	return numGPUs
-}
+// gpuSpecRegex matches a GPU of a GRES specification, capturing its type
+// and count.
+var gpuSpecRegex = regexp.MustCompile(`gpu:(\(null\)|[^:(]*):?([0-9]+)(\([^)]*\))?`)
 
-// ParseIdleGPUs calculates idle GPUs by subtracting allocated from total GPUs
-// Expected input format examples:
-//   - slurm 20.11.8:  "3 gpu:4 gpu:2" (total available, allocated)
-//   - slurm 21.08.5:  "1 gpu:8(S:0-1) gpu:(null):3(IDX:0-7)"
-//   - slurm 21.08.5:  "13 gpu:A30:4(S:0-1),gpu:Q6K:40(S:0-1) gpu:A30:4(IDX:0-3),gpu:Q6K:4(IDX:0-3)"
-func ParseIdleGPUs(data []byte) float64 {
-	var numGPUs = 0.0
-	sinfoLines := string(data)
-	re := regexp.MustCompile(`gpu:(\(null\)|[^:(]*):?([0-9]+)(\([^)]*\))?`)
-	if len(sinfoLines) > 0 {
-		for _, line := range strings.Split(sinfoLines, "\n") {
-			if len(line) > 0 && strings.Contains(line, "gpu:") {
-				fields := strings.Fields(line)
-				if len(fields) < 1 {
-					continue
-				}
-
-				numNodes, _ := strconv.ParseFloat(fields[0], 64)
-
-				switch len(fields) {
-				case 1:
-					// Only node count, no GPU info - assume no idle GPUs
-					numGPUs += 0
-				case 2:
-					// Two columns: nodes and total GPUs (no allocated info)
-					totalGPUs := parseGPUCount(fields[1], re)
-					numGPUs += numNodes * totalGPUs
-				default:
-					// Three or more columns: nodes, total GPUs, allocated GPUs
-					totalGPUs := parseGPUCount(fields[1], re)
-					allocatedGPUs := parseGPUCount(fields[2], re)
-					idleGPUs := totalGPUs - allocatedGPUs
-					numGPUs += numNodes * idleGPUs
-				}
-			}
-		}
-	}
-
-	return numGPUs
-}
-
-// parseGPUCount extracts the total GPU count from a GPU specification string
-func parseGPUCount(gpuSpec string, re *regexp.Regexp) float64 {
-	var count = 0.0
+// parseGPUTypes extracts the GPU count per GPU type from a GPU specification
+// string. Untyped GPUs have an empty type.
+func parseGPUTypes(gpuSpec string) map[string]float64 {
+	counts := make(map[string]float64)
 	for _, spec := range strings.Split(gpuSpec, ",") {
 		if strings.Contains(spec, "gpu:") {
-			matches := re.FindStringSubmatch(spec)
+			matches := gpuSpecRegex.FindStringSubmatch(spec)
 			if len(matches) > 2 {
+				gpuType := matches[1]
+				if gpuType == "(null)" {
+					gpuType = ""
+				}
 				gpuCount, _ := strconv.ParseFloat(matches[2], 64)
-				count += gpuCount
+				counts[gpuType] += gpuCount
 			}
 		}
 	}
-	return count
+	return counts
 }
 
-// ParseTotalGPUs parses the output of sinfo command to count total available GPUs
-// Expected input format examples:
-//   - slurm 20.11.8:  "3 gpu:4"
-//   - slurm 21.08.5:  "1 gpu:8(S:0-1)"
-//   - slurm 21.08.5:  "13 gpu:A30:4(S:0-1),gpu:Q6K:40(S:0-1)"
-func ParseTotalGPUs(data []byte) float64 {
-	var numGPUs = 0.0
-	sinfoLines := string(data)
-	re := regexp.MustCompile(`gpu:(\(null\)|[^:(]*):?([0-9]+)(\([^)]*\))?`)
-
-	if len(sinfoLines) > 0 {
-		for _, line := range strings.Split(sinfoLines, "\n") {
-			if len(line) > 0 && strings.Contains(line, "gpu:") {
-				fields := strings.Fields(line)
-				if len(fields) < 2 {
-					continue
-				}
-
-				numNodes, _ := strconv.ParseFloat(fields[0], 64)
-				nodeGPUs := parseGPUCount(fields[1], re)
-				numGPUs += numNodes * nodeGPUs
+// jobGPUTypes returns the GPUs of a job per GPU type. Typed TRES such as
+// gres/gpu:a100 are only tracked when listed in AccountingStorageTRES; the
+// remaining GPUs get the type requested per node, if there is a single one.
+func jobGPUTypes(job Job) map[string]float64 {
+	gpus := make(map[string]float64)
+	typed := 0.0
+	for tres, count := range job.TRES {
+		if gpuType, found := strings.CutPrefix(tres, "gres/gpu:"); found {
+			gpus[gpuType] += count
+			typed += count
+		}
+	}
+	if untyped := job.TRES["gres/gpu"] - typed; untyped > 0 {
+		gpuType := ""
+		if requested := parseGPUTypes(job.TRESPerNode); len(requested) == 1 {
+			for t := range requested {
+				gpuType = t
 			}
 		}
+		gpus[gpuType] += untyped
 	}
-
-	return numGPUs
+	return gpus
 }
 
-// ParseGPUsMetrics collects and parses all GPU metrics from Slurm
-func ParseGPUsMetrics(logger *logger.Logger) (*GPUsMetrics, error) {
-	var gm GPUsMetrics
+// gpuSchedulableStates are the base states of the nodes whose GPUs are
+// allocated or idle, as long as they are not drained or not responding.
+var gpuSchedulableStates = []string{"alloc", "mix", "idle", "comp"}
 
-	// Get total GPU count
-	totalGPUsData, err := TotalGPUsData(logger)
-	if err != nil {
-		return nil, err
-	}
-	totalGPUs := ParseTotalGPUs(totalGPUsData)
-
-	// Get allocated GPU count
-	allocatedGPUsData, err := AllocatedGPUsData(logger)
-	if err != nil {
-		return nil, err
+// gpuSchedulable reports whether the GPUs of a node in state can run jobs.
+func gpuSchedulable(state string) bool {
+	base, flags := ParseNodeState(state)
+	for _, flag := range flags {
+		if strings.HasPrefix(flag, "drain") || flag == "not_responding" {
+			return false
+		}
 	}
-	allocatedGPUs := ParseAllocatedGPUs(allocatedGPUsData)
-
-	// Get idle GPU count
-	idleGPUsData, err := IdleGPUsData(logger)
-	if err != nil {
-		return nil, err
+	for _, prefix := range gpuSchedulableStates {
+		if strings.HasPrefix(base, prefix) {
+			return true
+		}
 	}
-	idleGPUs := ParseIdleGPUs(idleGPUsData)
-
-	// Calculate other GPUs (mixed, down, etc.)
-	otherGPUs := totalGPUs - allocatedGPUs - idleGPUs
-
-	gm.alloc = allocatedGPUs
-	gm.idle = idleGPUs
-	gm.other = otherGPUs
-	gm.total = totalGPUs
+	return false
+}
 
-	// Calculate utilization ratio
-	if totalGPUs > 0 {
-		gm.utilization = allocatedGPUs / totalGPUs
+// addNodeGPUs adds the GPUs of a node to the metrics of their GPU type.
+// The GPUs of allocated, mixed, idle and completing nodes are allocated when
+// in use and idle otherwise. GPUs of drained, down or not responding nodes
+// are neither allocated nor idle.
+func addNodeGPUs(metrics map[string]*GPUsMetrics, node NodeRecord) {
+	used := parseGPUTypes(node.GresUsed)
+	schedulable := gpuSchedulable(node.State)
+	for gpuType, nodeGPUs := range parseGPUTypes(node.Gres) {
+		gm, ok := metrics[gpuType]
+		if !ok {
+			gm = &GPUsMetrics{}
+			metrics[gpuType] = gm
+		}
+		gm.total += nodeGPUs
+		if schedulable {
+			gm.alloc += used[gpuType]
+			gm.idle += nodeGPUs - used[gpuType]
+		}
 	}
-
-	return &gm, nil
 }
 
-// AllocatedGPUsData executes sinfo command to get allocated GPU information
-func AllocatedGPUsData(logger *logger.Logger) ([]byte, error) {
-	args := []string{"-a", "-h", "--Format=Nodes: ,GresUsed:", "--state=allocated"}
-	return Execute(logger, "sinfo", args)
+// completeGPUsMetrics computes the other GPUs and the utilization ratio of
+// every GPU type.
+func completeGPUsMetrics(metrics map[string]*GPUsMetrics) {
+	for _, gm := range metrics {
+		gm.other = gm.total - gm.alloc - gm.idle
+		if gm.total > 0 {
+			gm.utilization = gm.alloc / gm.total
+		}
+	}
 }
 
-// IdleGPUsData executes sinfo command to get idle and allocated GPU information
-func IdleGPUsData(logger *logger.Logger) ([]byte, error) {
-	args := []string{"-a", "-h", "--Format=Nodes: ,Gres: ,GresUsed:", "--state=idle,allocated"}
-	return Execute(logger, "sinfo", args)
+// ParseGPUsMetrics computes the GPU metrics per GPU type from the Gres and
+// GresUsed columns of the sinfo snapshot, counting every node once.
+// Expected Gres/GresUsed formats:
+//   - slurm 20.11.8:  "gpu:4" and "gpu:2"
+//   - slurm 21.08.5:  "gpu:8(S:0-1)" and "gpu:(null):3(IDX:0-7)"
+//   - slurm 21.08.5:  "gpu:A30:4(S:0-1),gpu:Q6K:40(S:0-1)" and "gpu:A30:4(IDX:0-3),gpu:Q6K:4(IDX:0-3)"
+func ParseGPUsMetrics(nodes []NodeRecord) map[string]*GPUsMetrics {
+	metrics := make(map[string]*GPUsMetrics)
+	for _, node := range uniqueNodes(nodes) {
+		addNodeGPUs(metrics, node)
+	}
+	completeGPUsMetrics(metrics)
+	return metrics
 }
 
-// TotalGPUsData executes sinfo command to get total GPU information
-func TotalGPUsData(logger *logger.Logger) ([]byte, error) {
-	args := []string{"-a", "-h", "--Format=Nodes: ,Gres:"}
-	return Execute(logger, "sinfo", args)
+// ParsePartitionGPUsMetrics computes the GPU metrics per partition and GPU
+// type. Nodes in several partitions are counted in each of them.
+func ParsePartitionGPUsMetrics(records []NodeRecord) map[string]map[string]*GPUsMetrics {
+	partitions := make(map[string]map[string]*GPUsMetrics)
+	for _, record := range records {
+		if partitions[record.Partition] == nil {
+			partitions[record.Partition] = make(map[string]*GPUsMetrics)
+		}
+		addNodeGPUs(partitions[record.Partition], record)
+	}
+	for _, metrics := range partitions {
+		completeGPUsMetrics(metrics)
+	}
+	return partitions
 }
 
-// NewGPUsCollector creates a new GPU metrics collector
-func NewGPUsCollector(logger *logger.Logger) *GPUsCollector {
+// NewGPUsCollector creates a new GPU metrics collector. perNode and
+// perPartition enable the per-node and per-partition breakdowns.
+func NewGPUsCollector(logger *logger.Logger, perNode, perPartition bool) *GPUsCollector {
+	labels := []string{"gpu_type"}
+	partitionLabels := []string{"partition", "gpu_type"}
+	nodeLabels := []string{"node", "gpu_type"}
 	return &GPUsCollector{
-		alloc:       prometheus.NewDesc("slurm_gpus_alloc", "Allocated GPUs", nil, nil),
-		idle:        prometheus.NewDesc("slurm_gpus_idle", "Idle GPUs", nil, nil),
-		other:       prometheus.NewDesc("slurm_gpus_other", "Other GPUs", nil, nil),
-		total:       prometheus.NewDesc("slurm_gpus_total", "Total GPUs", nil, nil),
-		utilization: prometheus.NewDesc("slurm_gpus_utilization", "Total GPU utilization", nil, nil),
-		logger:      logger,
+		alloc:          prometheus.NewDesc("slurm_gpus_alloc", "Allocated GPUs", labels, nil),
+		idle:           prometheus.NewDesc("slurm_gpus_idle", "Idle GPUs", labels, nil),
+		other:          prometheus.NewDesc("slurm_gpus_other", "Other GPUs", labels, nil),
+		total:          prometheus.NewDesc("slurm_gpus_total", "Total GPUs", labels, nil),
+		utilization:    prometheus.NewDesc("slurm_gpus_utilization", "Total GPU utilization", labels, nil),
+		partitionAlloc: prometheus.NewDesc("slurm_partition_gpus_alloc", "Allocated GPUs for partition", partitionLabels, nil),
+		partitionIdle:  prometheus.NewDesc("slurm_partition_gpus_idle", "Idle GPUs for partition", partitionLabels, nil),
+		partitionOther: prometheus.NewDesc("slurm_partition_gpus_other", "Other GPUs for partition", partitionLabels, nil),
+		partitionTotal: prometheus.NewDesc("slurm_partition_gpus_total", "Total GPUs for partition", partitionLabels, nil),
+		nodeTotal:      prometheus.NewDesc("slurm_node_gpus_total", "Total GPUs per node", nodeLabels, nil),
+		nodeUsed:       prometheus.NewDesc("slurm_node_gpus_used", "GPUs in use by jobs per node", nodeLabels, nil),
+		perNode:        perNode,
+		perPartition:   perPartition,
+		logger:         logger,
 	}
 }
 
 // GPUsCollector implements the Prometheus Collector interface for GPU metrics
 type GPUsCollector struct {
-	alloc       *prometheus.Desc
-	idle        *prometheus.Desc
-	other       *prometheus.Desc
-	total       *prometheus.Desc
-	utilization *prometheus.Desc
-	logger      *logger.Logger
+	alloc          *prometheus.Desc
+	idle           *prometheus.Desc
+	other          *prometheus.Desc
+	total          *prometheus.Desc
+	utilization    *prometheus.Desc
+	partitionAlloc *prometheus.Desc
+	partitionIdle  *prometheus.Desc
+	partitionOther *prometheus.Desc
+	partitionTotal *prometheus.Desc
+	nodeTotal      *prometheus.Desc
+	nodeUsed       *prometheus.Desc
+	perNode        bool
+	perPartition   bool
+	logger         *logger.Logger
 }
 
 // Describe sends the descriptors of each metric over to the provided channel
@@ -235,19 +198,47 @@ func (cc *GPUsCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- cc.other
 	ch <- cc.total
 	ch <- cc.utilization
+	ch <- cc.partitionAlloc
+	ch <- cc.partitionIdle
+	ch <- cc.partitionOther
+	ch <- cc.partitionTotal
+	ch <- cc.nodeTotal
+	ch <- cc.nodeUsed
 }
 
-// Collect fetches the GPU metrics from Slurm and sends them to Prometheus
-func (cc *GPUsCollector) Collect(ch chan<- prometheus.Metric) {
-	metrics, err := GPUsGetMetrics(cc.logger)
+// Update computes the GPU metrics from the sinfo snapshot and sends them to Prometheus
+func (cc *GPUsCollector) Update(s *Snapshot, ch chan<- prometheus.Metric) error {
+	nodes, err := s.Nodes()
 	if err != nil {
-		cc.logger.Error("Failed to get GPU metrics", "err", err)
-		return
+		return err
+	}
+	for gpuType, metrics := range ParseGPUsMetrics(nodes) {
+		ch <- prometheus.MustNewConstMetric(cc.alloc, prometheus.GaugeValue, metrics.alloc, gpuType)
+		ch <- prometheus.MustNewConstMetric(cc.idle, prometheus.GaugeValue, metrics.idle, gpuType)
+		ch <- prometheus.MustNewConstMetric(cc.other, prometheus.GaugeValue, metrics.other, gpuType)
+		ch <- prometheus.MustNewConstMetric(cc.total, prometheus.GaugeValue, metrics.total, gpuType)
+		ch <- prometheus.MustNewConstMetric(cc.utilization, prometheus.GaugeValue, metrics.utilization, gpuType)
 	}
 
-	ch <- prometheus.MustNewConstMetric(cc.alloc, prometheus.GaugeValue, metrics.alloc)
-	ch <- prometheus.MustNewConstMetric(cc.idle, prometheus.GaugeValue, metrics.idle)
-	ch <- prometheus.MustNewConstMetric(cc.other, prometheus.GaugeValue, metrics.other)
-	ch <- prometheus.MustNewConstMetric(cc.total, prometheus.GaugeValue, metrics.total)
-	ch <- prometheus.MustNewConstMetric(cc.utilization, prometheus.GaugeValue, metrics.utilization)
+	if cc.perPartition {
+		for partition, types := range ParsePartitionGPUsMetrics(nodes) {
+			for gpuType, metrics := range types {
+				ch <- prometheus.MustNewConstMetric(cc.partitionAlloc, prometheus.GaugeValue, metrics.alloc, partition, gpuType)
+				ch <- prometheus.MustNewConstMetric(cc.partitionIdle, prometheus.GaugeValue, metrics.idle, partition, gpuType)
+				ch <- prometheus.MustNewConstMetric(cc.partitionOther, prometheus.GaugeValue, metrics.other, partition, gpuType)
+				ch <- prometheus.MustNewConstMetric(cc.partitionTotal, prometheus.GaugeValue, metrics.total, partition, gpuType)
+			}
+		}
+	}
+
+	if cc.perNode {
+		for _, node := range uniqueNodes(nodes) {
+			used := parseGPUTypes(node.GresUsed)
+			for gpuType, total := range parseGPUTypes(node.Gres) {
+				ch <- prometheus.MustNewConstMetric(cc.nodeTotal, prometheus.GaugeValue, total, node.Name, gpuType)
+				ch <- prometheus.MustNewConstMetric(cc.nodeUsed, prometheus.GaugeValue, used[gpuType], node.Name, gpuType)
+			}
+		}
+	}
+	return nil
 }
@@ -16,80 +16,122 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>. */
 package collector
 
 import (
-	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/sckyzo/slurm_exporter/internal/logger"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestGPUsMetrics(t *testing.T) {
-	test_data_paths, _ := filepath.Glob("../test_data/slurm-*")
-	for _, test_data_path := range test_data_paths {
-		slurm_version := strings.TrimPrefix(test_data_path, "../test_data/slurm-")
-		t.Logf("slurm-%s", slurm_version)
-
-		// Read the input data from a file
-		file, err := os.Open(test_data_path + "/sinfo_gpus_allocated.txt")
-		if err != nil {
-			t.Fatalf("Can not open test data: %v", err)
-		}
-		data, _ := io.ReadAll(file)
-		metrics := ParseAllocatedGPUs(data)
-		t.Logf("Allocated: %+v", metrics)
-
-		// Read the input data from a file
-		file, err = os.Open(test_data_path + "/sinfo_gpus_idle.txt")
-		if err != nil {
-			t.Fatalf("Can not open test data: %v", err)
-		}
-		data, _ = io.ReadAll(file)
-		metrics = ParseIdleGPUs(data)
-		t.Logf("Idle: %+v", metrics)
-
-		// Read the input data from a file
-		file, err = os.Open(test_data_path + "/sinfo_gpus_total.txt")
-		if err != nil {
-			t.Fatalf("Can not open test data: %v", err)
-		}
-		data, _ = io.ReadAll(file)
-		metrics = ParseTotalGPUs(data)
-		t.Logf("Total: %+v", metrics)
+	expected := map[string]map[string]*GPUsMetrics{
+		"20.11.8": {
+			"": {alloc: 4, idle: 4, other: 0, total: 8, utilization: 4.0 / 8},
+		},
+		"21.08.5": {
+			"": {alloc: 8, idle: 16, other: 0, total: 24, utilization: 8.0 / 24},
+		},
+		"23.11.10": {
+			"h100": {alloc: 7, idle: 5, other: 8, total: 20, utilization: 7.0 / 20},
+		},
+		"23.11.10-2": {
+			"rtxa5000": {alloc: 0, idle: 1, other: 0, total: 1, utilization: 0},
+			"h100":     {alloc: 1, idle: 0, other: 0, total: 1, utilization: 1},
+			"mi210":    {alloc: 3, idle: 1, other: 0, total: 4, utilization: 3.0 / 4},
+		},
 	}
-}
-
-func TestGPUsGetMetrics(t *testing.T) {
-	oldExecute := Execute
-	defer func() { Execute = oldExecute }()
-
 	test_data_paths, _ := filepath.Glob("../../test_data/slurm-*")
 	for _, test_data_path := range test_data_paths {
-		slurm_version := strings.TrimPrefix(test_data_path, "../test_data/slurm-")
+		slurm_version := strings.TrimPrefix(test_data_path, "../../test_data/slurm-")
 		t.Run(slurm_version, func(t *testing.T) {
-			Execute = func(logger *logger.Logger, command string, args []string) ([]byte, error) {
-				var file string
-				if strings.Contains(args[2], "GresUsed:") && strings.Contains(args[2], "Gres:") {
-					file = filepath.Join(test_data_path, "sinfo_gpus_idle.txt")
-				} else if strings.Contains(args[2], "GresUsed:") {
-					file = filepath.Join(test_data_path, "sinfo_gpus_allocated.txt")
-				} else if strings.Contains(args[2], "Gres:") {
-					file = filepath.Join(test_data_path, "sinfo_gpus_total.txt")
-				}
-				data, err := os.ReadFile(file)
-				if err != nil {
-					return nil, err
-				}
-				return data, nil
-			}
-
-			testLogger := logger.NewLogger("debug")
-			metrics, err := GPUsGetMetrics(testLogger)
+			data, err := os.ReadFile(filepath.Join(test_data_path, "sinfo_gpus.txt"))
 			if err != nil {
-				t.Fatalf("GPUsGetMetrics() error: %v", err)
+				t.Fatalf("Can not open test data: %v", err)
 			}
+			metrics := ParseGPUsMetrics(ParseNodeRecords(data))
 			t.Logf("slurm-%s: %+v", slurm_version, metrics)
+			assert.Equal(t, expected[slurm_version], metrics)
 		})
 	}
 }
+
+func TestParseGPUTypes(t *testing.T) {
+	assert.Equal(t, map[string]float64{"": 4}, parseGPUTypes("gpu:4"))
+	assert.Equal(t, map[string]float64{"": 3}, parseGPUTypes("gpu:(null):3(IDX:0-7)"))
+	assert.Equal(t, map[string]float64{"A30": 4, "Q6K": 40}, parseGPUTypes("gpu:A30:4(S:0-1),gpu:Q6K:40(S:0-1)"))
+	assert.Equal(t, map[string]float64{"h100": 1}, parseGPUTypes("gpu:h100:1,shard:h100:10"))
+	assert.Empty(t, parseGPUTypes("(null)"))
+}
+
+func TestParsePartitionGPUsMetrics(t *testing.T) {
+	data, err := os.ReadFile("../../test_data/slurm-23.11.10/sinfo_gpus.txt")
+	assert.NoError(t, err)
+
+	// gpu001 is in both partitions and counts in each of them. The GPUs of
+	// the mixed gpu002 are allocated or idle, those of the down gpu004 and
+	// the draining gpu005 are other.
+	partitions := ParsePartitionGPUsMetrics(ParseNodeRecords(data))
+	assert.Len(t, partitions, 2)
+	assert.Equal(t, &GPUsMetrics{alloc: 7, idle: 5, other: 8, total: 20, utilization: 7.0 / 20}, partitions["gpu"]["h100"])
+	assert.Equal(t, &GPUsMetrics{alloc: 4, idle: 0, other: 0, total: 4, utilization: 1}, partitions["all"]["h100"])
+}
+
+func TestGPUsCollectorUpdate(t *testing.T) {
+	oldExecute := Execute
+	defer func() { Execute = oldExecute }()
+
+	Execute = func(logger *logger.Logger, command string, args []string) ([]byte, error) {
+		return os.ReadFile("../../test_data/slurm-23.11.10/sinfo_gpus.txt")
+	}
+
+	testLogger := logger.NewLogger("debug")
+	ch := make(chan prometheus.Metric, 10)
+	err := NewGPUsCollector(testLogger, false, false).Update(NewSnapshot(testLogger), ch)
+	close(ch)
+	assert.NoError(t, err)
+	assert.Len(t, ch, 5)
+}
+
+func TestGPUsCollectorBreakdowns(t *testing.T) {
+	oldExecute := Execute
+	defer func() { Execute = oldExecute }()
+
+	Execute = func(logger *logger.Logger, command string, args []string) ([]byte, error) {
+		return os.ReadFile("../../test_data/slurm-23.11.10-2/sinfo_gpus.txt")
+	}
+
+	gc := NewGPUsCollector(logger.NewLogger("error"), true, true)
+	assert.Equal(t, 3, testutil.CollectAndCount(updater{gc}, "slurm_gpus_total"))
+	assert.Equal(t, 3, testutil.CollectAndCount(updater{gc}, "slurm_partition_gpus_total"))
+	// The CPU node c01 has no GPUs.
+	assert.Equal(t, 4, testutil.CollectAndCount(updater{gc}, "slurm_node_gpus_used"))
+
+	expected := `
+# HELP slurm_node_gpus_total Total GPUs per node
+# TYPE slurm_node_gpus_total gauge
+slurm_node_gpus_total{gpu_type="h100",node="h01"} 1
+slurm_node_gpus_total{gpu_type="mi210",node="m01"} 2
+slurm_node_gpus_total{gpu_type="mi210",node="m02"} 2
+slurm_node_gpus_total{gpu_type="rtxa5000",node="r01"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(updater{gc}, strings.NewReader(expected), "slurm_node_gpus_total"))
+
+	// The GPUs of the mixed m02 are allocated or idle.
+	expected = `
+# HELP slurm_partition_gpus_alloc Allocated GPUs for partition
+# TYPE slurm_partition_gpus_alloc gauge
+slurm_partition_gpus_alloc{gpu_type="h100",partition="gpu"} 1
+slurm_partition_gpus_alloc{gpu_type="mi210",partition="gpu"} 3
+slurm_partition_gpus_alloc{gpu_type="rtxa5000",partition="gpu"} 0
+# HELP slurm_partition_gpus_idle Idle GPUs for partition
+# TYPE slurm_partition_gpus_idle gauge
+slurm_partition_gpus_idle{gpu_type="h100",partition="gpu"} 0
+slurm_partition_gpus_idle{gpu_type="mi210",partition="gpu"} 1
+slurm_partition_gpus_idle{gpu_type="rtxa5000",partition="gpu"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(updater{gc}, strings.NewReader(expected), "slurm_partition_gpus_alloc", "slurm_partition_gpus_idle"))
+}
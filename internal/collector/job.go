@@ -1,9 +1,6 @@
 package collector
 
 import (
-	"strconv"
-	"strings"
-
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sckyzo/slurm_exporter/internal/logger"
 )
@@ -18,57 +15,28 @@ type JobMetrics struct {
 	partitions []string
 }
 
-func JobGetMetrics(logger *logger.Logger) (map[string]*JobMetrics, error) {
-	data, err := JobData(logger)
-	if err != nil {
-		return nil, err
-	}
-	return ParseJobMetrics(data), nil
-}
-
-// ParseJobMetrics takes the output of squeue with job data
+// ParseJobMetrics takes the jobs of the squeue snapshot
 // It returns a map of metrics per job, including partitions
-// Expects squeue output format: "%P,%T,%C,%i,%j,%r,%u" (Partition,State,CPUs,ID,Name,Reason,User)
-func ParseJobMetrics(input []byte) map[string]*JobMetrics {
+func ParseJobMetrics(input []Job) map[string]*JobMetrics {
 	jobs := make(map[string]*JobMetrics)
-	lines := strings.Split(string(input), "\n")
-	for _, line := range lines {
-		if strings.Contains(line, "|") {
-			part := strings.Split(line, "|")[0]
-			part = strings.TrimSpace(part)
-			state := strings.Split(line, "|")[1]
-			cores, _ := strconv.Atoi(strings.Split(line, "|")[2])
-			id := strings.Split(line, "|")[3]
-			name := strings.Split(line, "|")[4]
-			reason := strings.Split(line, "|")[5]
-			user := strings.Split(line, "|")[6]
-			user = strings.TrimSpace(user)
-
-			if _, exists := jobs[id]; !exists {
-				jobs[id] = &JobMetrics{uint64(cores), name, state, reason, user, []string{part}}
-			}
-			jobs[id].jobCPUs = uint64(cores)
-			jobs[id].jobName = name
-			jobs[id].jobStatus = state
-			jobs[id].jobReason = reason
-			jobs[id].user = user
-
-			// Add the partition if it's not already in the list
-			jobs[id].partitions = appendUnique(jobs[id].partitions, part)
+	for _, job := range input {
+		id := job.JobID
+		if _, exists := jobs[id]; !exists {
+			jobs[id] = &JobMetrics{uint64(job.CPUs), job.Name, job.State, job.Reason, job.User, []string{job.Partition}}
 		}
+		jobs[id].jobCPUs = uint64(job.CPUs)
+		jobs[id].jobName = job.Name
+		jobs[id].jobStatus = job.State
+		jobs[id].jobReason = job.Reason
+		jobs[id].user = job.User
+
+		// Add the partition if it's not already in the list
+		jobs[id].partitions = appendUnique(jobs[id].partitions, job.Partition)
 	}
 
 	return jobs
 }
 
-/*
-JobData executes the squeue command to retrieve job information
-Expected squeue output format: "%P,%T,%C,%i,%j,%r,%u" (Partition,State,CPUs,ID,Name,Reason,User).
-*/
-func JobData(logger *logger.Logger) ([]byte, error) {
-	return Execute(logger, "squeue", []string{"-h", "-o", "%P|%T|%C|%i|%j|%r|%u"})
-}
-
 /*
  * Implement the Prometheus Collector interface and feed the
  * Slurm job metrics into it.
@@ -94,16 +62,19 @@ func (jc *JobCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- jc.jobStatus
 }
 
-func (jc *JobCollector) Collect(ch chan<- prometheus.Metric) {
-	jobs, err := JobGetMetrics(jc.logger)
+func (jc *JobCollector) Update(s *Snapshot, ch chan<- prometheus.Metric) error {
+	snapshotJobs, err := s.Jobs()
 	if err != nil {
-		jc.logger.Error("Failed to get job metrics", "err", err)
-		return
+		return err
 	}
+	// Pending array tasks share one series, as they did before the
+	// snapshot expanded them.
+	jobs := ParseJobMetrics(collapseArrays(snapshotJobs))
 	for job_id, metrics := range jobs {
 		for _, partition := range metrics.partitions {
 			ch <- prometheus.MustNewConstMetric(jc.jobCPUs, prometheus.GaugeValue, float64(metrics.jobCPUs), job_id, metrics.jobName, metrics.jobStatus, metrics.jobReason, partition, metrics.user)
 			ch <- prometheus.MustNewConstMetric(jc.jobStatus, prometheus.GaugeValue, 1, job_id, metrics.jobName, metrics.jobStatus, metrics.jobReason, partition, metrics.user)
 		}
 	}
+	return nil
 }
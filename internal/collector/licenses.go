@@ -0,0 +1,135 @@
+package collector
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// LicenseInfo holds information about a single license.
+type LicenseInfo struct {
+	Name     string
+	Total    float64
+	Used     float64
+	Free     float64
+	Reserved float64
+	Remote   bool
+	// LastConsumed and LastDeficit are only printed by Slurm 23.02 and
+	// later, HasLastConsumed tells whether they were.
+	LastConsumed    float64
+	LastDeficit     float64
+	HasLastConsumed bool
+}
+
+// LicensesCollector collects metrics about Slurm licenses.
+type LicensesCollector struct {
+	logger       *logger.Logger
+	total        *prometheus.Desc
+	used         *prometheus.Desc
+	free         *prometheus.Desc
+	reserved     *prometheus.Desc
+	remote       *prometheus.Desc
+	lastConsumed *prometheus.Desc
+	lastDeficit  *prometheus.Desc
+}
+
+func NewLicensesCollector(logger *logger.Logger) *LicensesCollector {
+	labels := []string{"license"}
+	return &LicensesCollector{
+		logger:       logger,
+		total:        prometheus.NewDesc("slurm_license_total", "Total number of licenses", labels, nil),
+		used:         prometheus.NewDesc("slurm_license_used", "Number of licenses in use by jobs", labels, nil),
+		free:         prometheus.NewDesc("slurm_license_free", "Number of licenses available to jobs", labels, nil),
+		reserved:     prometheus.NewDesc("slurm_license_reserved", "Number of licenses held by reservations", labels, nil),
+		remote:       prometheus.NewDesc("slurm_license_remote", "Whether the license is served by slurmdbd (1) or local to the cluster (0)", labels, nil),
+		lastConsumed: prometheus.NewDesc("slurm_license_last_consumed", "Number of licenses consumed on the license server at the last update", labels, nil),
+		lastDeficit:  prometheus.NewDesc("slurm_license_last_deficit", "Number of licenses consumed outside of Slurm that could not be subtracted from the free count at the last update", labels, nil),
+	}
+}
+
+// Describe sends the super-set of all possible descriptors of metrics
+// collected by this Collector to the provided channel.
+func (c *LicensesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.total
+	ch <- c.used
+	ch <- c.free
+	ch <- c.reserved
+	ch <- c.remote
+	ch <- c.lastConsumed
+	ch <- c.lastDeficit
+}
+
+// Update is called by the SlurmCollector when collecting metrics.
+func (c *LicensesCollector) Update(s *Snapshot, ch chan<- prometheus.Metric) error {
+	data, err := c.licensesData(s.Cluster())
+	if err != nil {
+		return err
+	}
+
+	for _, lic := range parseLicenses(data) {
+		remote := 0.0
+		if lic.Remote {
+			remote = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.total, prometheus.GaugeValue, lic.Total, lic.Name)
+		ch <- prometheus.MustNewConstMetric(c.used, prometheus.GaugeValue, lic.Used, lic.Name)
+		ch <- prometheus.MustNewConstMetric(c.free, prometheus.GaugeValue, lic.Free, lic.Name)
+		ch <- prometheus.MustNewConstMetric(c.reserved, prometheus.GaugeValue, lic.Reserved, lic.Name)
+		ch <- prometheus.MustNewConstMetric(c.remote, prometheus.GaugeValue, remote, lic.Name)
+		if lic.HasLastConsumed {
+			ch <- prometheus.MustNewConstMetric(c.lastConsumed, prometheus.GaugeValue, lic.LastConsumed, lic.Name)
+			ch <- prometheus.MustNewConstMetric(c.lastDeficit, prometheus.GaugeValue, lic.LastDeficit, lic.Name)
+		}
+	}
+	return nil
+}
+
+/*
+licensesData executes the scontrol command to retrieve license information.
+Expected scontrol output format: one line of key=value pairs per license.
+*/
+func (c *LicensesCollector) licensesData(cluster string) ([]byte, error) {
+	return executeOn(c.logger, cluster, "scontrol", []string{"show", "licenses", "-o"})
+}
+
+/*
+parseLicenses parses the output of the scontrol show licenses -o command.
+It expects one line of space-separated key=value pairs per license.
+*/
+func parseLicenses(data []byte) []LicenseInfo {
+	var licenses []LicenseInfo
+	for _, line := range strings.Split(string(data), "\n") {
+		lic := LicenseInfo{}
+		for _, pair := range strings.Fields(line) {
+			key, value, found := strings.Cut(pair, "=")
+			if !found {
+				continue
+			}
+			switch key {
+			case "LicenseName":
+				lic.Name = value
+			case "Total":
+				lic.Total, _ = strconv.ParseFloat(value, 64)
+			case "Used":
+				lic.Used, _ = strconv.ParseFloat(value, 64)
+			case "Free":
+				lic.Free, _ = strconv.ParseFloat(value, 64)
+			case "Reserved":
+				lic.Reserved, _ = strconv.ParseFloat(value, 64)
+			case "Remote":
+				lic.Remote = value == "yes"
+			case "LastConsumed":
+				lic.LastConsumed, _ = strconv.ParseFloat(value, 64)
+				lic.HasLastConsumed = true
+			case "LastDeficit":
+				lic.LastDeficit, _ = strconv.ParseFloat(value, 64)
+			}
+		}
+		if lic.Name != "" {
+			licenses = append(licenses, lic)
+		}
+	}
+	return licenses
+}
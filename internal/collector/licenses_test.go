@@ -0,0 +1,40 @@
+package collector
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLicenses(t *testing.T) {
+	data, err := os.ReadFile("../../test_data/slicenses.txt")
+	assert.NoError(t, err)
+
+	licenses := parseLicenses(data)
+	assert.Len(t, licenses, 3)
+
+	// Test a local license
+	lic1 := licenses[0]
+	assert.Equal(t, "matlab", lic1.Name)
+	assert.Equal(t, 50.0, lic1.Total)
+	assert.Equal(t, 12.0, lic1.Used)
+	assert.Equal(t, 38.0, lic1.Free)
+	assert.Equal(t, 0.0, lic1.Reserved)
+	assert.False(t, lic1.Remote)
+	assert.True(t, lic1.HasLastConsumed)
+
+	// Test a remote license partly consumed outside of Slurm
+	lic2 := licenses[1]
+	assert.Equal(t, "ansys@slurmdb", lic2.Name)
+	assert.Equal(t, 10.0, lic2.Reserved)
+	assert.True(t, lic2.Remote)
+	assert.Equal(t, 95.0, lic2.LastConsumed)
+	assert.Equal(t, 10.0, lic2.LastDeficit)
+
+	// Test a license printed without LastConsumed and LastDeficit (Slurm before 23.02)
+	lic3 := licenses[2]
+	assert.Equal(t, "abaqus", lic3.Name)
+	assert.Equal(t, 20.0, lic3.Free)
+	assert.False(t, lic3.HasLastConsumed)
+}
@@ -0,0 +1,360 @@
+package collector
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+const (
+	// qosLimitsFormat and assocLimitsFormat list the sacctmgr fields read by
+	// the limits collector. Their limits are named by qosLimitNames and
+	// assocLimitNames, in the same order.
+	qosLimitsFormat   = "Name,GrpTRES,GrpJobs,GrpSubmitJobs,MaxTRESPerUser,MaxJobsPerUser,MaxSubmitJobsPerUser"
+	assocLimitsFormat = "Cluster,Account,User,Partition,GrpTRES,GrpJobs,GrpSubmitJobs,MaxTRES,MaxJobs,MaxSubmitJobs"
+)
+
+var (
+	qosLimitNames   = []string{"grp_tres", "grp_jobs", "grp_submit_jobs", "max_tres_per_user", "max_jobs_per_user", "max_submit_jobs_per_user"}
+	assocLimitNames = []string{"grp_tres", "grp_jobs", "grp_submit_jobs", "max_tres_per_job", "max_jobs", "max_submit_jobs"}
+
+	// assocMgrLimits maps the limits printed with their usage by
+	// "scontrol show assoc_mgr" to the limit names.
+	assocMgrLimits = map[string]string{
+		"GrpTRES":       "grp_tres",
+		"GrpJobs":       "grp_jobs",
+		"GrpSubmitJobs": "grp_submit_jobs",
+		"MaxJobs":       "max_jobs",
+		"MaxSubmitJobs": "max_submit_jobs",
+	}
+
+	// tresUnits converts the unit suffixes printed by sacctmgr to megabytes,
+	// the unit of memory TRES in slurmctld.
+	tresUnits = map[byte]float64{'K': 1.0 / 1024, 'M': 1, 'G': 1024, 'T': 1024 * 1024, 'P': 1024 * 1024 * 1024}
+)
+
+// Limit is a single limit of a QOS or association. TRES is empty for the
+// limits on a number of jobs.
+type Limit struct {
+	Name  string
+	TRES  string
+	Value float64
+}
+
+// QOSLimits holds the limits set on a QOS.
+type QOSLimits struct {
+	Name   string
+	Limits []Limit
+}
+
+// AssocKey identifies an association.
+type AssocKey struct {
+	Cluster   string
+	Account   string
+	User      string
+	Partition string
+}
+
+// AssocLimits holds the limits set on an association.
+type AssocLimits struct {
+	AssocKey
+	Limits []Limit
+}
+
+// LimitKey identifies a limit by its name and TRES.
+type LimitKey struct {
+	Name string
+	TRES string
+}
+
+// LimitUsage holds the current usage of the QOS and association limits, as
+// tracked by slurmctld, and the clusters it has associations of.
+type LimitUsage struct {
+	QOS      map[string]map[LimitKey]float64
+	Assocs   map[AssocKey]map[LimitKey]float64
+	Clusters map[string]bool
+}
+
+/*
+QOSLimitsData executes the sacctmgr command to retrieve the limits of every QOS.
+Expected sacctmgr output format: "Name|GrpTRES|GrpJobs|GrpSubmitJobs|MaxTRESPerUser|MaxJobsPerUser|MaxSubmitJobsPerUser".
+*/
+func QOSLimitsData(logger *logger.Logger) ([]byte, error) {
+	return Execute(logger, "sacctmgr", []string{"show", "qos", "-n", "-P", "format=" + qosLimitsFormat})
+}
+
+/*
+AssocLimitsData executes the sacctmgr command to retrieve the limits of the associations of cluster,
+or of every association when cluster is empty.
+Expected sacctmgr output format: "Cluster|Account|User|Partition|GrpTRES|GrpJobs|GrpSubmitJobs|MaxTRES|MaxJobs|MaxSubmitJobs".
+*/
+func AssocLimitsData(logger *logger.Logger, cluster string) ([]byte, error) {
+	args := []string{"show", "assoc", "-n", "-P", "format=" + assocLimitsFormat}
+	if cluster != "" {
+		args = append(args, "cluster="+cluster)
+	}
+	return Execute(logger, "sacctmgr", args)
+}
+
+/*
+AssocMgrData executes the scontrol command to retrieve the usage of the limits from slurmctld.
+Expected scontrol output format: association and QOS records of key=value pairs, limits printed as "limit(usage)".
+*/
+func AssocMgrData(logger *logger.Logger, cluster string) ([]byte, error) {
+	return executeOn(logger, cluster, "scontrol", []string{"show", "assoc_mgr", "flags=assoc,qos"})
+}
+
+// ParseQOSLimits parses the output of QOSLimitsData. QOSes without limits
+// are omitted.
+func ParseQOSLimits(input []byte) []QOSLimits {
+	var qos []QOSLimits
+	for _, line := range strings.Split(string(input), "\n") {
+		fields := strings.Split(line, "|")
+		if len(fields) < 1+len(qosLimitNames) {
+			continue
+		}
+		limits := parseLimitFields(fields[1:], qosLimitNames)
+		if len(limits) > 0 {
+			qos = append(qos, QOSLimits{Name: fields[0], Limits: limits})
+		}
+	}
+	return qos
+}
+
+// ParseAssocLimits parses the output of AssocLimitsData. Associations
+// without limits are omitted.
+func ParseAssocLimits(input []byte) []AssocLimits {
+	var assocs []AssocLimits
+	for _, line := range strings.Split(string(input), "\n") {
+		fields := strings.Split(line, "|")
+		if len(fields) < 4+len(assocLimitNames) {
+			continue
+		}
+		limits := parseLimitFields(fields[4:], assocLimitNames)
+		if len(limits) > 0 {
+			assocs = append(assocs, AssocLimits{
+				AssocKey: AssocKey{Cluster: fields[0], Account: fields[1], User: fields[2], Partition: fields[3]},
+				Limits:   limits,
+			})
+		}
+	}
+	return assocs
+}
+
+// parseLimitFields parses sacctmgr limit fields, named by names. Limits on
+// TRES are lists such as "cpu=1000,mem=4000G", others a number of jobs.
+func parseLimitFields(fields []string, names []string) []Limit {
+	var limits []Limit
+	for i, name := range names {
+		value := strings.TrimSpace(fields[i])
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(name, "tres") {
+			if v, err := strconv.ParseFloat(value, 64); err == nil {
+				limits = append(limits, Limit{Name: name, Value: v})
+			}
+			continue
+		}
+		for _, tres := range strings.Split(value, ",") {
+			tresName, count, found := strings.Cut(tres, "=")
+			if !found {
+				continue
+			}
+			if v, ok := parseTRESCount(count); ok {
+				limits = append(limits, Limit{Name: name, TRES: tresName, Value: v})
+			}
+		}
+	}
+	return limits
+}
+
+// parseTRESCount parses a TRES count, converting unit suffixes to megabytes.
+func parseTRESCount(count string) (float64, bool) {
+	if count == "" {
+		return 0, false
+	}
+	factor := 1.0
+	if f, ok := tresUnits[count[len(count)-1]]; ok {
+		factor = f
+		count = count[:len(count)-1]
+	}
+	v, err := strconv.ParseFloat(count, 64)
+	if err != nil {
+		return 0, false
+	}
+	return v * factor, true
+}
+
+/*
+ParseLimitUsage parses the output of AssocMgrData.
+Every association and QOS record starts with a "ClusterName=" or "QOS=" line, followed by
+indented lines of key=value pairs. The per-account and per-user sections of QOS records are
+skipped.
+*/
+func ParseLimitUsage(input []byte) *LimitUsage {
+	usage := &LimitUsage{
+		QOS:      make(map[string]map[LimitKey]float64),
+		Assocs:   make(map[AssocKey]map[LimitKey]float64),
+		Clusters: make(map[string]bool),
+	}
+	var current map[LimitKey]float64
+	for _, line := range strings.Split(string(input), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "ClusterName="):
+			pairs := parseKeyValues(line)
+			key := AssocKey{
+				Cluster:   pairs["ClusterName"],
+				Account:   pairs["Account"],
+				User:      stripID(pairs["UserName"]),
+				Partition: pairs["Partition"],
+			}
+			current = make(map[LimitKey]float64)
+			usage.Assocs[key] = current
+			usage.Clusters[key.Cluster] = true
+			continue
+		case strings.HasPrefix(line, "QOS="):
+			current = make(map[LimitKey]float64)
+			usage.QOS[stripID(strings.TrimPrefix(line, "QOS="))] = current
+			continue
+		case trimmed == "Account Limits" || trimmed == "User Limits":
+			current = nil
+			continue
+		case current == nil:
+			continue
+		}
+
+		for key, value := range parseKeyValues(line) {
+			name, ok := assocMgrLimits[key]
+			if !ok {
+				continue
+			}
+			if name != "grp_tres" {
+				if v, ok := parseUsage(value); ok {
+					current[LimitKey{Name: name}] = v
+				}
+				continue
+			}
+			for _, tres := range strings.Split(value, ",") {
+				tresName, count, found := strings.Cut(tres, "=")
+				if !found {
+					continue
+				}
+				if v, ok := parseUsage(count); ok {
+					current[LimitKey{Name: name, TRES: tresName}] = v
+				}
+			}
+		}
+	}
+	return usage
+}
+
+// parseKeyValues splits a line of space-separated key=value pairs.
+func parseKeyValues(line string) map[string]string {
+	pairs := make(map[string]string)
+	for _, field := range strings.Fields(line) {
+		key, value, found := strings.Cut(field, "=")
+		if found {
+			pairs[key] = value
+		}
+	}
+	return pairs
+}
+
+// parseUsage returns the usage of an assoc_mgr "limit(usage)" value.
+func parseUsage(value string) (float64, bool) {
+	start := strings.Index(value, "(")
+	if start < 0 || !strings.HasSuffix(value, ")") {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(value[start+1:len(value)-1], 64)
+	return v, err == nil
+}
+
+// stripID removes the ID slurmctld appends to names, as in "alice(1001)".
+func stripID(name string) string {
+	if i := strings.Index(name, "("); i >= 0 {
+		return name[:i]
+	}
+	return name
+}
+
+/*
+ * Implement the Prometheus Collector interface and feed the
+ * Slurm limits metrics into it.
+ * https://godoc.org/github.com/prometheus/client_golang/prometheus#Collector
+ */
+
+// LimitsCollector exports the limits set on QOSes and associations, and the
+// current usage of the limits that slurmctld tracks.
+type LimitsCollector struct {
+	qosLimit   *prometheus.Desc
+	qosUsage   *prometheus.Desc
+	assocLimit *prometheus.Desc
+	assocUsage *prometheus.Desc
+	logger     *logger.Logger
+}
+
+func NewLimitsCollector(logger *logger.Logger) *LimitsCollector {
+	qosLabels := []string{"qos", "limit", "tres"}
+	assocLabels := []string{"account", "user", "partition", "limit", "tres"}
+	return &LimitsCollector{
+		qosLimit:   prometheus.NewDesc("slurm_qos_limit", "Limit set on a QOS", qosLabels, nil),
+		qosUsage:   prometheus.NewDesc("slurm_qos_usage", "Current usage of a QOS limit", qosLabels, nil),
+		assocLimit: prometheus.NewDesc("slurm_association_limit", "Limit set on an association", assocLabels, nil),
+		assocUsage: prometheus.NewDesc("slurm_association_usage", "Current usage of an association limit", assocLabels, nil),
+		logger:     logger,
+	}
+}
+
+func (lc *LimitsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- lc.qosLimit
+	ch <- lc.qosUsage
+	ch <- lc.assocLimit
+	ch <- lc.assocUsage
+}
+
+func (lc *LimitsCollector) Update(s *Snapshot, ch chan<- prometheus.Metric) error {
+	qosData, err := QOSLimitsData(lc.logger)
+	if err != nil {
+		return err
+	}
+	assocData, err := AssocLimitsData(lc.logger, s.Cluster())
+	if err != nil {
+		return err
+	}
+	assocMgrData, err := AssocMgrData(lc.logger, s.Cluster())
+	if err != nil {
+		return err
+	}
+	usage := ParseLimitUsage(assocMgrData)
+
+	for _, qos := range ParseQOSLimits(qosData) {
+		for _, l := range qos.Limits {
+			ch <- prometheus.MustNewConstMetric(lc.qosLimit, prometheus.GaugeValue, l.Value, qos.Name, l.Name, l.TRES)
+			if v, ok := usage.QOS[qos.Name][LimitKey{l.Name, l.TRES}]; ok {
+				ch <- prometheus.MustNewConstMetric(lc.qosUsage, prometheus.GaugeValue, v, qos.Name, l.Name, l.TRES)
+			}
+		}
+	}
+	for _, assoc := range ParseAssocLimits(assocData) {
+		// Without a cluster, slurmdbd also returns the associations of the
+		// other clusters: keep those slurmctld knows.
+		if s.Cluster() != "" && assoc.Cluster != s.Cluster() {
+			continue
+		}
+		if s.Cluster() == "" && len(usage.Clusters) > 0 && !usage.Clusters[assoc.Cluster] {
+			continue
+		}
+		for _, l := range assoc.Limits {
+			ch <- prometheus.MustNewConstMetric(lc.assocLimit, prometheus.GaugeValue, l.Value, assoc.Account, assoc.User, assoc.Partition, l.Name, l.TRES)
+			if v, ok := usage.Assocs[assoc.AssocKey][LimitKey{l.Name, l.TRES}]; ok {
+				ch <- prometheus.MustNewConstMetric(lc.assocUsage, prometheus.GaugeValue, v, assoc.Account, assoc.User, assoc.Partition, l.Name, l.TRES)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package collector
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseQOSLimits(t *testing.T) {
+	data, err := os.ReadFile("../../test_data/sacctmgr_qos.txt")
+	assert.NoError(t, err)
+
+	qos := ParseQOSLimits(data)
+	assert.Len(t, qos, 3)
+	assert.Equal(t, "normal", qos[0].Name)
+	assert.Equal(t, []Limit{
+		{Name: "max_tres_per_user", TRES: "cpu", Value: 256},
+		{Name: "max_jobs_per_user", Value: 50},
+		{Name: "max_submit_jobs_per_user", Value: 100},
+	}, qos[0].Limits)
+	assert.Equal(t, []Limit{
+		{Name: "grp_tres", TRES: "cpu", Value: 512},
+		{Name: "grp_tres", TRES: "gres/gpu", Value: 16},
+		{Name: "grp_jobs", Value: 100},
+		{Name: "grp_submit_jobs", Value: 200},
+		{Name: "max_tres_per_user", TRES: "cpu", Value: 128},
+	}, qos[1].Limits)
+}
+
+func TestParseAssocLimits(t *testing.T) {
+	data, err := os.ReadFile("../../test_data/sacctmgr_assoc.txt")
+	assert.NoError(t, err)
+
+	// Associations without limits are left out.
+	assocs := ParseAssocLimits(data)
+	assert.Len(t, assocs, 5)
+
+	assert.Equal(t, AssocKey{Cluster: "cluster01", Account: "physics"}, assocs[0].AssocKey)
+	// Memory is converted to megabytes, like slurmctld counts it.
+	assert.Equal(t, []Limit{
+		{Name: "grp_tres", TRES: "cpu", Value: 1000},
+		{Name: "grp_tres", TRES: "mem", Value: 4096000},
+		{Name: "grp_jobs", Value: 200},
+		{Name: "grp_submit_jobs", Value: 400},
+	}, assocs[0].Limits)
+
+	assert.Equal(t, AssocKey{Cluster: "cluster01", Account: "physics", User: "bob", Partition: "gpu"}, assocs[2].AssocKey)
+	assert.Equal(t, "cluster02", assocs[4].Cluster)
+}
+
+func TestParseLimitUsage(t *testing.T) {
+	data, err := os.ReadFile("../../test_data/assoc_mgr.txt")
+	assert.NoError(t, err)
+
+	usage := ParseLimitUsage(data)
+	assert.Equal(t, map[string]bool{"cluster01": true}, usage.Clusters)
+	assert.Len(t, usage.Assocs, 5)
+	assert.Len(t, usage.QOS, 3)
+
+	physics := usage.Assocs[AssocKey{Cluster: "cluster01", Account: "physics"}]
+	assert.Equal(t, 900.0, physics[LimitKey{"grp_tres", "cpu"}])
+	assert.Equal(t, 3686400.0, physics[LimitKey{"grp_tres", "mem"}])
+	assert.Equal(t, 110.0, physics[LimitKey{"grp_jobs", ""}])
+	assert.Equal(t, 230.0, physics[LimitKey{"grp_submit_jobs", ""}])
+	assert.NotContains(t, physics, LimitKey{"max_jobs", ""})
+
+	alice := usage.Assocs[AssocKey{Cluster: "cluster01", Account: "physics", User: "alice"}]
+	assert.Equal(t, 20.0, alice[LimitKey{"max_jobs", ""}])
+	assert.Equal(t, 45.0, alice[LimitKey{"max_submit_jobs", ""}])
+
+	// Per-user QOS usage is not mixed into the QOS record.
+	normal := usage.QOS["normal"]
+	assert.Equal(t, 140.0, normal[LimitKey{"grp_jobs", ""}])
+	assert.Equal(t, 1100.0, normal[LimitKey{"grp_tres", "cpu"}])
+	assert.Equal(t, 4.0, usage.QOS["high"][LimitKey{"grp_tres", "gres/gpu"}])
+}
+
+func TestLimitsCollector(t *testing.T) {
+	oldExecute := Execute
+	defer func() { Execute = oldExecute }()
+	Execute = func(logger *logger.Logger, command string, args []string) ([]byte, error) {
+		switch {
+		case command == "scontrol":
+			return os.ReadFile("../../test_data/assoc_mgr.txt")
+		case args[1] == "qos":
+			return os.ReadFile("../../test_data/sacctmgr_qos.txt")
+		}
+		return os.ReadFile("../../test_data/sacctmgr_assoc.txt")
+	}
+
+	lc := NewLimitsCollector(logger.NewLogger("error"))
+	assert.Equal(t, 12, testutil.CollectAndCount(updater{lc}, "slurm_qos_limit"))
+	// Only the Grp limits of QOSes have their usage tracked.
+	assert.Equal(t, 6, testutil.CollectAndCount(updater{lc}, "slurm_qos_usage"))
+	// The association of cluster02 is left out.
+	assert.Equal(t, 9, testutil.CollectAndCount(updater{lc}, "slurm_association_limit"))
+	// MaxTRES is a per-job limit without usage.
+	assert.Equal(t, 8, testutil.CollectAndCount(updater{lc}, "slurm_association_usage"))
+}
+
+func TestLimitsCollectorCluster(t *testing.T) {
+	oldExecute := Execute
+	defer func() { Execute = oldExecute }()
+	var assocArgs []string
+	Execute = func(logger *logger.Logger, command string, args []string) ([]byte, error) {
+		switch {
+		case command == "scontrol":
+			return os.ReadFile("../../test_data/assoc_mgr.txt")
+		case args[1] == "qos":
+			return os.ReadFile("../../test_data/sacctmgr_qos.txt")
+		}
+		assocArgs = args
+		return os.ReadFile("../../test_data/sacctmgr_assoc.txt")
+	}
+
+	testLogger := logger.NewLogger("error")
+	lc := NewLimitsCollector(testLogger)
+	ch := make(chan prometheus.Metric, 100)
+	assert.NoError(t, lc.Update(NewClusterSnapshot(testLogger, "cluster02"), ch))
+	close(ch)
+	assert.Contains(t, assocArgs, "cluster=cluster02")
+
+	// Only the association of cluster02 is exported.
+	assocs := 0
+	for m := range ch {
+		if strings.Contains(m.Desc().String(), `"slurm_association_limit"`) {
+			assocs++
+		}
+	}
+	assert.Equal(t, 1, assocs)
+}
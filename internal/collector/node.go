@@ -1,10 +1,11 @@
 package collector
 
 import (
-	"regexp"
+	"slices"
 	"sort"
-	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sckyzo/slurm_exporter/internal/logger"
@@ -25,76 +26,276 @@ type NodeMetrics struct {
 	timestamp  string
 }
 
-func NodeGetMetrics(logger *logger.Logger) (map[string]*NodeMetrics, error) {
-	data, err := NodeData(logger)
-	if err != nil {
-		return nil, err
+// ParseNodeMetrics takes the records of the sinfo snapshot
+// It returns a map of metrics per node, including partitions
+func ParseNodeMetrics(records []NodeRecord) map[string]*NodeMetrics {
+	nodes := make(map[string]*NodeMetrics)
+	for _, node := range records {
+		nodeName := node.Name
+
+		// Create new node metrics if it doesn't exist
+		if _, exists := nodes[nodeName]; !exists {
+			nodes[nodeName] = &NodeMetrics{0, 0, 0, 0, 0, 0, node.State, []string{}, "", "", ""}
+		}
+
+		nodes[nodeName].memAlloc = uint64(node.AllocMem)
+		nodes[nodeName].memTotal = uint64(node.Memory)
+		nodes[nodeName].cpuAlloc = uint64(node.CPUs.alloc)
+		nodes[nodeName].cpuIdle = uint64(node.CPUs.idle)
+		nodes[nodeName].cpuOther = uint64(node.CPUs.other)
+		nodes[nodeName].cpuTotal = uint64(node.CPUs.total)
+
+		nodes[nodeName].reason = node.Reason
+		nodes[nodeName].user = node.User
+		nodes[nodeName].timestamp = node.Timestamp
+		// Add the partition if it's not already in the list
+		nodes[nodeName].partitions = appendUnique(nodes[nodeName].partitions, node.Partition)
 	}
-	return ParseNodeMetrics(data), nil
+
+	return nodes
 }
 
-// ParseNodeMetrics takes the output of sinfo with node data
-// It returns a map of metrics per node, including partitions
-func ParseNodeMetrics(input []byte) map[string]*NodeMetrics {
-	nodes := make(map[string]*NodeMetrics)
-	lines := strings.Split(string(input), "\n")
+// nodeStateFlags are the suffixes sinfo appends to a node state, such as the
+// "*" of a node that does not respond or the "~" of a powered down node.
+const nodeStateFlags = "*~#!%$@^-+"
 
-	// Sort and remove all the duplicates from the 'sinfo' output
-	sort.Strings(lines)
-	linesUniq := RemoveDuplicates(lines)
+// nodeBaseState returns the state of a node without its suffixes.
+func nodeBaseState(state string) string {
+	return strings.TrimRight(state, nodeStateFlags)
+}
 
-	re := regexp.MustCompile(`\s{2,}`) // Split by two or more spaces, since Reason field can have singular spaces
-	for _, line := range linesUniq {
-		node := re.Split(line, -1)
-		if len(node) < 9 {
-			continue
+// nodeFlagSuffixes maps the suffixes of a node state to the flag they stand for.
+var nodeFlagSuffixes = map[rune]string{
+	'*': "not_responding",
+	'~': "powered_down",
+	'#': "powering_up",
+	'!': "power_down",
+	'%': "powering_down",
+	'$': "maint",
+	'@': "reboot_requested",
+	'^': "reboot_issued",
+	'-': "planned",
+}
+
+// nodeFlagAliases maps other spellings of a flag to its name.
+var nodeFlagAliases = map[string]string{
+	"maintenance": "maint",
+	"res":         "reserved",
+	"no_respond":  "not_responding",
+}
+
+/*
+ParseNodeState splits a node state such as "IDLE+DRAIN" (scontrol show nodes) or "down*+cloud"
+into its base state and its flags, in lower case. The suffixes sinfo appends to a state, such as
+the "*" of a node that does not respond, become flags. A drained node that still runs jobs also
+gets the "draining" flag.
+*/
+func ParseNodeState(state string) (string, []string) {
+	parts := strings.Split(strings.ToLower(state), "+")
+	var flags []string
+	addFlag := func(flag string) {
+		if alias, ok := nodeFlagAliases[flag]; ok {
+			flag = alias
 		}
-		nodeName := node[0]
-		nodeStatus := node[4] // mixed, allocated, etc.
-		partition := node[5]  // Partition name
+		if flag != "" && !slices.Contains(flags, flag) {
+			flags = append(flags, flag)
+		}
+	}
+	for i, part := range parts {
+		trimmed := nodeBaseState(part)
+		for _, suffix := range part[len(trimmed):] {
+			addFlag(nodeFlagSuffixes[suffix])
+		}
+		if i > 0 {
+			addFlag(trimmed)
+		}
+		parts[i] = trimmed
+	}
+	base := parts[0]
+	if slices.Contains(flags, "drain") && (base == "allocated" || base == "mixed") {
+		addFlag("draining")
+	}
+	sort.Strings(flags)
+	return base, flags
+}
 
-		// Create new node metrics if it doesn't exist
-		if _, exists := nodes[nodeName]; !exists {
-			nodes[nodeName] = &NodeMetrics{0, 0, 0, 0, 0, 0, nodeStatus, []string{}, "", "", ""}
+// NodePowerState returns the power saving state of a node from the flags of
+// its state: "powered_down", "powering_up", "powering_down" or "on".
+func NodePowerState(flags []string) string {
+	for _, state := range []string{"powering_up", "powering_down", "powered_down"} {
+		if slices.Contains(flags, state) {
+			return state
 		}
+	}
+	return "on"
+}
 
-		memAlloc, _ := strconv.ParseUint(node[1], 10, 64)
-		memTotal, _ := strconv.ParseUint(node[2], 10, 64)
+// NodeTransition is a change of the state of a node.
+type NodeTransition struct {
+	Node string
+	From string
+	To   string
+}
 
-		cpuInfo := strings.Split(node[3], "/")
-		cpuAlloc, _ := strconv.ParseUint(cpuInfo[0], 10, 64)
-		cpuIdle, _ := strconv.ParseUint(cpuInfo[1], 10, 64)
-		cpuOther, _ := strconv.ParseUint(cpuInfo[2], 10, 64)
-		cpuTotal, _ := strconv.ParseUint(cpuInfo[3], 10, 64)
+// nodeHistory is the state history of a node since it was first seen.
+type nodeHistory struct {
+	state   string
+	since   time.Time // Time of the last state change
+	seen    time.Time // Time of the last update
+	drained float64   // Seconds spent drained or draining
+	down    float64   // Seconds spent down
+}
 
-		nodes[nodeName].memAlloc = memAlloc
-		nodes[nodeName].memTotal = memTotal
-		nodes[nodeName].cpuAlloc = cpuAlloc
-		nodes[nodeName].cpuIdle = cpuIdle
-		nodes[nodeName].cpuOther = cpuOther
-		nodes[nodeName].cpuTotal = cpuTotal
+// add accounts the time elapsed since the last update to the state of the node.
+func (h *nodeHistory) add(elapsed float64) {
+	switch {
+	case strings.HasPrefix(h.state, "drain"):
+		h.drained += elapsed
+	case strings.HasPrefix(h.state, "down"):
+		h.down += elapsed
+	}
+}
 
-		reason := node[6]
-		user := node[7]
-		timestamp := node[8]
+// NodeStateTracker keeps the state history of the nodes across scrapes.
+type NodeStateTracker struct {
+	mu          sync.Mutex
+	updated     time.Time // Time of the last update applied
+	nodes       map[string]*nodeHistory
+	transitions map[NodeTransition]float64
+}
 
-		nodes[nodeName].reason = reason
-		nodes[nodeName].user = user
-		nodes[nodeName].timestamp = timestamp
-		// Add the partition if it's not already in the list
-		nodes[nodeName].partitions = appendUnique(nodes[nodeName].partitions, partition)
+func NewNodeStateTracker() *NodeStateTracker {
+	return &NodeStateTracker{
+		nodes:       make(map[string]*nodeHistory),
+		transitions: make(map[NodeTransition]float64),
 	}
+}
 
-	return nodes
+/*
+Update records the states of the nodes seen at now. The time since the previous update is
+accounted to the previous state of each node. A node seen for the first time is assumed to be
+in its state since the Timestamp of sinfo, the time its reason was set, or since now when it
+has none. Nodes that are gone are forgotten. An update older than the last one applied, from a
+concurrent scrape that read sinfo earlier, is ignored.
+*/
+func (t *NodeStateTracker) Update(nodes []NodeRecord, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if now.Before(t.updated) {
+		return
+	}
+	t.updated = now
+	current := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		current[node.Name] = true
+		state := nodeBaseState(node.State)
+		h, ok := t.nodes[node.Name]
+		if !ok {
+			since := parseSlurmTime(node.Timestamp)
+			if since.IsZero() || since.After(now) {
+				since = now
+			}
+			h = &nodeHistory{state: state, since: since, seen: since}
+			t.nodes[node.Name] = h
+		}
+		h.add(now.Sub(h.seen).Seconds())
+		h.seen = now
+		if state != h.state {
+			t.transitions[NodeTransition{Node: node.Name, From: h.state, To: state}]++
+			h.state, h.since = state, now
+		}
+	}
+	for name := range t.nodes {
+		if !current[name] {
+			delete(t.nodes, name)
+		}
+	}
+	for transition := range t.transitions {
+		if !current[transition.Node] {
+			delete(t.transitions, transition)
+		}
+	}
+}
+
+// Snapshot returns a copy of the history of every node and of the transition
+// counts, taken under the lock of the tracker.
+func (t *NodeStateTracker) Snapshot() (map[string]nodeHistory, map[NodeTransition]float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	nodes := make(map[string]nodeHistory, len(t.nodes))
+	for name, h := range t.nodes {
+		nodes[name] = *h
+	}
+	transitions := make(map[NodeTransition]float64, len(t.transitions))
+	for transition, count := range t.transitions {
+		transitions[transition] = count
+	}
+	return nodes, transitions
+}
+
+// nodeResumeBuckets are the buckets of the resume durations, from 30 seconds to an hour.
+var nodeResumeBuckets = []float64{30, 60, 120, 180, 300, 450, 600, 900, 1200, 1800, 3600}
+
+// NodePowerTracker follows the nodes powering up across scrapes.
+type NodePowerTracker struct {
+	mu       sync.Mutex
+	resuming map[string]time.Time // First time each node was seen powering up
+}
+
+func NewNodePowerTracker() *NodePowerTracker {
+	return &NodePowerTracker{resuming: make(map[string]time.Time)}
 }
 
 /*
-NodeData executes the sinfo command to get detailed data for each node.
-Expected sinfo output format: "NodeList,AllocMem,Memory,CPUsState,StateLong,Partition,Reason,UserLong,Timestamp".
+Update records the power state of the nodes of the scontrol snapshot seen at now. It returns the
+durations in seconds of the resumes that completed since the previous update, and the number of
+resumes that failed: the node left POWERING_UP to be down, powered down again or not responding,
+or slurmctld gave up with "ResumeTimeout reached". A resume is timed from the first update that
+saw the node powering up.
 */
-func NodeData(logger *logger.Logger) ([]byte, error) {
-	args := []string{"-h", "-N", "-O", "NodeList:25,AllocMem,Memory,CPUsState,StateLong,Partition,Reason:30,UserLong,Timestamp"}
-	return Execute(logger, "sinfo", args)
+func (t *NodePowerTracker) Update(details []NodeDetail, now time.Time) (resumed []float64, failed int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	current := make(map[string]bool, len(details))
+	for _, detail := range details {
+		current[detail.Name] = true
+		base, flags := ParseNodeState(detail.Fields["State"])
+		since, resuming := t.resuming[detail.Name]
+		if slices.Contains(flags, "powering_up") {
+			if !resuming {
+				t.resuming[detail.Name] = now
+			}
+			continue
+		}
+		if !resuming {
+			continue
+		}
+		delete(t.resuming, detail.Name)
+		if base == "down" || slices.Contains(flags, "powered_down") || slices.Contains(flags, "not_responding") ||
+			strings.HasPrefix(detail.Fields["Reason"], "ResumeTimeout reached") {
+			failed++
+		} else {
+			resumed = append(resumed, now.Sub(since).Seconds())
+		}
+	}
+	for name := range t.resuming {
+		if !current[name] {
+			delete(t.resuming, name)
+		}
+	}
+	return resumed, failed
+}
+
+// Resuming returns a copy of the time each node powering up was first seen,
+// taken under the lock of the tracker.
+func (t *NodePowerTracker) Resuming() map[string]time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	resuming := make(map[string]time.Time, len(t.resuming))
+	for node, since := range t.resuming {
+		resuming[node] = since
+	}
+	return resuming
 }
 
 type NodeCollector struct {
@@ -105,20 +306,53 @@ type NodeCollector struct {
 	memAlloc   *prometheus.Desc
 	memTotal   *prometheus.Desc
 	nodeStatus *prometheus.Desc
-	logger     *logger.Logger
+	stateFlag  *prometheus.Desc
+	// State history, kept across scrapes
+	transitions *prometheus.Desc
+	stateTime   *prometheus.Desc
+	drainedTime *prometheus.Desc
+	downTime    *prometheus.Desc
+	tracker     *NodeStateTracker
+	// Power saving, resumes are kept across scrapes
+	powerState     *prometheus.Desc
+	nextState      *prometheus.Desc
+	poweringUpTime *prometheus.Desc
+	resumeTime     prometheus.Histogram
+	resumeFailures prometheus.Counter
+	power          *NodePowerTracker
+	logger         *logger.Logger
 }
 
 func NewNodeCollector(logger *logger.Logger) *NodeCollector {
 	labels := []string{"node", "status", "partition", "reason", "user", "timestamp"}
 	return &NodeCollector{
-		cpuAlloc:   prometheus.NewDesc("slurm_node_cpu_alloc", "Allocated CPUs per node", labels, nil),
-		cpuIdle:    prometheus.NewDesc("slurm_node_cpu_idle", "Idle CPUs per node", labels, nil),
-		cpuOther:   prometheus.NewDesc("slurm_node_cpu_other", "Other CPUs per node", labels, nil),
-		cpuTotal:   prometheus.NewDesc("slurm_node_cpu_total", "Total CPUs per node", labels, nil),
-		memAlloc:   prometheus.NewDesc("slurm_node_mem_alloc", "Allocated memory per node", labels, nil),
-		memTotal:   prometheus.NewDesc("slurm_node_mem_total", "Total memory per node", labels, nil),
-		nodeStatus: prometheus.NewDesc("slurm_node_status", "Node Status with partition", labels, nil),
-		logger:     logger,
+		cpuAlloc:       prometheus.NewDesc("slurm_node_cpu_alloc", "Allocated CPUs per node", labels, nil),
+		cpuIdle:        prometheus.NewDesc("slurm_node_cpu_idle", "Idle CPUs per node", labels, nil),
+		cpuOther:       prometheus.NewDesc("slurm_node_cpu_other", "Other CPUs per node", labels, nil),
+		cpuTotal:       prometheus.NewDesc("slurm_node_cpu_total", "Total CPUs per node", labels, nil),
+		memAlloc:       prometheus.NewDesc("slurm_node_mem_alloc", "Allocated memory per node", labels, nil),
+		memTotal:       prometheus.NewDesc("slurm_node_mem_total", "Total memory per node", labels, nil),
+		nodeStatus:     prometheus.NewDesc("slurm_node_status", "Node Status with partition", labels, nil),
+		stateFlag:      prometheus.NewDesc("slurm_node_state_flag", "State flags of the node, such as drain or maint, from scontrol", []string{"node", "flag"}, nil),
+		transitions:    prometheus.NewDesc("slurm_node_state_transitions_total", "Changes of the state of the node seen by the exporter", []string{"node", "from", "to"}, nil),
+		stateTime:      prometheus.NewDesc("slurm_node_state_duration_seconds", "Seconds since the last change of the state of the node", []string{"node", "state"}, nil),
+		drainedTime:    prometheus.NewDesc("slurm_node_drained_seconds_total", "Seconds the node spent drained or draining", []string{"node"}, nil),
+		downTime:       prometheus.NewDesc("slurm_node_down_seconds_total", "Seconds the node spent down", []string{"node"}, nil),
+		tracker:        NewNodeStateTracker(),
+		powerState:     prometheus.NewDesc("slurm_node_power_state", "Power saving state of the node: on, powered_down, powering_up or powering_down", []string{"node", "state"}, nil),
+		nextState:      prometheus.NewDesc("slurm_node_next_state", "State the node will be set to once rebooted or resumed, from scontrol", []string{"node", "state"}, nil),
+		poweringUpTime: prometheus.NewDesc("slurm_node_powering_up_seconds", "Seconds since the node was first seen powering up", []string{"node"}, nil),
+		resumeTime: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "slurm_node_resume_duration_seconds",
+			Help:    "Time taken by the nodes to power up, from the first scrape that saw them powering up",
+			Buckets: nodeResumeBuckets,
+		}),
+		resumeFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "slurm_node_resume_failures_total",
+			Help: "Resumes of powered down nodes that failed",
+		}),
+		power:  NewNodePowerTracker(),
+		logger: logger,
 	}
 }
 
@@ -130,14 +364,24 @@ func (nc *NodeCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- nc.memAlloc
 	ch <- nc.memTotal
 	ch <- nc.nodeStatus
+	ch <- nc.stateFlag
+	ch <- nc.transitions
+	ch <- nc.stateTime
+	ch <- nc.drainedTime
+	ch <- nc.downTime
+	ch <- nc.powerState
+	ch <- nc.nextState
+	ch <- nc.poweringUpTime
+	nc.resumeTime.Describe(ch)
+	nc.resumeFailures.Describe(ch)
 }
 
-func (nc *NodeCollector) Collect(ch chan<- prometheus.Metric) {
-	nodes, err := NodeGetMetrics(nc.logger)
+func (nc *NodeCollector) Update(s *Snapshot, ch chan<- prometheus.Metric) error {
+	records, err := s.Nodes()
 	if err != nil {
-		nc.logger.Error("Failed to get node metrics", "err", err)
-		return
+		return err
 	}
+	nodes := ParseNodeMetrics(records)
 	for node, metrics := range nodes {
 		for _, partition := range metrics.partitions {
 			ch <- prometheus.MustNewConstMetric(nc.cpuAlloc, prometheus.GaugeValue, float64(metrics.cpuAlloc), node, metrics.nodeStatus, partition, metrics.reason, metrics.user, metrics.timestamp)
@@ -149,6 +393,50 @@ func (nc *NodeCollector) Collect(ch chan<- prometheus.Metric) {
 			ch <- prometheus.MustNewConstMetric(nc.nodeStatus, prometheus.GaugeValue, 1, node, metrics.nodeStatus, partition, metrics.reason, metrics.user, metrics.timestamp)
 		}
 	}
+
+	// The state history only needs sinfo, so it is kept up to date even
+	// when scontrol fails. It is updated at the time sinfo was read.
+	now := time.Now()
+	nc.tracker.Update(uniqueNodes(records), s.NodesTime())
+	history, transitions := nc.tracker.Snapshot()
+	for node, h := range history {
+		ch <- prometheus.MustNewConstMetric(nc.stateTime, prometheus.GaugeValue, now.Sub(h.since).Seconds(), node, h.state)
+		ch <- prometheus.MustNewConstMetric(nc.drainedTime, prometheus.CounterValue, h.drained, node)
+		ch <- prometheus.MustNewConstMetric(nc.downTime, prometheus.CounterValue, h.down, node)
+	}
+	for transition, count := range transitions {
+		ch <- prometheus.MustNewConstMetric(nc.transitions, prometheus.CounterValue, count, transition.Node, transition.From, transition.To)
+	}
+
+	// The flags and power saving metrics need scontrol, the metrics above
+	// are still exported when it fails.
+	details, err := s.NodeDetails()
+	if err != nil {
+		nc.logger.Error("Failed to get node details", "err", err)
+		return nil
+	}
+	for _, detail := range details {
+		_, flags := ParseNodeState(detail.Fields["State"])
+		for _, flag := range flags {
+			ch <- prometheus.MustNewConstMetric(nc.stateFlag, prometheus.GaugeValue, 1, detail.Name, flag)
+		}
+		ch <- prometheus.MustNewConstMetric(nc.powerState, prometheus.GaugeValue, 1, detail.Name, NodePowerState(flags))
+		if next := detail.Fields["NextState"]; next != "" && next != "None" {
+			ch <- prometheus.MustNewConstMetric(nc.nextState, prometheus.GaugeValue, 1, detail.Name, strings.ToLower(next))
+		}
+	}
+
+	resumed, failed := nc.power.Update(details, now)
+	for _, seconds := range resumed {
+		nc.resumeTime.Observe(seconds)
+	}
+	nc.resumeFailures.Add(float64(failed))
+	nc.resumeTime.Collect(ch)
+	nc.resumeFailures.Collect(ch)
+	for node, since := range nc.power.Resuming() {
+		ch <- prometheus.MustNewConstMetric(nc.poweringUpTime, prometheus.GaugeValue, now.Sub(since).Seconds(), node)
+	}
+	return nil
 }
 
 // appendUnique adds a string to a slice if it doesn't already exist
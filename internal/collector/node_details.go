@@ -0,0 +1,124 @@
+package collector
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// nodeDetailGauges maps the numeric scontrol node fields exported by the
+// NodeDetailsCollector to their metric name and help.
+var nodeDetailGauges = []struct {
+	field, name, help string
+}{
+	{"CPULoad", "slurm_node_cpu_load", "Load average of the node"},
+	{"FreeMem", "slurm_node_mem_free", "Free memory of the node in MB, as seen by slurmd"},
+	{"RealMemory", "slurm_node_mem_real", "Configured memory of the node in MB"},
+	{"CurrentWatts", "slurm_node_current_watts", "Current power consumption of the node in watts"},
+	{"AveWatts", "slurm_node_average_watts", "Average power consumption of the node in watts"},
+}
+
+// nodeDetailTimes maps the scontrol node timestamps exported by the
+// NodeDetailsCollector to their metric name and help.
+var nodeDetailTimes = []struct {
+	field, name, help string
+}{
+	{"BootTime", "slurm_node_boot_time_seconds", "Boot time of the node in seconds since the Unix epoch"},
+	{"SlurmdStartTime", "slurm_node_slurmd_start_time_seconds", "Start time of slurmd on the node in seconds since the Unix epoch"},
+	{"LastBusyTime", "slurm_node_last_busy_time_seconds", "Last time the node had jobs, in seconds since the Unix epoch"},
+}
+
+/*
+ParseNodeTRES parses a TRES list of scontrol such as "cpu=32,mem=500G,gres/gpu=4".
+Memory is returned in MB, like RealMemory.
+*/
+func ParseNodeTRES(value string) map[string]float64 {
+	tres := make(map[string]float64)
+	for _, item := range strings.Split(value, ",") {
+		name, count, found := strings.Cut(item, "=")
+		if !found {
+			continue
+		}
+		if v, ok := parseTRESCount(count); ok {
+			tres[name] = v
+		}
+	}
+	return tres
+}
+
+/*
+ * Implement the Prometheus Collector interface and feed the
+ * Slurm node details metrics into it.
+ * https://godoc.org/github.com/prometheus/client_golang/prometheus#Collector
+ */
+
+// NodeDetailsCollector exports the load, memory, TRES, power and uptime of
+// every node, from the shared scontrol node snapshot.
+type NodeDetailsCollector struct {
+	gauges       []*prometheus.Desc
+	times        []*prometheus.Desc
+	tresAlloc    *prometheus.Desc
+	tresCfg      *prometheus.Desc
+	featuresInfo *prometheus.Desc
+	logger       *logger.Logger
+}
+
+func NewNodeDetailsCollector(logger *logger.Logger) *NodeDetailsCollector {
+	labels := []string{"node"}
+	nc := &NodeDetailsCollector{
+		tresAlloc:    prometheus.NewDesc("slurm_node_tres_alloc", "TRES allocated on the node, memory in MB", []string{"node", "tres"}, nil),
+		tresCfg:      prometheus.NewDesc("slurm_node_tres_configured", "TRES configured on the node, memory in MB", []string{"node", "tres"}, nil),
+		featuresInfo: prometheus.NewDesc("slurm_node_features_info", "A metric with a constant '1' value labeled by the available and active features of the node", []string{"node", "features", "active_features"}, nil),
+		logger:       logger,
+	}
+	for _, g := range nodeDetailGauges {
+		nc.gauges = append(nc.gauges, prometheus.NewDesc(g.name, g.help, labels, nil))
+	}
+	for _, t := range nodeDetailTimes {
+		nc.times = append(nc.times, prometheus.NewDesc(t.name, t.help, labels, nil))
+	}
+	return nc
+}
+
+func (nc *NodeDetailsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range nc.gauges {
+		ch <- desc
+	}
+	for _, desc := range nc.times {
+		ch <- desc
+	}
+	ch <- nc.tresAlloc
+	ch <- nc.tresCfg
+	ch <- nc.featuresInfo
+}
+
+func (nc *NodeDetailsCollector) Update(s *Snapshot, ch chan<- prometheus.Metric) error {
+	nodes, err := s.NodeDetails()
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		// Values such as "N/A" for nodes that are not responding are skipped.
+		for i, g := range nodeDetailGauges {
+			if v, err := strconv.ParseFloat(node.Fields[g.field], 64); err == nil {
+				ch <- prometheus.MustNewConstMetric(nc.gauges[i], prometheus.GaugeValue, v, node.Name)
+			}
+		}
+		for i, t := range nodeDetailTimes {
+			if ts, err := time.ParseInLocation(slurmTimeLayout, node.Fields[t.field], time.Local); err == nil {
+				ch <- prometheus.MustNewConstMetric(nc.times[i], prometheus.GaugeValue, float64(ts.Unix()), node.Name)
+			}
+		}
+		for tres, v := range ParseNodeTRES(node.Fields["AllocTRES"]) {
+			ch <- prometheus.MustNewConstMetric(nc.tresAlloc, prometheus.GaugeValue, v, node.Name, tres)
+		}
+		for tres, v := range ParseNodeTRES(node.Fields["CfgTRES"]) {
+			ch <- prometheus.MustNewConstMetric(nc.tresCfg, prometheus.GaugeValue, v, node.Name, tres)
+		}
+		ch <- prometheus.MustNewConstMetric(nc.featuresInfo, prometheus.GaugeValue, 1, node.Name, node.Fields["AvailableFeatures"], node.Fields["ActiveFeatures"])
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package collector
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNodeTRES(t *testing.T) {
+	assert.Equal(t, map[string]float64{"cpu": 48, "mem": 192000}, ParseNodeTRES("cpu=48,mem=187.50G"))
+	assert.Equal(t, map[string]float64{"cpu": 32, "mem": 512000, "billing": 32, "gres/gpu": 4, "gres/gpu:a100": 4},
+		ParseNodeTRES("cpu=32,mem=500G,billing=32,gres/gpu=4,gres/gpu:a100=4"))
+	assert.Empty(t, ParseNodeTRES(""))
+}
+
+func TestNodeDetailsCollector(t *testing.T) {
+	oldExecute := Execute
+	defer func() { Execute = oldExecute }()
+	Execute = func(logger *logger.Logger, command string, args []string) ([]byte, error) {
+		return os.ReadFile("../../test_data/scontrol_nodes.txt")
+	}
+
+	nc := NewNodeDetailsCollector(logger.NewLogger("error"))
+	// node002 does not respond, its load and free memory are unknown.
+	expected := `
+# HELP slurm_node_cpu_load Load average of the node
+# TYPE slurm_node_cpu_load gauge
+slurm_node_cpu_load{node="gpu001"} 2.1
+slurm_node_cpu_load{node="node001"} 47.85
+# HELP slurm_node_mem_free Free memory of the node in MB, as seen by slurmd
+# TYPE slurm_node_mem_free gauge
+slurm_node_mem_free{node="gpu001"} 498000
+slurm_node_mem_free{node="node001"} 61234
+# HELP slurm_node_current_watts Current power consumption of the node in watts
+# TYPE slurm_node_current_watts gauge
+slurm_node_current_watts{node="gpu001"} 1450
+slurm_node_current_watts{node="node001"} 0
+slurm_node_current_watts{node="node002"} 0
+# HELP slurm_node_tres_alloc TRES allocated on the node, memory in MB
+# TYPE slurm_node_tres_alloc gauge
+slurm_node_tres_alloc{node="gpu001",tres="cpu"} 32
+slurm_node_tres_alloc{node="gpu001",tres="gres/gpu"} 4
+slurm_node_tres_alloc{node="gpu001",tres="gres/gpu:a100"} 4
+slurm_node_tres_alloc{node="gpu001",tres="mem"} 512000
+slurm_node_tres_alloc{node="node001",tres="cpu"} 48
+slurm_node_tres_alloc{node="node001",tres="mem"} 192000
+# HELP slurm_node_features_info A metric with a constant '1' value labeled by the available and active features of the node
+# TYPE slurm_node_features_info gauge
+slurm_node_features_info{active_features="amd,a100",features="amd,a100",node="gpu001"} 1
+slurm_node_features_info{active_features="intel",features="intel,ib",node="node002"} 1
+slurm_node_features_info{active_features="intel,ib",features="intel,ib",node="node001"} 1
+`
+	err := testutil.CollectAndCompare(updater{nc}, strings.NewReader(expected),
+		"slurm_node_cpu_load", "slurm_node_mem_free", "slurm_node_current_watts", "slurm_node_tres_alloc", "slurm_node_features_info")
+	assert.NoError(t, err)
+
+	// Nodes that never booted have no boot time.
+	assert.Equal(t, 2, testutil.CollectAndCount(updater{nc}, "slurm_node_boot_time_seconds"))
+	assert.Equal(t, 3, testutil.CollectAndCount(updater{nc}, "slurm_node_last_busy_time_seconds"))
+	assert.Equal(t, 11, testutil.CollectAndCount(updater{nc}, "slurm_node_tres_configured"))
+}
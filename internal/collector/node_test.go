@@ -1,9 +1,13 @@
 package collector
 
 import (
+	"errors"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sckyzo/slurm_exporter/internal/logger"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -33,7 +37,7 @@ func TestNodeMetrics(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Can not open test data: %v", err)
 	}
-	metrics := ParseNodeMetrics(data)
+	metrics := ParseNodeMetrics(ParseNodeRecords(data))
 	t.Logf("%+v", metrics)
 
 	assert.Contains(t, metrics, "a048")
@@ -59,3 +63,152 @@ func TestNodeMetrics(t *testing.T) {
 	assert.Contains(t, metrics["b003"].partitions, "gpu")
 	assert.Equal(t, "down", metrics["b003"].nodeStatus)
 }
+
+func TestNodeStateTracker(t *testing.T) {
+	start := time.Date(2024, 5, 2, 12, 0, 0, 0, time.Local)
+	tracker := NewNodeStateTracker()
+
+	// A drained node is seeded from the Timestamp of its reason
+	tracker.Update([]NodeRecord{
+		{Name: "cn001", State: "idle", Timestamp: "Unknown"},
+		{Name: "cn002", State: "drained", Timestamp: "2024-05-02T10:00:00"},
+	}, start)
+	assert.Equal(t, start, tracker.nodes["cn001"].since)
+	assert.Equal(t, 7200.0, tracker.nodes["cn002"].drained)
+
+	// The time between updates goes to the previous state
+	tracker.Update([]NodeRecord{
+		{Name: "cn001", State: "down*", Timestamp: "2024-05-02T12:00:30"},
+		{Name: "cn002", State: "drained", Timestamp: "2024-05-02T10:00:00"},
+	}, start.Add(time.Minute))
+	tracker.Update([]NodeRecord{
+		{Name: "cn001", State: "idle", Timestamp: "Unknown"},
+		{Name: "cn002", State: "idle", Timestamp: "Unknown"},
+	}, start.Add(3*time.Minute))
+	assert.Equal(t, 120.0, tracker.nodes["cn001"].down)
+	assert.Equal(t, 7380.0, tracker.nodes["cn002"].drained)
+	assert.Equal(t, start.Add(3*time.Minute), tracker.nodes["cn002"].since)
+	assert.Equal(t, map[NodeTransition]float64{
+		{Node: "cn001", From: "idle", To: "down"}:    1,
+		{Node: "cn001", From: "down", To: "idle"}:    1,
+		{Node: "cn002", From: "drained", To: "idle"}: 1,
+	}, tracker.transitions)
+
+	// An older snapshot applied late is ignored
+	tracker.Update([]NodeRecord{
+		{Name: "cn001", State: "down*", Timestamp: "2024-05-02T12:00:30"},
+		{Name: "cn002", State: "drained", Timestamp: "2024-05-02T10:00:00"},
+	}, start.Add(2*time.Minute))
+	assert.Equal(t, "idle", tracker.nodes["cn001"].state)
+	assert.Len(t, tracker.transitions, 3)
+
+	// Nodes that are gone are forgotten
+	tracker.Update([]NodeRecord{{Name: "cn001", State: "idle"}}, start.Add(4*time.Minute))
+	assert.NotContains(t, tracker.nodes, "cn002")
+	assert.Len(t, tracker.transitions, 2)
+}
+
+// TestNodeCollectorScontrolDown checks that the sinfo metrics and the state
+// history are still exported, without an error, when scontrol fails.
+func TestNodeCollectorScontrolDown(t *testing.T) {
+	oldExecute := Execute
+	defer func() { Execute = oldExecute }()
+	Execute = func(logger *logger.Logger, command string, args []string) ([]byte, error) {
+		if command == "scontrol" {
+			return nil, errors.New("exit status 1")
+		}
+		return os.ReadFile("../../test_data/sinfo_mem.txt")
+	}
+
+	nc := NewNodeCollector(logger.NewLogger("error"))
+	ch := make(chan prometheus.Metric, 1000)
+	err := nc.Update(NewSnapshot(logger.NewLogger("error")), ch)
+	close(ch)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, nc.tracker.nodes)
+
+	names := make(map[string]bool)
+	for m := range ch {
+		names[m.Desc().String()] = true
+	}
+	assert.True(t, names[nc.cpuAlloc.String()])
+	assert.True(t, names[nc.stateTime.String()])
+	assert.True(t, names[nc.drainedTime.String()])
+	assert.False(t, names[nc.powerState.String()])
+}
+
+func TestNodePowerTracker(t *testing.T) {
+	start := time.Date(2024, 5, 2, 12, 0, 0, 0, time.Local)
+	tracker := NewNodePowerTracker()
+	node := func(name, state, reason string) NodeDetail {
+		return NodeDetail{Name: name, Fields: map[string]string{"State": state, "Reason": reason}}
+	}
+
+	resumed, failed := tracker.Update([]NodeDetail{
+		node("cloud001", "IDLE+CLOUD+POWERING_UP", ""),
+		node("cloud002", "IDLE+CLOUD+POWERING_UP", ""),
+		node("cloud003", "ALLOCATED+CLOUD+POWERING_UP", ""),
+		node("cloud004", "IDLE+CLOUD+POWERED_DOWN", ""),
+	}, start)
+	assert.Empty(t, resumed)
+	assert.Zero(t, failed)
+	assert.Len(t, tracker.resuming, 3)
+
+	// A resume is timed from the first update that saw the node powering up
+	resumed, failed = tracker.Update([]NodeDetail{
+		node("cloud001", "IDLE+CLOUD+POWERING_UP", ""),
+		node("cloud002", "ALLOCATED+CLOUD", ""),
+		node("cloud003", "DOWN+CLOUD+POWERED_DOWN", "ResumeTimeout reached"),
+		node("cloud004", "IDLE+CLOUD+POWERED_DOWN", ""),
+	}, start.Add(3*time.Minute))
+	assert.Equal(t, []float64{180}, resumed)
+	assert.Equal(t, 1, failed)
+	assert.Equal(t, map[string]time.Time{"cloud001": start}, tracker.resuming)
+
+	// Nodes that are gone are forgotten
+	resumed, failed = tracker.Update([]NodeDetail{node("cloud004", "IDLE+CLOUD+POWERING_UP", "")}, start.Add(4*time.Minute))
+	assert.Empty(t, resumed)
+	assert.Zero(t, failed)
+	assert.Equal(t, map[string]time.Time{"cloud004": start.Add(4 * time.Minute)}, tracker.resuming)
+}
+
+func TestNodePowerState(t *testing.T) {
+	data, err := os.ReadFile("../../test_data/scontrol_nodes_cloud.txt")
+	assert.NoError(t, err)
+	details := ParseNodeDetails(data)
+	assert.Equal(t, "RESUME", details[4].Fields["NextState"])
+	states := make(map[string]string)
+	for _, detail := range details {
+		_, flags := ParseNodeState(detail.Fields["State"])
+		states[detail.Name] = NodePowerState(flags)
+	}
+	assert.Equal(t, map[string]string{
+		"cloud001": "powered_down",
+		"cloud002": "powering_up",
+		"cloud003": "powering_down",
+		"cloud004": "powered_down",
+		"cloud005": "on",
+	}, states)
+}
+
+func TestParseNodeState(t *testing.T) {
+	for _, tc := range []struct {
+		state string
+		base  string
+		flags []string
+	}{
+		{"IDLE", "idle", nil},
+		{"idle+drain", "idle", []string{"drain"}},
+		{"MIXED+DRAIN", "mixed", []string{"drain", "draining"}},
+		{"mixed+planned", "mixed", []string{"planned"}},
+		{"down*+cloud", "down", []string{"cloud", "not_responding"}},
+		{"allocated+completing+maint", "allocated", []string{"completing", "maint"}},
+		{"IDLE+CLOUD+POWERED_DOWN", "idle", []string{"cloud", "powered_down"}},
+		{"idle~", "idle", []string{"powered_down"}},
+		{"DOWN+MAINTENANCE+NOT_RESPONDING", "down", []string{"maint", "not_responding"}},
+	} {
+		base, flags := ParseNodeState(tc.state)
+		assert.Equal(t, tc.base, base, tc.state)
+		assert.Equal(t, tc.flags, flags, tc.state)
+	}
+}
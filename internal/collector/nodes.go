@@ -3,7 +3,6 @@ package collector
 import (
 	"regexp"
 	"sort"
-	"strconv"
 	"strings"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -26,16 +25,6 @@ type NodesMetrics struct {
 	total   map[string]float64
 }
 
-func NodesGetMetrics(logger *logger.Logger, part string) (*NodesMetrics, error) {
-	data, err := NodesData(logger, part)
-	if err != nil {
-		return nil, err
-	}
-	return ParseNodesMetrics(data), nil
-}
-
-
-
 func InitFeatureSet(nm *NodesMetrics, feature_set string) {
 	// This function is intentionally left empty.
 	// It was previously used to initialize map keys, but this is not necessary in Go.
@@ -43,17 +32,12 @@ func InitFeatureSet(nm *NodesMetrics, feature_set string) {
 }
 
 /*
-ParseNodesMetrics parses the output of the sinfo command for node metrics.
-Expected input format: "%D|%T|%b" (Nodes|State|Features).
+ParseNodesMetrics counts the given records of the sinfo snapshot by state
+and active feature set.
 */
-func ParseNodesMetrics(input []byte) *NodesMetrics {
+func ParseNodesMetrics(records []NodeRecord) *NodesMetrics {
 	var nm NodesMetrics
 	var feature_set string
-	lines := strings.Split(string(input), "\n")
-
-	// Sort and remove all the duplicates from the 'sinfo' output
-	sort.Strings(lines)
-	lines_uniq := RemoveDuplicates(lines)
 
 	nm.alloc = make(map[string]float64)
 	nm.comp = make(map[string]float64)
@@ -69,109 +53,121 @@ func ParseNodesMetrics(input []byte) *NodesMetrics {
 	nm.planned = make(map[string]float64)
 	nm.total = make(map[string]float64)
 
-	for _, line := range lines_uniq {
-		if strings.Contains(line, "|") {
-			split := strings.Split(line, "|")
-			state := split[1]
-			count, _ := strconv.ParseFloat(strings.TrimSpace(split[0]), 64)
-			features := strings.Split(split[2], ",")
-			sort.Strings(features)
-			feature_set = strings.Join(features[:], ",")
-			if feature_set == "(null)" {
-				feature_set = "null"
-			}
-			InitFeatureSet(&nm, feature_set)
-			alloc := regexp.MustCompile(`^alloc`)
-			comp := regexp.MustCompile(`^comp`)
-			down := regexp.MustCompile(`^down`)
-			drain := regexp.MustCompile(`^drain`)
-			fail := regexp.MustCompile(`^fail`)
-			err := regexp.MustCompile(`^err`)
-			idle := regexp.MustCompile(`^idle`)
-			maint := regexp.MustCompile(`^maint`)
-			mix := regexp.MustCompile(`^mix`)
-			resv := regexp.MustCompile(`^res`)
-			planned := regexp.MustCompile(`^planned`)
-			switch {
-			case alloc.MatchString(state):
-				nm.alloc[feature_set] += count
-			case comp.MatchString(state):
-				nm.comp[feature_set] += count
-			case down.MatchString(state):
-				nm.down[feature_set] += count
-			case drain.MatchString(state):
-				nm.drain[feature_set] += count
-			case fail.MatchString(state):
-				nm.fail[feature_set] += count
-			case err.MatchString(state):
-				nm.err[feature_set] += count
-			case idle.MatchString(state):
-				nm.idle[feature_set] += count
-			case maint.MatchString(state):
-				nm.maint[feature_set] += count
-			case mix.MatchString(state):
-				nm.mix[feature_set] += count
-			case resv.MatchString(state):
-				nm.resv[feature_set] += count
-			case planned.MatchString(state):
-				nm.planned[feature_set] += count
-			default:
-				nm.other[feature_set] += count
-			}
+	for _, record := range records {
+		state := record.State
+		features := strings.Split(record.Features, ",")
+		sort.Strings(features)
+		feature_set = strings.Join(features[:], ",")
+		if feature_set == "(null)" {
+			feature_set = "null"
+		}
+		InitFeatureSet(&nm, feature_set)
+		alloc := regexp.MustCompile(`^alloc`)
+		comp := regexp.MustCompile(`^comp`)
+		down := regexp.MustCompile(`^down`)
+		drain := regexp.MustCompile(`^drain`)
+		fail := regexp.MustCompile(`^fail`)
+		err := regexp.MustCompile(`^err`)
+		idle := regexp.MustCompile(`^idle`)
+		maint := regexp.MustCompile(`^maint`)
+		mix := regexp.MustCompile(`^mix`)
+		resv := regexp.MustCompile(`^res`)
+		planned := regexp.MustCompile(`^planned`)
+		switch {
+		case alloc.MatchString(state):
+			nm.alloc[feature_set]++
+		case comp.MatchString(state):
+			nm.comp[feature_set]++
+		case down.MatchString(state):
+			nm.down[feature_set]++
+		case drain.MatchString(state):
+			nm.drain[feature_set]++
+		case fail.MatchString(state):
+			nm.fail[feature_set]++
+		case err.MatchString(state):
+			nm.err[feature_set]++
+		case idle.MatchString(state):
+			nm.idle[feature_set]++
+		case maint.MatchString(state):
+			nm.maint[feature_set]++
+		case mix.MatchString(state):
+			nm.mix[feature_set]++
+		case resv.MatchString(state):
+			nm.resv[feature_set]++
+		case planned.MatchString(state):
+			nm.planned[feature_set]++
+		default:
+			nm.other[feature_set]++
 		}
 	}
 	return &nm
 }
 
+// NodeFlags parses the state of every node of the scontrol snapshot once, into
+// the flags shared by ParseNodeFlags and ParseNodePowerStates.
+func NodeFlags(details []NodeDetail) map[string][]string {
+	flags := make(map[string][]string, len(details))
+	for _, detail := range details {
+		_, flags[detail.Name] = ParseNodeState(detail.Fields["State"])
+	}
+	return flags
+}
 
 /*
-NodesData executes the sinfo command to retrieve node information.
-Expected sinfo output format: "%D|%T|%b" (Nodes|State|Features).
+ParseNodeFlags counts the nodes of every partition of the sinfo snapshot by the flags of their
+state in the scontrol snapshot, see ParseNodeState.
 */
-func NodesData(logger *logger.Logger, part string) ([]byte, error) {
-	return Execute(logger, "sinfo", []string{"-h", "-o", "%D|%T|%b", "-p", part})
+func ParseNodeFlags(records []NodeRecord, flags map[string][]string) map[string]map[string]float64 {
+	return countNodesByPartition(records, flags, func(f []string) []string {
+		return f
+	})
 }
 
 /*
-SlurmGetTotal retrieves the total number of nodes from scontrol.
-Expected scontrol output format: one line per node.
+ParseNodePowerStates counts the nodes of every partition of the sinfo snapshot by their power
+saving state in the scontrol snapshot, see NodePowerState.
 */
-func SlurmGetTotal(logger *logger.Logger) (float64, error) {
-	out, err := Execute(logger, "scontrol", []string{"show", "nodes", "-o"})
-	if err != nil {
-		return 0, err
-	}
-	// Filter out empty lines before counting
-	lines := strings.Split(string(out), "\n")
-	count := 0
-	for _, line := range lines {
-		if strings.TrimSpace(line) != "" {
-			count++
+func ParseNodePowerStates(records []NodeRecord, flags map[string][]string) map[string]map[string]float64 {
+	return countNodesByPartition(records, flags, func(f []string) []string {
+		return []string{NodePowerState(f)}
+	})
+}
+
+// countNodesByPartition counts the nodes of every partition by the values
+// derived from their flags. Nodes listed twice in a partition are counted
+// once, and nodes missing from the scontrol snapshot are not counted.
+func countNodesByPartition(records []NodeRecord, flags map[string][]string, values func([]string) []string) map[string]map[string]float64 {
+	counts := make(map[string]map[string]float64)
+	seen := make(map[[2]string]bool)
+	for _, record := range records {
+		key := [2]string{record.Partition, record.Name}
+		nodeFlags, ok := flags[record.Name]
+		if seen[key] || !ok {
+			continue
+		}
+		seen[key] = true
+		for _, value := range values(nodeFlags) {
+			if counts[record.Partition] == nil {
+				counts[record.Partition] = make(map[string]float64)
+			}
+			counts[record.Partition][value]++
 		}
 	}
-	return float64(count), nil
+	return counts
 }
 
 /*
-SlurmGetPartitions retrieves a list of all partitions from sinfo.
-Expected sinfo output format: "%R" (Partition name).
+SlurmGetPartitions returns the sorted list of partitions of the sinfo snapshot.
 */
-func SlurmGetPartitions(logger *logger.Logger) ([]string, error) {
-	out, err := Execute(logger, "sinfo", []string{"-h", "-o", "%R"})
-	if err != nil {
-		return nil, err
-	}
-	partitions := strings.Split(string(out), "\n")
-	// Trim whitespace and remove empty strings
-	var cleanedPartitions []string
-	for _, p := range partitions {
-		p = strings.TrimSpace(p)
-		if p != "" {
-			cleanedPartitions = append(cleanedPartitions, p)
+func SlurmGetPartitions(records []NodeRecord) []string {
+	var partitions []string
+	for _, record := range records {
+		if record.Partition != "" {
+			partitions = append(partitions, record.Partition)
 		}
 	}
-	sort.Strings(cleanedPartitions)
-	return RemoveDuplicates(cleanedPartitions), nil
+	sort.Strings(partitions)
+	return RemoveDuplicates(partitions)
 }
 
 /*
@@ -197,6 +193,8 @@ func NewNodesCollector(logger *logger.Logger) *NodesCollector {
 		resv:    prometheus.NewDesc("slurm_nodes_resv", "Reserved nodes", labelnames, nil),
 		other:   prometheus.NewDesc("slurm_nodes_other", "Nodes reported with an unknown state", labelnames, nil),
 		planned: prometheus.NewDesc("slurm_nodes_planned", "Planned nodes", labelnames, nil),
+		flag:    prometheus.NewDesc("slurm_nodes_state_flag", "Nodes with a state flag, such as drain or maint", []string{"partition", "flag"}, nil),
+		power:   prometheus.NewDesc("slurm_nodes_power_state", "Nodes by power saving state: on, powered_down, powering_up or powering_down", []string{"partition", "state"}, nil),
 		total:   prometheus.NewDesc("slurm_nodes_total", "Total number of nodes", nil, nil),
 		logger:  logger,
 	}
@@ -215,11 +213,12 @@ type NodesCollector struct {
 	resv    *prometheus.Desc
 	other   *prometheus.Desc
 	planned *prometheus.Desc
+	flag    *prometheus.Desc
+	power   *prometheus.Desc
 	total   *prometheus.Desc
 	logger  *logger.Logger
 }
 
-
 func (nc *NodesCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- nc.alloc
 	ch <- nc.comp
@@ -233,6 +232,8 @@ func (nc *NodesCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- nc.resv
 	ch <- nc.other
 	ch <- nc.planned
+	ch <- nc.flag
+	ch <- nc.power
 	ch <- nc.total
 }
 
@@ -242,22 +243,17 @@ func SendFeatureSetMetric(ch chan<- prometheus.Metric, desc *prometheus.Desc, va
 	}
 }
 
-func (nc *NodesCollector) Collect(ch chan<- prometheus.Metric) {
-	partitions, err := SlurmGetPartitions(nc.logger)
+func (nc *NodesCollector) Update(s *Snapshot, ch chan<- prometheus.Metric) error {
+	records, err := s.Nodes()
 	if err != nil {
-		nc.logger.Error("Failed to get partitions", "err", err)
-		return
+		return err
 	}
-	for _, part := range partitions {
-		part = strings.TrimSpace(part)
-		if part == "" {
-			continue
-		}
-		nm, err := NodesGetMetrics(nc.logger, part)
-		if err != nil {
-			nc.logger.Error("Failed to get nodes metrics", "partition", part, "err", err)
-			continue
-		}
+	byPartition := make(map[string][]NodeRecord)
+	for _, record := range records {
+		byPartition[record.Partition] = append(byPartition[record.Partition], record)
+	}
+	for _, part := range SlurmGetPartitions(records) {
+		nm := ParseNodesMetrics(byPartition[part])
 		SendFeatureSetMetric(ch, nc.alloc, prometheus.GaugeValue, nm.alloc, part)
 		SendFeatureSetMetric(ch, nc.comp, prometheus.GaugeValue, nm.comp, part)
 		SendFeatureSetMetric(ch, nc.down, prometheus.GaugeValue, nm.down, part)
@@ -271,10 +267,20 @@ func (nc *NodesCollector) Collect(ch chan<- prometheus.Metric) {
 		SendFeatureSetMetric(ch, nc.other, prometheus.GaugeValue, nm.other, part)
 		SendFeatureSetMetric(ch, nc.planned, prometheus.GaugeValue, nm.planned, part)
 	}
-	total, err := SlurmGetTotal(nc.logger)
+	details, err := s.NodeDetails()
 	if err != nil {
-		nc.logger.Error("Failed to get total nodes", "err", err)
-		return
+		nc.logger.Error("Failed to get node details", "err", err)
+		return nil
 	}
-	ch <- prometheus.MustNewConstMetric(nc.total, prometheus.GaugeValue, total)
-}
\ No newline at end of file
+	ch <- prometheus.MustNewConstMetric(nc.total, prometheus.GaugeValue, float64(len(details)))
+	nodeFlags := NodeFlags(details)
+	for part, flags := range ParseNodeFlags(records, nodeFlags) {
+		for flag, count := range flags {
+			ch <- prometheus.MustNewConstMetric(nc.flag, prometheus.GaugeValue, count, part, flag)
+		}
+	}
+	for part, states := range ParseNodePowerStates(records, nodeFlags) {
+		SendFeatureSetMetric(ch, nc.power, prometheus.GaugeValue, states, part)
+	}
+	return nil
+}
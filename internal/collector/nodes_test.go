@@ -16,10 +16,14 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>. */
 package collector
 
 import (
+	"errors"
 	"io"
 	"os"
 	"testing"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sckyzo/slurm_exporter/internal/logger"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -33,7 +37,7 @@ func TestNodesMetrics(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Can not read test data: %v", err)
 	}
-	nm := ParseNodesMetrics(data)
+	nm := ParseNodesMetrics(ParseNodeRecords(data))
 	assert.Equal(t, 10, int(nm.idle["feature_a,feature_b"]))
 	assert.Equal(t, 10, int(nm.down["feature_a,feature_b"]))
 	assert.Equal(t, 40, int(nm.alloc["feature_a,feature_b"]))
@@ -44,3 +48,57 @@ func TestNodesMetrics(t *testing.T) {
 	assert.Equal(t, 3, int(nm.planned["feature_a"]))
 	assert.Equal(t, 5, int(nm.planned["feature_b"]))
 }
+
+func TestParseNodeFlags(t *testing.T) {
+	data, err := os.ReadFile("../../test_data/scontrol_nodes_flags.txt")
+	assert.NoError(t, err)
+	records := []NodeRecord{
+		{Name: "node001", Partition: "batch"},
+		{Name: "node002", Partition: "batch"},
+		{Name: "node002", Partition: "debug"},
+		{Name: "gpu001", Partition: "gpu"},
+	}
+
+	assert.Equal(t, map[string]map[string]float64{
+		"batch": {"planned": 1, "drain": 1, "not_responding": 1},
+		"debug": {"drain": 1, "not_responding": 1},
+		"gpu":   {"completing": 1},
+	}, ParseNodeFlags(records, NodeFlags(ParseNodeDetails(data))))
+}
+
+func TestParseNodePowerStates(t *testing.T) {
+	data, err := os.ReadFile("../../test_data/scontrol_nodes_cloud.txt")
+	assert.NoError(t, err)
+	records := []NodeRecord{
+		{Name: "cloud001", Partition: "cloud"},
+		{Name: "cloud002", Partition: "cloud"},
+		{Name: "cloud003", Partition: "cloud"},
+		{Name: "cloud004", Partition: "cloud"},
+		{Name: "cloud005", Partition: "cloud"},
+		{Name: "cloud005", Partition: "debug"},
+		{Name: "unknown", Partition: "debug"},
+	}
+
+	assert.Equal(t, map[string]map[string]float64{
+		"cloud": {"powered_down": 2, "powering_up": 1, "powering_down": 1, "on": 1},
+		"debug": {"on": 1},
+	}, ParseNodePowerStates(records, NodeFlags(ParseNodeDetails(data))))
+}
+
+// TestNodesCollectorScontrolDown checks that the per-state counts from sinfo
+// are still exported, without an error, when scontrol fails.
+func TestNodesCollectorScontrolDown(t *testing.T) {
+	oldExecute := Execute
+	defer func() { Execute = oldExecute }()
+	Execute = func(logger *logger.Logger, command string, args []string) ([]byte, error) {
+		if command == "scontrol" {
+			return nil, errors.New("exit status 1")
+		}
+		return os.ReadFile("../../test_data/sinfo_mem.txt")
+	}
+
+	nc := NewNodesCollector(logger.NewLogger("error"))
+	assert.NoError(t, nc.Update(NewSnapshot(logger.NewLogger("error")), make(chan prometheus.Metric, 1000)))
+	assert.Positive(t, testutil.CollectAndCount(updater{nc}, "slurm_nodes_mix"))
+	assert.Zero(t, testutil.CollectAndCount(updater{nc}, "slurm_nodes_total"))
+}
@@ -1,29 +1,10 @@
 package collector
 
 import (
-	"strconv"
-	"strings"
-
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sckyzo/slurm_exporter/internal/logger"
 )
 
-/*
-PartitionsData executes the sinfo command to retrieve partition CPU information.
-Expected sinfo output format: "%R,%C" (PartitionName,Alloc/Idle/Other/Total CPUs).
-*/
-func PartitionsData(logger *logger.Logger) ([]byte, error) {
-	return Execute(logger, "sinfo", []string{"-h", "-o", "%R,%C"})
-}
-
-/*
-PartitionsPendingJobsData executes the squeue command to retrieve pending job counts per partition.
-Expected squeue output format: "%P" (PartitionName).
-*/
-func PartitionsPendingJobsData(logger *logger.Logger) ([]byte, error) {
-	return Execute(logger, "squeue", []string{"-a", "-r", "-h", "-o", "%P", "--states=PENDING"})
-}
-
 type PartitionMetrics struct {
 	allocated float64
 	idle      float64
@@ -33,50 +14,34 @@ type PartitionMetrics struct {
 }
 
 /*
-ParsePartitionsMetrics parses the output of sinfo and squeue for partition metrics.
-It combines CPU allocation data from sinfo ("%R,%C") with pending job counts from squeue ("%P").
+ParsePartitionsMetrics combines the CPU states of the nodes listed in each
+partition with the number of pending jobs per partition.
 */
-func ParsePartitionsMetrics(logger *logger.Logger) (map[string]*PartitionMetrics, error) {
+func ParsePartitionsMetrics(nodes []NodeRecord, jobs []Job) map[string]*PartitionMetrics {
 	partitions := make(map[string]*PartitionMetrics)
-	partitionsData, err := PartitionsData(logger)
-	if err != nil {
-		return nil, err
-	}
-	lines := strings.Split(string(partitionsData), "\n")
-	for _, line := range lines {
-		if strings.Contains(line, ",") {
-			
-			partition := strings.Split(line, ",")[0]
-			_, key := partitions[partition]
-			if !key {
-				partitions[partition] = &PartitionMetrics{0, 0, 0, 0, 0}
-			}
-			states := strings.Split(line, ",")[1]
-			allocated, _ := strconv.ParseFloat(strings.Split(states, "/")[0], 64)
-			idle, _ := strconv.ParseFloat(strings.Split(states, "/")[1], 64)
-			other, _ := strconv.ParseFloat(strings.Split(states, "/")[2], 64)
-			total, _ := strconv.ParseFloat(strings.Split(states, "/")[3], 64)
-			partitions[partition].allocated = allocated
-			partitions[partition].idle = idle
-			partitions[partition].other = other
-			partitions[partition].total = total
+	for _, node := range nodes {
+		partition := node.Partition
+		_, key := partitions[partition]
+		if !key {
+			partitions[partition] = &PartitionMetrics{0, 0, 0, 0, 0}
 		}
+		partitions[partition].allocated += node.CPUs.alloc
+		partitions[partition].idle += node.CPUs.idle
+		partitions[partition].other += node.CPUs.other
+		partitions[partition].total += node.CPUs.total
 	}
-	
-	pendingJobsData, err := PartitionsPendingJobsData(logger)
-	if err != nil {
-		return nil, err
-	}
-	list := strings.Split(string(pendingJobsData), "\n")
-	for _, partition := range list {
-		
-		_, key := partitions[partition]
+
+	for _, job := range jobs {
+		if job.State != "PENDING" {
+			continue
+		}
+		_, key := partitions[job.Partition]
 		if key {
-			partitions[partition].pending += 1
+			partitions[job.Partition].pending += 1
 		}
 	}
 
-	return partitions, nil
+	return partitions
 }
 
 type PartitionsCollector struct {
@@ -108,12 +73,16 @@ func (pc *PartitionsCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- pc.total
 }
 
-func (pc *PartitionsCollector) Collect(ch chan<- prometheus.Metric) {
-	pm, err := ParsePartitionsMetrics(pc.logger)
+func (pc *PartitionsCollector) Update(s *Snapshot, ch chan<- prometheus.Metric) error {
+	nodes, err := s.Nodes()
 	if err != nil {
-		pc.logger.Error("Failed to parse partitions metrics", "err", err)
-		return
+		return err
 	}
+	jobs, err := s.Jobs()
+	if err != nil {
+		return err
+	}
+	pm := ParsePartitionsMetrics(nodes, jobs)
 	for p := range pm {
 		if pm[p].allocated > 0 {
 			ch <- prometheus.MustNewConstMetric(pc.allocated, prometheus.GaugeValue, pm[p].allocated, p)
@@ -131,4 +100,5 @@ func (pc *PartitionsCollector) Collect(ch chan<- prometheus.Metric) {
 			ch <- prometheus.MustNewConstMetric(pc.total, prometheus.GaugeValue, pm[p].total, p)
 		}
 	}
-}
\ No newline at end of file
+	return nil
+}
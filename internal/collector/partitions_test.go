@@ -0,0 +1,23 @@
+package collector
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePartitionsMetrics(t *testing.T) {
+	nodes, err := os.ReadFile("../../test_data/sinfo_partitions.txt")
+	assert.NoError(t, err)
+	jobs, err := os.ReadFile("../../test_data/squeue.txt")
+	assert.NoError(t, err)
+
+	pm := ParsePartitionsMetrics(ParseNodeRecords(nodes), ParseJobs(jobs))
+	assert.Len(t, pm, 2)
+	// The "*" of the default partition is dropped so that its pending
+	// jobs, listed by squeue without it, are counted.
+	assert.NotContains(t, pm, "gpu*")
+	assert.Equal(t, &PartitionMetrics{allocated: 40, idle: 24, other: 0, pending: 4, total: 64}, pm["gpu"])
+	assert.Equal(t, &PartitionMetrics{allocated: 16, idle: 48, other: 0, pending: 0, total: 64}, pm["batch"])
+}
@@ -0,0 +1,115 @@
+package collector
+
+import (
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// PendingMetrics holds the waiting times of the pending jobs of a partition,
+// in seconds.
+type PendingMetrics struct {
+	Age         []float64 // Time since submission
+	EligibleAge []float64 // Time since the job became eligible, for eligible jobs only
+	StartDelay  []float64 // Time until the start expected by the scheduler
+	NoEstimate  float64   // Jobs without an expected start time
+}
+
+/*
+ParsePendingMetrics computes the waiting times of the pending jobs of the squeue snapshot
+at time now, by partition. Expected start times in the past count as a zero delay.
+*/
+func ParsePendingMetrics(jobs []Job, now time.Time) map[string]*PendingMetrics {
+	partitions := make(map[string]*PendingMetrics)
+	for _, job := range jobs {
+		if job.State != "PENDING" {
+			continue
+		}
+		pm, ok := partitions[job.Partition]
+		if !ok {
+			pm = &PendingMetrics{}
+			partitions[job.Partition] = pm
+		}
+		if !job.SubmitTime.IsZero() {
+			pm.Age = append(pm.Age, max(now.Sub(job.SubmitTime).Seconds(), 0))
+		}
+		if !job.EligibleTime.IsZero() && !job.EligibleTime.After(now) {
+			pm.EligibleAge = append(pm.EligibleAge, now.Sub(job.EligibleTime).Seconds())
+		}
+		if job.StartTime.IsZero() {
+			pm.NoEstimate++
+		} else {
+			pm.StartDelay = append(pm.StartDelay, max(job.StartTime.Sub(now).Seconds(), 0))
+		}
+	}
+	return partitions
+}
+
+// newConstHistogram returns a histogram of values with the given buckets.
+func newConstHistogram(desc *prometheus.Desc, buckets []float64, values []float64, labels ...string) prometheus.Metric {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	counts := make(map[float64]uint64, len(buckets))
+	sum := 0.0
+	for _, v := range sorted {
+		sum += v
+	}
+	i := 0
+	for _, bound := range buckets {
+		for i < len(sorted) && sorted[i] <= bound {
+			i++
+		}
+		counts[bound] = uint64(i)
+	}
+	return prometheus.MustNewConstHistogram(desc, uint64(len(sorted)), sum, counts, labels...)
+}
+
+/*
+ * Implement the Prometheus Collector interface and feed the
+ * Slurm pending job metrics into it.
+ * https://godoc.org/github.com/prometheus/client_golang/prometheus#Collector
+ */
+
+// PendingCollector exports how long the pending jobs of every partition have
+// been waiting, and how long they are expected to wait until they start.
+type PendingCollector struct {
+	age         *prometheus.Desc
+	eligibleAge *prometheus.Desc
+	startDelay  *prometheus.Desc
+	noEstimate  *prometheus.Desc
+	logger      *logger.Logger
+}
+
+func NewPendingCollector(logger *logger.Logger) *PendingCollector {
+	labels := []string{"partition"}
+	return &PendingCollector{
+		age:         prometheus.NewDesc("slurm_queue_pending_age_seconds", "Time pending jobs have been waiting since their submission", labels, nil),
+		eligibleAge: prometheus.NewDesc("slurm_queue_pending_eligible_age_seconds", "Time eligible pending jobs have been waiting since they became eligible", labels, nil),
+		startDelay:  prometheus.NewDesc("slurm_queue_pending_start_delay_seconds", "Time until the start of pending jobs expected by the scheduler, as printed by squeue --start", labels, nil),
+		noEstimate:  prometheus.NewDesc("slurm_queue_pending_without_start_estimate", "Pending jobs without a start time expected by the scheduler", labels, nil),
+		logger:      logger,
+	}
+}
+
+func (pc *PendingCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- pc.age
+	ch <- pc.eligibleAge
+	ch <- pc.startDelay
+	ch <- pc.noEstimate
+}
+
+func (pc *PendingCollector) Update(s *Snapshot, ch chan<- prometheus.Metric) error {
+	jobs, err := s.Jobs()
+	if err != nil {
+		return err
+	}
+	for partition, pm := range ParsePendingMetrics(jobs, time.Now()) {
+		ch <- newConstHistogram(pc.age, waitBuckets, pm.Age, partition)
+		ch <- newConstHistogram(pc.eligibleAge, waitBuckets, pm.EligibleAge, partition)
+		ch <- newConstHistogram(pc.startDelay, waitBuckets, pm.StartDelay, partition)
+		ch <- prometheus.MustNewConstMetric(pc.noEstimate, prometheus.GaugeValue, pm.NoEstimate, partition)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package collector
+
+import (
+	"os"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePendingMetrics(t *testing.T) {
+	data, err := os.ReadFile("../../test_data/squeue.txt")
+	assert.NoError(t, err)
+
+	pending := ParsePendingMetrics(ParseJobs(data), parseSlurmTime("2024-05-02T12:00:00"))
+	assert.Len(t, pending, 1)
+	gpu := pending["gpu"]
+	assert.ElementsMatch(t, []float64{600, 7200, 86400, 60}, gpu.Age)
+	// 15452394 is not eligible yet.
+	assert.ElementsMatch(t, []float64{600, 3600, 86400}, gpu.EligibleAge)
+	assert.ElementsMatch(t, []float64{1800, 7200}, gpu.StartDelay)
+	assert.Equal(t, 2.0, gpu.NoEstimate)
+
+	// An expected start time in the past counts as no delay.
+	pending = ParsePendingMetrics(ParseJobs(data), parseSlurmTime("2024-05-02T13:00:00"))
+	assert.ElementsMatch(t, []float64{0, 3600}, pending["gpu"].StartDelay)
+}
+
+func TestNewConstHistogram(t *testing.T) {
+	desc := prometheus.NewDesc("slurm_test_seconds", "Test histogram", []string{"partition"}, nil)
+	h := newConstHistogram(desc, []float64{60, 3600}, []float64{7200, 30, 600, 60}, "gpu")
+
+	var pb dto.Metric
+	assert.NoError(t, h.Write(&pb))
+	assert.Equal(t, uint64(4), pb.GetHistogram().GetSampleCount())
+	assert.Equal(t, 7890.0, pb.GetHistogram().GetSampleSum())
+	buckets := pb.GetHistogram().GetBucket()
+	assert.Len(t, buckets, 2)
+	assert.Equal(t, uint64(2), buckets[0].GetCumulativeCount())
+	assert.Equal(t, uint64(3), buckets[1].GetCumulativeCount())
+}
@@ -1,287 +1,288 @@
 package collector
 
 import (
-	"strconv"
+	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sckyzo/slurm_exporter/internal/logger"
 )
 
-type NNVal map[string]map[string]map[string]float64
-type NVal map[string]map[string]float64
+// QueueDimensions lists the job attributes the queue metrics can be labeled with.
+var QueueDimensions = []string{"user", "account", "partition", "qos", "reason", "state"}
 
-type QueueMetrics struct {
-	pending       NNVal
-	running       NVal
-	suspended     NVal
-	cancelled     NVal
-	completing    NVal
-	completed     NVal
-	configuring   NVal
-	failed        NVal
-	timeout       NVal
-	preempted     NVal
-	node_fail     NVal
-	c_pending     NNVal
-	c_running     NVal
-	c_suspended   NVal
-	c_cancelled   NVal
-	c_completing  NVal
-	c_completed   NVal
-	c_configuring NVal
-	c_failed      NVal
-	c_timeout     NVal
-	c_preempted   NVal
-	c_node_fail   NVal
+// queueFamilies lists the job states exported by the QueueCollector, each as
+// a pair of slurm_queue_<name> and slurm_cores_<name> metrics.
+var queueFamilies = []struct {
+	state, name, jobsHelp, coresHelp string
+}{
+	{"PENDING", "pending", "Pending jobs in queue", "Pending cores in queue"},
+	{"RUNNING", "running", "Running jobs in the cluster", "Running cores in the cluster"},
+	{"SUSPENDED", "suspended", "Suspended jobs in the cluster", "Suspended cores in the cluster"},
+	{"CANCELLED", "cancelled", "Cancelled jobs in the cluster", "Cancelled cores in the cluster"},
+	{"COMPLETING", "completing", "Completing jobs in the cluster", "Completing cores in the cluster"},
+	{"COMPLETED", "completed", "Completed jobs in the cluster", "Completed cores in the cluster"},
+	{"CONFIGURING", "configuring", "Configuring jobs in the cluster", "Configuring cores in the cluster"},
+	{"FAILED", "failed", "Number of failed jobs", "Number of failed cores"},
+	{"TIMEOUT", "timeout", "Jobs stopped by timeout", "Cores stopped by timeout"},
+	{"PREEMPTED", "preempted", "Number of preempted jobs", "Number of preempted cores"},
+	{"NODE_FAIL", "node_fail", "Number of jobs stopped due to node fail", "Number of cores stopped due to node fail"},
 }
 
-func QueueGetMetrics(logger *logger.Logger) (*QueueMetrics, error) {
-	data, err := QueueData(logger)
-	if err != nil {
-		return nil, err
+// DefaultQueueLabels returns the label dimensions of every queue family when
+// none are configured: user and partition, plus the reason of pending jobs.
+func DefaultQueueLabels() map[string][]string {
+	labels := make(map[string][]string, len(queueFamilies))
+	for _, f := range queueFamilies {
+		labels[f.name] = []string{"user", "partition"}
 	}
-	return ParseQueueMetrics(data), nil
+	labels["pending"] = []string{"user", "partition", "reason"}
+	return labels
 }
 
-func (s *NVal) Incr(user string, part string, count float64) {
-	child, ok := (*s)[user]
-	if !ok {
-		child = map[string]float64{}
-		(*s)[user] = child
-		child[part] = 0
+/*
+ParseQueueLabels parses label dimensions given as <family>=<dimension>,... such as
+"pending=partition,reason". The family "all" applies to every family not given explicitly,
+and an empty list of dimensions exports a single total. The other families keep the
+defaults of DefaultQueueLabels.
+*/
+func ParseQueueLabels(values map[string]string) (map[string][]string, error) {
+	labels := DefaultQueueLabels()
+	var all []string
+	hasAll := false
+	explicit := make(map[string][]string)
+	for family, value := range values {
+		var dims []string
+		for _, dim := range strings.Split(value, ",") {
+			if dim = strings.TrimSpace(dim); dim == "" {
+				continue
+			}
+			if !slices.Contains(QueueDimensions, dim) {
+				return nil, fmt.Errorf("unknown queue label %q, expected one of %s", dim, strings.Join(QueueDimensions, ", "))
+			}
+			if slices.Contains(dims, dim) {
+				return nil, fmt.Errorf("duplicate queue label %q for %q", dim, family)
+			}
+			dims = append(dims, dim)
+		}
+		if family == "all" {
+			all, hasAll = dims, true
+			continue
+		}
+		if _, ok := labels[family]; !ok {
+			return nil, fmt.Errorf("unknown queue family %q", family)
+		}
+		explicit[family] = dims
+	}
+	for family := range labels {
+		if dims, ok := explicit[family]; ok {
+			labels[family] = dims
+		} else if hasAll {
+			labels[family] = all
+		}
 	}
-	child[part] += count
+	return labels, nil
 }
 
-func (s *NNVal) Incr2(reason string, user string, part string, count float64) {
-	_, ok := (*s)[reason]
-	if !ok {
-		child := map[string]map[string]float64{}
-		(*s)[reason] = child
+// jobDimension returns the value of a label dimension of a job.
+func jobDimension(job Job, dim string) string {
+	switch dim {
+	case "user":
+		return job.User
+	case "account":
+		return job.Account
+	case "partition":
+		return job.Partition
+	case "qos":
+		return job.QOS
+	case "reason":
+		return job.Reason
+	case "state":
+		return job.State
 	}
-	child2, ok := (*s)[reason][user]
-	if !ok {
-		child2 = map[string]float64{}
-		(*s)[reason][user] = child2
-	}
-	child2[part] += count
+	return ""
+}
+
+// QueueValue is the number of jobs and cores of a queue family for one
+// combination of label values.
+type QueueValue struct {
+	Labels []string
+	Jobs   float64
+	Cores  float64
 }
 
 /*
-ParseQueueMetrics parses the output of the squeue command for queue metrics.
-Expected input format: "%P,%T,%C,%r,%u" (Partition,State,CPUs,Reason,User).
+ParseQueueMetrics aggregates the jobs of the squeue snapshot by state and by the
+label dimensions of each family. Jobs differing only in dropped dimensions are summed.
+The result maps each family name to its values, keyed by their joined labels.
 */
-func ParseQueueMetrics(input []byte) *QueueMetrics {
-	qm := QueueMetrics{
-		pending:       make(NNVal),
-		running:       make(NVal),
-		suspended:     make(NVal),
-		cancelled:     make(NVal),
-		completing:    make(NVal),
-		completed:     make(NVal),
-		configuring:   make(NVal),
-		failed:        make(NVal),
-		timeout:       make(NVal),
-		preempted:     make(NVal),
-		node_fail:     make(NVal),
-		c_pending:     make(NNVal),
-		c_running:     make(NVal),
-		c_suspended:   make(NVal),
-		c_cancelled:   make(NVal),
-		c_completing:  make(NVal),
-		c_completed:   make(NVal),
-		c_configuring: make(NVal),
-		c_failed:      make(NVal),
-		c_timeout:     make(NVal),
-		c_preempted:   make(NVal),
-		c_node_fail:   make(NVal),
+func ParseQueueMetrics(jobs []Job, labels map[string][]string) map[string]map[string]*QueueValue {
+	families := make(map[string]string, len(queueFamilies))
+	for _, f := range queueFamilies {
+		families[f.state] = f.name
 	}
-	lines := strings.Split(string(input), "\n")
-	for _, line := range lines {
-		if strings.Contains(line, ",") {
-			part := strings.Split(line, ",")[0]
-			part = strings.TrimSpace(part)
-			state := strings.Split(line, ",")[1]
-			cores_i, _ := strconv.Atoi(strings.Split(line, ",")[2])
-			cores := float64(cores_i)
-			user := strings.Split(line, ",")[4]
-			user = strings.TrimSpace(user)
-			reason := strings.Split(line, ",")[3]
-			switch state {
-			case "PENDING":
-				qm.pending.Incr2(reason, user, part, 1)
-				qm.c_pending.Incr2(reason, user, part, cores)
-			case "RUNNING":
-				qm.running.Incr(user, part, 1)
-				qm.c_running.Incr(user, part, cores)
-			case "SUSPENDED":
-				qm.suspended.Incr(user, part, 1)
-				qm.suspended.Incr(user, part, cores)
-			case "CANCELLED":
-				qm.cancelled.Incr(user, part, 1)
-				qm.c_cancelled.Incr(user, part, cores)
-			case "COMPLETING":
-				qm.completing.Incr(user, part, 1)
-				qm.c_completing.Incr(user, part, cores)
-			case "COMPLETED":
-				qm.completed.Incr(user, part, 1)
-				qm.c_completed.Incr(user, part, cores)
-			case "CONFIGURING":
-				qm.configuring.Incr(user, part, 1)
-				qm.c_configuring.Incr(user, part, cores)
-			case "FAILED":
-				qm.failed.Incr(user, part, 1)
-				qm.c_failed.Incr(user, part, cores)
-			case "TIMEOUT":
-				qm.timeout.Incr(user, part, 1)
-				qm.c_timeout.Incr(user, part, cores)
-			case "PREEMPTED":
-				qm.preempted.Incr(user, part, 1)
-				qm.c_preempted.Incr(user, part, cores)
-			case "NODE_FAIL":
-				qm.node_fail.Incr(user, part, 1)
-				qm.c_node_fail.Incr(user, part, cores)
-			}
+	qm := make(map[string]map[string]*QueueValue)
+	for _, job := range jobs {
+		family, ok := families[job.State]
+		if !ok {
+			continue
+		}
+		values := make([]string, len(labels[family]))
+		for i, dim := range labels[family] {
+			values[i] = jobDimension(job, dim)
 		}
+		key := strings.Join(values, "\x00")
+		if qm[family] == nil {
+			qm[family] = make(map[string]*QueueValue)
+		}
+		v, ok := qm[family][key]
+		if !ok {
+			v = &QueueValue{Labels: values}
+			qm[family][key] = v
+		}
+		v.Jobs++
+		v.Cores += job.CPUs
 	}
-	return &qm
+	return qm
 }
 
+// JobSizeKey identifies the running or pending jobs of a partition.
+type JobSizeKey struct {
+	Partition string
+	State     string // "running" or "pending"
+}
+
+// JobSizes holds the requested resources of a set of jobs, one value per job.
+// Jobs without GPUs, memory or time limit are left out of the corresponding
+// slice.
+type JobSizes struct {
+	CPUs      []float64
+	Nodes     []float64
+	Mem       []float64 // Memory in MB
+	GPUs      []float64
+	TimeLimit []float64 // Time limit in seconds
+}
+
+// jobSizeStates maps the job states of the size histograms to their label.
+var jobSizeStates = map[string]string{"RUNNING": "running", "PENDING": "pending"}
+
 /*
-QueueData executes the squeue command to retrieve queue information.
-Expected squeue output format: "%P,%T,%C,%r,%u" (Partition,State,CPUs,Reason,User).
+ParseJobSizes collects the requested CPUs, nodes, memory, GPUs and time limit of the running
+and pending jobs of the squeue snapshot, by partition and state. Running jobs report their
+allocation, pending jobs their request.
 */
-func QueueData(logger *logger.Logger) ([]byte, error) {
-	return Execute(logger, "squeue", []string{"-h", "-o", "%P,%T,%C,%r,%u"})
+func ParseJobSizes(jobs []Job) map[JobSizeKey]*JobSizes {
+	sizes := make(map[JobSizeKey]*JobSizes)
+	for _, job := range jobs {
+		state, ok := jobSizeStates[job.State]
+		if !ok {
+			continue
+		}
+		key := JobSizeKey{Partition: job.Partition, State: state}
+		js, ok := sizes[key]
+		if !ok {
+			js = &JobSizes{}
+			sizes[key] = js
+		}
+		js.CPUs = append(js.CPUs, job.CPUs)
+		js.Nodes = append(js.Nodes, job.Nodes)
+		if mem := job.TRES["mem"]; mem > 0 {
+			js.Mem = append(js.Mem, mem)
+		}
+		if gpus := job.TRES["gres/gpu"]; gpus > 0 {
+			js.GPUs = append(js.GPUs, gpus)
+		}
+		if job.TimeLimit > 0 {
+			js.TimeLimit = append(js.TimeLimit, job.TimeLimit)
+		}
+	}
+	return sizes
 }
 
+var (
+	jobCPUBuckets       = prometheus.ExponentialBuckets(1, 2, 13)    // 1 to 4096 CPUs
+	jobNodeBuckets      = prometheus.ExponentialBuckets(1, 2, 10)    // 1 to 512 nodes
+	jobMemBuckets       = prometheus.ExponentialBuckets(1024, 2, 11) // 1 GB to 1 TB
+	jobGPUBuckets       = prometheus.ExponentialBuckets(1, 2, 8)     // 1 to 128 GPUs
+	jobTimeLimitBuckets = []float64{900, 1800, 3600, 7200, 14400, 28800, 43200, 86400, 172800, 345600, 604800, 1209600}
+)
+
 /*
  * Implement the Prometheus Collector interface and feed the
  * Slurm queue metrics into it.
  * https://godoc.org/github.com/prometheus/client_golang/prometheus#Collector
  */
 
-func NewQueueCollector(logger *logger.Logger) *QueueCollector {
-	return &QueueCollector{
-		pending:           prometheus.NewDesc("slurm_queue_pending", "Pending jobs in queue", []string{"user", "partition", "reason"}, nil),
-		running:           prometheus.NewDesc("slurm_queue_running", "Running jobs in the cluster", []string{"user", "partition"}, nil),
-		suspended:         prometheus.NewDesc("slurm_queue_suspended", "Suspended jobs in the cluster", []string{"user", "partition"}, nil),
-		cancelled:         prometheus.NewDesc("slurm_queue_cancelled", "Cancelled jobs in the cluster", []string{"user", "partition"}, nil),
-		completing:        prometheus.NewDesc("slurm_queue_completing", "Completing jobs in the cluster", []string{"user", "partition"}, nil),
-		completed:         prometheus.NewDesc("slurm_queue_completed", "Completed jobs in the cluster", []string{"user", "partition"}, nil),
-		configuring:       prometheus.NewDesc("slurm_queue_configuring", "Configuring jobs in the cluster", []string{"user", "partition"}, nil),
-		failed:            prometheus.NewDesc("slurm_queue_failed", "Number of failed jobs", []string{"user", "partition"}, nil),
-		timeout:           prometheus.NewDesc("slurm_queue_timeout", "Jobs stopped by timeout", []string{"user", "partition"}, nil),
-		preempted:         prometheus.NewDesc("slurm_queue_preempted", "Number of preempted jobs", []string{"user", "partition"}, nil),
-		node_fail:         prometheus.NewDesc("slurm_queue_node_fail", "Number of jobs stopped due to node fail", []string{"user", "partition"}, nil),
-		cores_pending:     prometheus.NewDesc("slurm_cores_pending", "Pending cores in queue", []string{"user", "partition", "reason"}, nil),
-		cores_running:     prometheus.NewDesc("slurm_cores_running", "Running cores in the cluster", []string{"user", "partition"}, nil),
-		cores_suspended:   prometheus.NewDesc("slurm_cores_suspended", "Suspended cores in the cluster", []string{"user", "partition"}, nil),
-		cores_cancelled:   prometheus.NewDesc("slurm_cores_cancelled", "Cancelled cores in the cluster", []string{"user", "partition"}, nil),
-		cores_completing:  prometheus.NewDesc("slurm_cores_completing", "Completing cores in the cluster", []string{"user", "partition"}, nil),
-		cores_completed:   prometheus.NewDesc("slurm_cores_completed", "Completed cores in the cluster", []string{"user", "partition"}, nil),
-		cores_configuring: prometheus.NewDesc("slurm_cores_configuring", "Configuring cores in the cluster", []string{"user", "partition"}, nil),
-		cores_failed:      prometheus.NewDesc("slurm_cores_failed", "Number of failed cores", []string{"user", "partition"}, nil),
-		cores_timeout:     prometheus.NewDesc("slurm_cores_timeout", "Cores stopped by timeout", []string{"user", "partition"}, nil),
-		cores_preempted:   prometheus.NewDesc("slurm_cores_preempted", "Number of preempted cores", []string{"user", "partition"}, nil),
-		cores_node_fail:   prometheus.NewDesc("slurm_cores_node_fail", "Number of cores stopped due to node fail", []string{"user", "partition"}, nil),
-		logger:            logger,
+// NewQueueCollector creates a QueueCollector labeling each family with the
+// given dimensions, see ParseQueueLabels. A nil map selects the defaults.
+func NewQueueCollector(logger *logger.Logger, labels map[string][]string) *QueueCollector {
+	if labels == nil {
+		labels = DefaultQueueLabels()
 	}
+	sizeLabels := []string{"partition", "state"}
+	qc := &QueueCollector{
+		labels:       labels,
+		jobs:         make(map[string]*prometheus.Desc),
+		cores:        make(map[string]*prometheus.Desc),
+		jobCPUs:      prometheus.NewDesc("slurm_queue_job_cpus", "CPUs of running and pending jobs", sizeLabels, nil),
+		jobNodes:     prometheus.NewDesc("slurm_queue_job_nodes", "Nodes of running and pending jobs", sizeLabels, nil),
+		jobMem:       prometheus.NewDesc("slurm_queue_job_mem", "Memory of running and pending jobs in MB", sizeLabels, nil),
+		jobGPUs:      prometheus.NewDesc("slurm_queue_job_gpus", "GPUs of running and pending jobs with GPUs", sizeLabels, nil),
+		jobTimeLimit: prometheus.NewDesc("slurm_queue_job_time_limit_seconds", "Time limit of running and pending jobs with a time limit", sizeLabels, nil),
+		logger:       logger,
+	}
+	for _, f := range queueFamilies {
+		qc.jobs[f.name] = prometheus.NewDesc("slurm_queue_"+f.name, f.jobsHelp, labels[f.name], nil)
+		qc.cores[f.name] = prometheus.NewDesc("slurm_cores_"+f.name, f.coresHelp, labels[f.name], nil)
+	}
+	return qc
 }
 
 type QueueCollector struct {
-	pending           *prometheus.Desc
-	running           *prometheus.Desc
-	suspended         *prometheus.Desc
-	cancelled         *prometheus.Desc
-	completing        *prometheus.Desc
-	completed         *prometheus.Desc
-	configuring       *prometheus.Desc
-	failed            *prometheus.Desc
-	timeout           *prometheus.Desc
-	preempted         *prometheus.Desc
-	node_fail         *prometheus.Desc
-	cores_pending     *prometheus.Desc
-	cores_running     *prometheus.Desc
-	cores_suspended   *prometheus.Desc
-	cores_cancelled   *prometheus.Desc
-	cores_completing  *prometheus.Desc
-	cores_completed   *prometheus.Desc
-	cores_configuring *prometheus.Desc
-	cores_failed      *prometheus.Desc
-	cores_timeout     *prometheus.Desc
-	cores_preempted   *prometheus.Desc
-	cores_node_fail   *prometheus.Desc
-	logger            *logger.Logger
+	labels       map[string][]string
+	jobs         map[string]*prometheus.Desc
+	cores        map[string]*prometheus.Desc
+	jobCPUs      *prometheus.Desc
+	jobNodes     *prometheus.Desc
+	jobMem       *prometheus.Desc
+	jobGPUs      *prometheus.Desc
+	jobTimeLimit *prometheus.Desc
+	logger       *logger.Logger
 }
 
 func (qc *QueueCollector) Describe(ch chan<- *prometheus.Desc) {
-	ch <- qc.pending
-	ch <- qc.running
-	ch <- qc.suspended
-	ch <- qc.cancelled
-	ch <- qc.completing
-	ch <- qc.completed
-	ch <- qc.configuring
-	ch <- qc.failed
-	ch <- qc.timeout
-	ch <- qc.preempted
-	ch <- qc.node_fail
-	ch <- qc.cores_pending
-	ch <- qc.cores_running
-	ch <- qc.cores_suspended
-	ch <- qc.cores_cancelled
-	ch <- qc.cores_completing
-	ch <- qc.cores_completed
-	ch <- qc.cores_configuring
-	ch <- qc.cores_failed
-	ch <- qc.cores_timeout
-	ch <- qc.cores_preempted
-	ch <- qc.cores_node_fail
+	for _, f := range queueFamilies {
+		ch <- qc.jobs[f.name]
+		ch <- qc.cores[f.name]
+	}
+	ch <- qc.jobCPUs
+	ch <- qc.jobNodes
+	ch <- qc.jobMem
+	ch <- qc.jobGPUs
+	ch <- qc.jobTimeLimit
 }
 
-func (qc *QueueCollector) Collect(ch chan<- prometheus.Metric) {
-	qm, err := QueueGetMetrics(qc.logger)
+func (qc *QueueCollector) Update(s *Snapshot, ch chan<- prometheus.Metric) error {
+	jobs, err := s.Jobs()
 	if err != nil {
-		qc.logger.Error("Failed to get queue metrics", "err", err)
-		return
-	}
-	for reason, values := range qm.pending {
-		PushMetric(values, ch, qc.pending, reason)
-	}
-
-	PushMetric(qm.running, ch, qc.running, "")
-	PushMetric(qm.cancelled, ch, qc.cancelled, "")
-	PushMetric(qm.completing, ch, qc.completing, "")
-	PushMetric(qm.completed, ch, qc.completed, "")
-	PushMetric(qm.configuring, ch, qc.configuring, "")
-	PushMetric(qm.failed, ch, qc.failed, "")
-	PushMetric(qm.timeout, ch, qc.timeout, "")
-	PushMetric(qm.preempted, ch, qc.preempted, "")
-	PushMetric(qm.node_fail, ch, qc.node_fail, "")
-	for reason, value := range qm.c_pending {
-		PushMetric(value, ch, qc.cores_pending, reason)
+		return err
 	}
-	PushMetric(qm.c_running, ch, qc.cores_running, "")
-	PushMetric(qm.c_cancelled, ch, qc.cores_cancelled, "")
-	PushMetric(qm.c_completing, ch, qc.cores_completing, "")
-	PushMetric(qm.c_completed, ch, qc.cores_completed, "")
-	PushMetric(qm.c_configuring, ch, qc.cores_configuring, "")
-	PushMetric(qm.c_failed, ch, qc.cores_failed, "")
-	PushMetric(qm.c_timeout, ch, qc.cores_timeout, "")
-	PushMetric(qm.c_preempted, ch, qc.cores_preempted, "")
-	PushMetric(qm.c_node_fail, ch, qc.cores_node_fail, "")
-}
-
-func PushMetric(m map[string]map[string]float64, ch chan<- prometheus.Metric, coll *prometheus.Desc, a_label string) {
-	for label1, vals1 := range m {
-		for label2, val := range vals1 {
-			if a_label != "" {
-				ch <- prometheus.MustNewConstMetric(coll, prometheus.GaugeValue, val, label1, label2, a_label)
-			} else {
-				ch <- prometheus.MustNewConstMetric(coll, prometheus.GaugeValue, val, label1, label2)
-			}
+	// Pending array tasks count as one job, as they did before the
+	// snapshot expanded them. The size histograms keep every task, as each
+	// requests its own resources.
+	for family, values := range ParseQueueMetrics(collapseArrays(jobs), qc.labels) {
+		for _, v := range values {
+			ch <- prometheus.MustNewConstMetric(qc.jobs[family], prometheus.GaugeValue, v.Jobs, v.Labels...)
+			ch <- prometheus.MustNewConstMetric(qc.cores[family], prometheus.GaugeValue, v.Cores, v.Labels...)
 		}
 	}
+	for key, js := range ParseJobSizes(jobs) {
+		ch <- newConstHistogram(qc.jobCPUs, jobCPUBuckets, js.CPUs, key.Partition, key.State)
+		ch <- newConstHistogram(qc.jobNodes, jobNodeBuckets, js.Nodes, key.Partition, key.State)
+		ch <- newConstHistogram(qc.jobMem, jobMemBuckets, js.Mem, key.Partition, key.State)
+		ch <- newConstHistogram(qc.jobGPUs, jobGPUBuckets, js.GPUs, key.Partition, key.State)
+		ch <- newConstHistogram(qc.jobTimeLimit, jobTimeLimitBuckets, js.TimeLimit, key.Partition, key.State)
+	}
+	return nil
 }
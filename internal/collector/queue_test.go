@@ -18,7 +18,13 @@ package collector
 import (
 	"io"
 	"os"
+	"strings"
 	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestParseQueueMetrics(t *testing.T) {
@@ -31,5 +37,121 @@ func TestParseQueueMetrics(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Can not read test data: %v", err)
 	}
-	t.Logf("%+v", ParseQueueMetrics(data))
+	qm := ParseQueueMetrics(ParseJobs(data), DefaultQueueLabels())
+	t.Logf("%+v", qm)
+	assert.Equal(t, &QueueValue{Labels: []string{"bar", "gpu", "Licenses"}, Jobs: 4, Cores: 48}, qm["pending"]["bar\x00gpu\x00Licenses"])
+	assert.Equal(t, &QueueValue{Labels: []string{"foo", "batch"}, Jobs: 19, Cores: 228}, qm["running"]["foo\x00batch"])
+	assert.Len(t, qm["suspended"], 1)
+}
+
+func TestParseQueueMetricsDroppedLabels(t *testing.T) {
+	data, err := os.ReadFile("../../test_data/squeue.txt")
+	assert.NoError(t, err)
+
+	labels, err := ParseQueueLabels(map[string]string{"all": "", "pending": "qos"})
+	assert.NoError(t, err)
+	assert.Empty(t, labels["running"])
+
+	// Running jobs of every user and partition are summed into a single total.
+	qm := ParseQueueMetrics(ParseJobs(data), labels)
+	assert.Equal(t, map[string]*QueueValue{"": {Labels: []string{}, Jobs: 28, Cores: 336}}, qm["running"])
+	assert.Equal(t, map[string]*QueueValue{"high": {Labels: []string{"high"}, Jobs: 4, Cores: 48}}, qm["pending"])
+}
+
+func TestParseQueueLabels(t *testing.T) {
+	labels, err := ParseQueueLabels(map[string]string{"running": "account, qos"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"account", "qos"}, labels["running"])
+	assert.Equal(t, []string{"user", "partition", "reason"}, labels["pending"])
+
+	_, err = ParseQueueLabels(map[string]string{"running": "node"})
+	assert.Error(t, err)
+	_, err = ParseQueueLabels(map[string]string{"waiting": "user"})
+	assert.Error(t, err)
+	_, err = ParseQueueLabels(map[string]string{"running": "user,user"})
+	assert.Error(t, err)
+}
+
+func TestQueueCollector(t *testing.T) {
+	oldExecute := Execute
+	defer func() { Execute = oldExecute }()
+	Execute = func(logger *logger.Logger, command string, args []string) ([]byte, error) {
+		return os.ReadFile("../../test_data/squeue.txt")
+	}
+
+	labels, err := ParseQueueLabels(map[string]string{"suspended": "account,state"})
+	assert.NoError(t, err)
+	qc := NewQueueCollector(logger.NewLogger("error"), labels)
+	expected := `
+# HELP slurm_cores_suspended Suspended cores in the cluster
+# TYPE slurm_cores_suspended gauge
+slurm_cores_suspended{account="chemistry",state="SUSPENDED"} 12
+# HELP slurm_queue_suspended Suspended jobs in the cluster
+# TYPE slurm_queue_suspended gauge
+slurm_queue_suspended{account="chemistry",state="SUSPENDED"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(updater{qc}, strings.NewReader(expected), "slurm_queue_suspended", "slurm_cores_suspended"))
+	assert.Equal(t, 2, testutil.CollectAndCount(updater{qc}, "slurm_queue_running"))
+	// One histogram per partition and state: batch running, gpu running and gpu pending.
+	assert.Equal(t, 3, testutil.CollectAndCount(updater{qc}, "slurm_queue_job_cpus"))
+}
+
+// TestQueueCollectorArrays checks that a pending array counts as one queued
+// job while every task is a sample of the size histograms.
+func TestQueueCollectorArrays(t *testing.T) {
+	oldExecute := Execute
+	defer func() { Execute = oldExecute }()
+	Execute = func(logger *logger.Logger, command string, args []string) ([]byte, error) {
+		var lines []string
+		for _, task := range []string{"1", "2", "3"} {
+			lines = append(lines, "1003_"+task+"|gpu|PENDING|8|Resources|alice|physics|normal|1|cpu=8,mem=32G,node=1|N/A|2024-05-02T10:00:00|2024-05-02T10:00:00|N/A|2:00:00|md")
+		}
+		return []byte(strings.Join(lines, "\n")), nil
+	}
+
+	qc := NewQueueCollector(logger.NewLogger("error"), nil)
+	expected := `
+# HELP slurm_queue_pending Pending jobs in queue
+# TYPE slurm_queue_pending gauge
+slurm_queue_pending{partition="gpu",reason="Resources",user="alice"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(updater{qc}, strings.NewReader(expected), "slurm_queue_pending"))
+
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(updater{qc})
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+	var samples uint64
+	for _, family := range families {
+		if family.GetName() == "slurm_queue_job_cpus" {
+			samples = family.GetMetric()[0].GetHistogram().GetSampleCount()
+		}
+	}
+	assert.Equal(t, uint64(3), samples)
+}
+
+func TestParseJobSizes(t *testing.T) {
+	jobs := ParseJobs([]byte(strings.Join([]string{
+		"1|gpu|RUNNING|16|None|alice|physics|normal|2|cpu=16,mem=64G,node=2,gres/gpu=4|gres/gpu:2|2024-05-02T10:00:00|2024-05-02T10:00:00|2024-05-02T10:05:00|1-00:00:00|train",
+		"2|gpu|PENDING|8|Resources|bob|physics|normal|1|cpu=8,mem=32G,node=1|N/A|2024-05-02T11:00:00|2024-05-02T11:00:00|N/A|UNLIMITED|prep",
+		"3|gpu|PENDING|4|Priority|bob|physics|normal|1|cpu=4,mem=16G,node=1,gres/gpu=1|gres/gpu:1|2024-05-02T11:00:00|2024-05-02T11:00:00|N/A|2:00:00|eval",
+		"4|gpu|COMPLETED|4|None|bob|physics|normal|1|cpu=4,mem=16G,node=1|N/A|2024-05-02T09:00:00|2024-05-02T09:00:00|2024-05-02T09:00:00|2:00:00|done",
+	}, "\n")))
+
+	sizes := ParseJobSizes(jobs)
+	assert.Len(t, sizes, 2)
+	assert.Equal(t, &JobSizes{
+		CPUs:      []float64{16},
+		Nodes:     []float64{2},
+		Mem:       []float64{65536},
+		GPUs:      []float64{4},
+		TimeLimit: []float64{86400},
+	}, sizes[JobSizeKey{Partition: "gpu", State: "running"}])
+
+	// Jobs without GPUs or time limit are only left out of those histograms.
+	pending := sizes[JobSizeKey{Partition: "gpu", State: "pending"}]
+	assert.Equal(t, []float64{8, 4}, pending.CPUs)
+	assert.Equal(t, []float64{32768, 16384}, pending.Mem)
+	assert.Equal(t, []float64{1}, pending.GPUs)
+	assert.Equal(t, []float64{7200}, pending.TimeLimit)
 }
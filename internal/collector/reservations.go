@@ -84,18 +84,16 @@ func (c *ReservationsCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- c.coreCount
 }
 
-// Collect is called by the Prometheus registry when collecting metrics.
-func (c *ReservationsCollector) Collect(ch chan<- prometheus.Metric) {
-	data, err := c.reservationsData()
+// Update is called by the SlurmCollector when collecting metrics.
+func (c *ReservationsCollector) Update(s *Snapshot, ch chan<- prometheus.Metric) error {
+	data, err := c.reservationsData(s.Cluster())
 	if err != nil {
-		c.logger.Error("Failed to fetch reservation data", "err", err)
-		return
+		return err
 	}
 
 	reservations, err := parseReservations(data)
 	if err != nil {
-		c.logger.Error("Failed to parse reservation data", "err", err)
-		return
+		return err
 	}
 
 	for _, res := range reservations {
@@ -106,14 +104,15 @@ func (c *ReservationsCollector) Collect(ch chan<- prometheus.Metric) {
 		ch <- prometheus.MustNewConstMetric(c.nodeCount, prometheus.GaugeValue, res.NodeCount, res.Name)
 		ch <- prometheus.MustNewConstMetric(c.coreCount, prometheus.GaugeValue, res.CoreCount, res.Name)
 	}
+	return nil
 }
 
 /*
 reservationsData executes the scontrol command to retrieve reservation information.
 Expected scontrol output format: key=value pairs for each reservation, separated by blank lines.
 */
-func (c *ReservationsCollector) reservationsData() ([]byte, error) {
-	return Execute(c.logger, "scontrol", []string{"show", "reservation"})
+func (c *ReservationsCollector) reservationsData(cluster string) ([]byte, error) {
+	return executeOn(c.logger, cluster, "scontrol", []string{"show", "reservation"})
 }
 
 /*
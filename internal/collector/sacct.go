@@ -0,0 +1,269 @@
+package collector
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// sacctStates are the final job states counted by the sacct collector, as
+// passed to "sacct --state".
+const sacctStates = "CD,F,TO,OOM,CA"
+
+// sacctStateLabels maps sacct job states to the values of the state label.
+var sacctStateLabels = map[string]string{
+	"COMPLETED":     "completed",
+	"FAILED":        "failed",
+	"TIMEOUT":       "timeout",
+	"OUT_OF_MEMORY": "out_of_memory",
+	"CANCELLED":     "cancelled",
+}
+
+// SacctJob is a finished job reported by sacct.
+type SacctJob struct {
+	JobID     string
+	Account   string
+	Partition string
+	QOS       string
+	State     string
+	Submit    time.Time
+	Start     time.Time
+	End       time.Time
+}
+
+// sacctOverlap is how far before the high-water mark every window starts.
+// slurmdbd may receive the end of a job late, e.g. while the agent queue of
+// slurmctld drains, after jobs that ended later were already counted.
+const sacctOverlap = 10 * time.Minute
+
+// sacctHighWaterMark records which finished jobs were already counted: every
+// job that ended more than sacctOverlap before Time, the latest end time seen,
+// plus the jobs of Seen, by end time.
+type sacctHighWaterMark struct {
+	Time time.Time            `json:"time"`
+	Seen map[string]time.Time `json:"seen"`
+}
+
+/*
+SacctData executes the sacct command to retrieve the jobs that finished between start and end.
+Expected sacct output format: "JobIDRaw|Account|Partition|QOS|State|Submit|Start|End".
+*/
+func SacctData(logger *logger.Logger, cluster string, start, end time.Time) ([]byte, error) {
+	args := []string{
+		"-a", "-X", "-n", "-P",
+		"-S", start.Format(slurmTimeLayout),
+		"-E", end.Format(slurmTimeLayout),
+		"-s", sacctStates,
+		"-o", "JobIDRaw,Account,Partition,QOS,State,Submit,Start,End",
+	}
+	return executeOn(logger, cluster, "sacct", args)
+}
+
+/*
+ParseSacctJobs parses the output of the sacct command.
+It expects input in the format: "JobIDRaw|Account|Partition|QOS|State|Submit|Start|End".
+Times are in the local time zone; jobs that never started have a zero Start.
+*/
+func ParseSacctJobs(input []byte) []SacctJob {
+	var jobs []SacctJob
+	for _, line := range strings.Split(string(input), "\n") {
+		fields := strings.Split(line, "|")
+		if len(fields) < 8 {
+			continue
+		}
+		// "CANCELLED by 1000" only keeps the state.
+		state := strings.Fields(fields[4])
+		if len(state) == 0 {
+			continue
+		}
+		jobs = append(jobs, SacctJob{
+			JobID:     fields[0],
+			Account:   fields[1],
+			Partition: fields[2],
+			QOS:       fields[3],
+			State:     state[0],
+			Submit:    parseSlurmTime(fields[5]),
+			Start:     parseSlurmTime(fields[6]),
+			End:       parseSlurmTime(fields[7]),
+		})
+	}
+	return jobs
+}
+
+// parseSlurmTime parses a local Slurm timestamp, returning the zero time for
+// values such as "Unknown" or "None".
+func parseSlurmTime(value string) time.Time {
+	t, err := time.ParseInLocation(slurmTimeLayout, value, time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+/*
+ * Implement the Prometheus Collector interface and feed the
+ * Slurm accounting metrics into it.
+ * https://godoc.org/github.com/prometheus/client_golang/prometheus#Collector
+ */
+
+// waitBuckets are the histogram buckets of job wait and run times, from one
+// minute to one week.
+var waitBuckets = []float64{60, 300, 900, 1800, 3600, 7200, 14400, 28800, 86400, 172800, 604800}
+
+// SacctCollector counts the jobs that finished since it started, reading
+// sacct incrementally. A high-water mark, persisted in stateFile when set,
+// ensures that every job is counted once across scrapes and restarts.
+type SacctCollector struct {
+	jobs     *prometheus.CounterVec
+	waitTime *prometheus.HistogramVec
+	runTime  *prometheus.HistogramVec
+
+	lookback  time.Duration
+	stateFile string
+	logger    *logger.Logger
+
+	mu  sync.Mutex
+	hwm sacctHighWaterMark
+}
+
+// NewSacctCollector creates a SacctCollector. Without a high-water mark, and
+// after a long downtime, sacct is queried for the last lookback only.
+func NewSacctCollector(logger *logger.Logger, lookback time.Duration, stateFile string) *SacctCollector {
+	labels := []string{"account", "partition", "qos"}
+	sc := &SacctCollector{
+		jobs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "slurm_sacct_jobs_total",
+			Help: "Jobs finished since the exporter started, by final state",
+		}, append(labels, "state")),
+		waitTime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "slurm_sacct_job_wait_seconds",
+			Help:    "Time finished jobs waited in the queue between submission and start",
+			Buckets: waitBuckets,
+		}, labels),
+		runTime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "slurm_sacct_job_run_seconds",
+			Help:    "Run time of finished jobs",
+			Buckets: waitBuckets,
+		}, labels),
+		lookback:  lookback,
+		stateFile: stateFile,
+		logger:    logger,
+	}
+	if err := sc.loadState(); err != nil {
+		logger.Warn("Failed to load sacct high-water mark, starting from the lookback window", "file", stateFile, "err", err)
+	}
+	return sc
+}
+
+func (sc *SacctCollector) Describe(ch chan<- *prometheus.Desc) {
+	sc.jobs.Describe(ch)
+	sc.waitTime.Describe(ch)
+	sc.runTime.Describe(ch)
+}
+
+func (sc *SacctCollector) Update(s *Snapshot, ch chan<- prometheus.Metric) error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	end := time.Now().Truncate(time.Second)
+	start := sc.hwm.Time.Add(-sacctOverlap)
+	if sc.hwm.Time.IsZero() || start.Before(end.Add(-sc.lookback)) {
+		start = end.Add(-sc.lookback)
+	}
+	data, err := SacctData(sc.logger, s.Cluster(), start, end)
+	if err != nil {
+		return err
+	}
+	sc.count(ParseSacctJobs(data))
+	if err := sc.saveState(); err != nil {
+		sc.logger.Warn("Failed to save sacct high-water mark", "file", sc.stateFile, "err", err)
+	}
+
+	sc.jobs.Collect(ch)
+	sc.waitTime.Collect(ch)
+	sc.runTime.Collect(ch)
+	return nil
+}
+
+// count records the jobs that were not counted yet and moves the mark to the
+// latest end time seen. Jobs that ended more than sacctOverlap before the mark
+// are forgotten.
+func (sc *SacctCollector) count(jobs []SacctJob) {
+	if sc.hwm.Seen == nil {
+		sc.hwm.Seen = make(map[string]time.Time)
+	}
+	forgotten := sc.hwm.Time.Add(-sacctOverlap)
+	for _, job := range jobs {
+		state, ok := sacctStateLabels[job.State]
+		if !ok || job.End.IsZero() || job.End.Before(forgotten) {
+			continue
+		}
+		if _, seen := sc.hwm.Seen[job.JobID]; seen {
+			continue
+		}
+
+		sc.jobs.WithLabelValues(job.Account, job.Partition, job.QOS, state).Inc()
+		if !job.Start.IsZero() {
+			if !job.Submit.IsZero() {
+				sc.waitTime.WithLabelValues(job.Account, job.Partition, job.QOS).Observe(job.Start.Sub(job.Submit).Seconds())
+			}
+			sc.runTime.WithLabelValues(job.Account, job.Partition, job.QOS).Observe(job.End.Sub(job.Start).Seconds())
+		}
+
+		sc.hwm.Seen[job.JobID] = job.End
+		if job.End.After(sc.hwm.Time) {
+			sc.hwm.Time = job.End
+		}
+	}
+	for id, end := range sc.hwm.Seen {
+		if end.Before(sc.hwm.Time.Add(-sacctOverlap)) {
+			delete(sc.hwm.Seen, id)
+		}
+	}
+}
+
+func (sc *SacctCollector) loadState() error {
+	if sc.stateFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(sc.stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &sc.hwm)
+}
+
+// saveState writes the high-water mark through a temporary file, so that a
+// crash never leaves a truncated state file behind.
+func (sc *SacctCollector) saveState() error {
+	if sc.stateFile == "" {
+		return nil
+	}
+	data, err := json.Marshal(sc.hwm)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(sc.stateFile), filepath.Base(sc.stateFile)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), sc.stateFile)
+}
@@ -0,0 +1,105 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSacctJobs(t *testing.T) {
+	data, err := os.ReadFile("../../test_data/sacct.txt")
+	assert.NoError(t, err)
+
+	jobs := ParseSacctJobs(data)
+	assert.Len(t, jobs, 5)
+
+	assert.Equal(t, "1001", jobs[0].JobID)
+	assert.Equal(t, "physics", jobs[0].Account)
+	assert.Equal(t, "batch", jobs[0].Partition)
+	assert.Equal(t, "normal", jobs[0].QOS)
+	assert.Equal(t, "COMPLETED", jobs[0].State)
+	assert.Equal(t, 10*time.Minute, jobs[0].Start.Sub(jobs[0].Submit))
+	assert.Equal(t, time.Hour, jobs[0].End.Sub(jobs[0].Start))
+
+	// Cancelled jobs carry the UID of the user who cancelled them.
+	assert.Equal(t, "CANCELLED", jobs[4].State)
+	assert.True(t, jobs[4].Start.IsZero())
+}
+
+func TestSacctCollectorHighWaterMark(t *testing.T) {
+	data, err := os.ReadFile("../../test_data/sacct.txt")
+	assert.NoError(t, err)
+	jobs := ParseSacctJobs(data)
+	stateFile := filepath.Join(t.TempDir(), "sacct.json")
+
+	sc := NewSacctCollector(logger.NewLogger("error"), time.Hour, stateFile)
+	sc.count(jobs)
+	assert.Equal(t, 1.0, testutil.ToFloat64(sc.jobs.WithLabelValues("physics", "batch", "normal", "completed")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(sc.jobs.WithLabelValues("physics", "batch", "normal", "cancelled")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(sc.jobs.WithLabelValues("chemistry", "gpu", "high", "out_of_memory")))
+	// Only the jobs that ended in the overlap before the mark are remembered.
+	assert.Equal(t, jobs[0].End, sc.hwm.Time)
+	assert.ElementsMatch(t, []string{"1001", "1003", "1005"}, seenJobs(sc.hwm))
+
+	// The next window overlaps the previous one and returns its jobs again;
+	// only the new ones are counted, including a job whose end slurmdbd
+	// received late.
+	next := append(jobs[:0:0], jobs[0], jobs[2], jobs[4], SacctJob{
+		JobID: "1006", Account: "physics", Partition: "batch", QOS: "normal", State: "COMPLETED",
+		Submit: jobs[0].Submit, Start: jobs[0].Start, End: jobs[0].End,
+	}, SacctJob{
+		JobID: "1007", Account: "physics", Partition: "batch", QOS: "normal", State: "COMPLETED",
+		Submit: jobs[0].Submit, Start: jobs[0].Start, End: jobs[0].End.Add(-5 * time.Minute),
+	})
+	sc.count(next)
+	assert.Equal(t, 3.0, testutil.ToFloat64(sc.jobs.WithLabelValues("physics", "batch", "normal", "completed")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(sc.jobs.WithLabelValues("physics", "batch", "normal", "cancelled")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(sc.jobs.WithLabelValues("chemistry", "gpu", "high", "timeout")))
+
+	// The high-water mark survives a restart.
+	assert.NoError(t, sc.saveState())
+	restarted := NewSacctCollector(logger.NewLogger("error"), time.Hour, stateFile)
+	assert.True(t, sc.hwm.Time.Equal(restarted.hwm.Time))
+	assert.ElementsMatch(t, []string{"1001", "1003", "1005", "1006", "1007"}, seenJobs(restarted.hwm))
+	restarted.count(next)
+	assert.Equal(t, 0, testutil.CollectAndCount(restarted.jobs))
+}
+
+// seenJobs returns the IDs of the jobs remembered by a high-water mark.
+func seenJobs(hwm sacctHighWaterMark) []string {
+	var ids []string
+	for id := range hwm.Seen {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestSacctCollectorWindow(t *testing.T) {
+	oldExecute := Execute
+	defer func() { Execute = oldExecute }()
+
+	var args []string
+	Execute = func(logger *logger.Logger, command string, a []string) ([]byte, error) {
+		args = a
+		return []byte{}, nil
+	}
+
+	// Without a high-water mark, the window starts one lookback ago.
+	sc := NewSacctCollector(logger.NewLogger("error"), time.Hour, "")
+	ch := make(chan prometheus.Metric, 10)
+	assert.NoError(t, sc.Update(NewSnapshot(logger.NewLogger("error")), ch))
+	start, err := time.ParseInLocation(slurmTimeLayout, args[5], time.Local)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(-time.Hour), start, 5*time.Second)
+
+	// Otherwise it starts shortly before the high-water mark.
+	sc.hwm.Time = time.Now().Add(-10 * time.Minute).Truncate(time.Second)
+	assert.NoError(t, sc.Update(NewSnapshot(logger.NewLogger("error")), ch))
+	assert.Equal(t, sc.hwm.Time.Add(-sacctOverlap).Format(slurmTimeLayout), args[5])
+}
@@ -4,6 +4,8 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sckyzo/slurm_exporter/internal/logger"
@@ -11,100 +13,165 @@ import (
 
 // SchedulerMetrics holds performance statistics from the Slurm scheduler daemon
 type SchedulerMetrics struct {
+	data_since                        float64            // Start of the statistics (Unix time), 0 if unknown
 	threads                           float64            // Number of scheduler threads
 	queue_size                        float64            // Length of the scheduler queue
+	agent_count                       float64            // Number of agents
+	agent_thread_count                float64            // Number of agent threads
 	dbd_queue_size                    float64            // Length of the DBD agent queue
+	jobs_submitted                    float64            // Jobs submitted since data_since
+	jobs_started                      float64            // Jobs started since data_since
+	jobs_completed                    float64            // Jobs completed since data_since
+	jobs_canceled                     float64            // Jobs canceled since data_since
+	jobs_failed                       float64            // Jobs failed since data_since
+	jobs_pending                      float64            // Pending jobs
+	jobs_running                      float64            // Running jobs
 	last_cycle                        float64            // Last scheduler cycle time (microseconds)
+	max_cycle                         float64            // Max scheduler cycle time (microseconds)
+	total_cycles                      float64            // Number of scheduler cycles since data_since
 	mean_cycle                        float64            // Mean scheduler cycle time (microseconds)
+	mean_depth_cycle                  float64            // Mean number of jobs tested per scheduler cycle
 	cycle_per_minute                  float64            // Number of scheduler cycles per minute
+	last_queue_length                 float64            // Length of the queue of the last scheduler cycle
+	backfill_total_cycles             float64            // Number of backfill cycles since data_since
 	backfill_last_cycle               float64            // Last backfill cycle time (microseconds)
+	backfill_max_cycle                float64            // Max backfill cycle time (microseconds)
 	backfill_mean_cycle               float64            // Mean backfill cycle time (microseconds)
+	backfill_last_depth               float64            // Jobs considered by the last backfill cycle
+	backfill_last_depth_try           float64            // Jobs tested by the last backfill cycle
 	backfill_depth_mean               float64            // Mean backfill depth
+	backfill_depth_mean_try           float64            // Mean number of jobs tested per backfill cycle
+	backfill_last_queue_length        float64            // Length of the queue of the last backfill cycle
+	backfill_queue_length_mean        float64            // Mean length of the backfill queue
+	backfill_last_table_size          float64            // Size of the time slot table of the last backfill cycle
+	backfill_mean_table_size          float64            // Mean size of the backfill time slot table
 	total_backfilled_jobs_since_start float64            // Total backfilled jobs since Slurm start
 	total_backfilled_jobs_since_cycle float64            // Total backfilled jobs since stats cycle start
 	total_backfilled_heterogeneous    float64            // Total backfilled heterogeneous job components
+	gettimeofday_latency              float64            // Latency of 1000 calls to gettimeofday() (microseconds)
 	rpc_stats_count                   map[string]float64 // RPC call counts by operation
 	rpc_stats_avg_time                map[string]float64 // RPC average times by operation
 	rpc_stats_total_time              map[string]float64 // RPC total times by operation
+	rpc_stats_queued                  map[string]float64 // RPCs waiting in the RPC queue by operation
+	rpc_stats_dropped                 map[string]float64 // RPCs dropped from the RPC queue by operation
+	rpc_stats_cycle_last              map[string]float64 // RPCs processed by the last RPC queue cycle by operation
+	rpc_stats_cycle_max               map[string]float64 // Max RPCs processed by an RPC queue cycle by operation
+	rpc_pending                       map[string]float64 // RPCs pending to be sent to the nodes by operation
 	user_rpc_stats_count              map[string]float64 // RPC call counts by user
 	user_rpc_stats_avg_time           map[string]float64 // RPC average times by user
 	user_rpc_stats_total_time         map[string]float64 // RPC total times by user
 }
 
 // SchedulerData executes the sdiag command to retrieve scheduler statistics
-func SchedulerData(logger *logger.Logger) ([]byte, error) {
-	return Execute(logger, "sdiag", nil)
+func SchedulerData(logger *logger.Logger, cluster string) ([]byte, error) {
+	return executeOn(logger, cluster, "sdiag", nil)
 }
 
-// ParseSchedulerMetrics parses the output of the sdiag command
-// It handles the fact that 'Last cycle' and 'Mean cycle' appear twice in sdiag output
-// (once for main scheduler, once for backfill scheduler)
+// sdiagTimeLayout is the format of the timestamps printed by sdiag.
+const sdiagTimeLayout = "Mon Jan _2 15:04:05 2006"
+
+// parseSdiagTime parses an sdiag timestamp such as "Wed Apr 12 02:00:00 2017" into
+// Unix time. Recent versions append the Unix time in parentheses, which is preferred.
+// Invalid values return 0.
+func parseSdiagTime(value string) float64 {
+	value = strings.TrimSpace(value)
+	if date, unix, found := strings.Cut(value, "("); found {
+		if v, err := strconv.ParseFloat(strings.TrimSuffix(unix, ")"), 64); err == nil {
+			return v
+		}
+		value = strings.TrimSpace(date)
+	}
+	t, err := time.ParseInLocation(sdiagTimeLayout, value, time.Local)
+	if err != nil {
+		return 0
+	}
+	return float64(t.Unix())
+}
+
+// ParseSchedulerMetrics parses the output of the sdiag command.
+// Fields such as 'Last cycle' and 'Max cycle' appear twice in sdiag output, once
+// for the main scheduler and once for the backfill scheduler: they are told
+// apart by the section they are in.
 func ParseSchedulerMetrics(input []byte) *SchedulerMetrics {
 	var sm SchedulerMetrics
 	lines := strings.Split(string(input), "\n")
 
-	// Counters to handle duplicate metric names in sdiag output
-	lastCycleCount := 0
-	meanCycleCount := 0
-	// Define regex patterns for matching sdiag output lines
-	patterns := map[string]*regexp.Regexp{
-		"threads":     regexp.MustCompile(`^Server thread`),
-		"queue":       regexp.MustCompile(`^Agent queue`),
-		"dbd":         regexp.MustCompile(`^DBD Agent`),
-		"lastCycle":   regexp.MustCompile(`^[\s]+Last cycle$`),
-		"meanCycle":   regexp.MustCompile(`^[\s]+Mean cycle$`),
-		"cyclesPer":   regexp.MustCompile(`^[\s]+Cycles per`),
-		"depthMean":   regexp.MustCompile(`^[\s]+Depth Mean$`),
-		"totalStart":  regexp.MustCompile(`^[\s]+Total backfilled jobs \(since last slurm start\)`),
-		"totalCycle":  regexp.MustCompile(`^[\s]+Total backfilled jobs \(since last stats cycle start\)`),
-		"totalHetero": regexp.MustCompile(`^[\s]+Total backfilled heterogeneous job components`),
+	fields := map[string]*float64{
+		"Server thread count":  &sm.threads,
+		"Agent queue size":     &sm.queue_size,
+		"Agent count":          &sm.agent_count,
+		"Agent thread count":   &sm.agent_thread_count,
+		"DBD Agent queue size": &sm.dbd_queue_size,
+		"Jobs submitted":       &sm.jobs_submitted,
+		"Jobs started":         &sm.jobs_started,
+		"Jobs completed":       &sm.jobs_completed,
+		"Jobs canceled":        &sm.jobs_canceled,
+		"Jobs failed":          &sm.jobs_failed,
+		"Jobs pending":         &sm.jobs_pending,
+		"Jobs running":         &sm.jobs_running,
+		"Latency for 1000 calls to gettimeofday()": &sm.gettimeofday_latency,
+	}
+	mainFields := map[string]*float64{
+		"Last cycle":        &sm.last_cycle,
+		"Max cycle":         &sm.max_cycle,
+		"Total cycles":      &sm.total_cycles,
+		"Mean cycle":        &sm.mean_cycle,
+		"Mean depth cycle":  &sm.mean_depth_cycle,
+		"Cycles per minute": &sm.cycle_per_minute,
+		"Last queue length": &sm.last_queue_length,
+	}
+	backfillFields := map[string]*float64{
+		"Total backfilled jobs (since last slurm start)":       &sm.total_backfilled_jobs_since_start,
+		"Total backfilled jobs (since last stats cycle start)": &sm.total_backfilled_jobs_since_cycle,
+		"Total backfilled heterogeneous job components":        &sm.total_backfilled_heterogeneous,
+		"Total cycles":                 &sm.backfill_total_cycles,
+		"Last cycle":                   &sm.backfill_last_cycle,
+		"Max cycle":                    &sm.backfill_max_cycle,
+		"Mean cycle":                   &sm.backfill_mean_cycle,
+		"Last depth cycle":             &sm.backfill_last_depth,
+		"Last depth cycle (try sched)": &sm.backfill_last_depth_try,
+		"Depth Mean":                   &sm.backfill_depth_mean,
+		"Depth Mean (try depth)":       &sm.backfill_depth_mean_try,
+		"Last queue length":            &sm.backfill_last_queue_length,
+		"Queue length mean":            &sm.backfill_queue_length_mean,
+		"Last table size":              &sm.backfill_last_table_size,
+		"Mean table size":              &sm.backfill_mean_table_size,
 	}
 
+	// Indented fields belong to the section of the last unindented line
+	var section map[string]*float64
 	for _, line := range lines {
-		if !strings.Contains(line, ":") {
+		if after, found := strings.CutPrefix(line, "Data since"); found {
+			sm.data_since = parseSdiagTime(after)
 			continue
 		}
+		indented := strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")
+		if !indented && line != "" {
+			switch {
+			case strings.HasPrefix(line, "Main schedule statistics"):
+				section = mainFields
+			case strings.HasPrefix(line, "Backfilling stats"):
+				section = backfillFields
+			default:
+				section = nil
+			}
+		}
+		table := fields
+		if indented {
+			table = section
+		}
 
-		parts := strings.Split(line, ":")
-		if len(parts) < 2 {
+		key, value, found := strings.Cut(line, ":")
+		if !found {
 			continue
 		}
-
-		key := parts[0]
-		value := strings.TrimSpace(parts[1])
-		floatValue, _ := strconv.ParseFloat(value, 64)
-
-		switch {
-		case patterns["threads"].MatchString(key):
-			sm.threads = floatValue
-		case patterns["queue"].MatchString(key):
-			sm.queue_size = floatValue
-		case patterns["dbd"].MatchString(key):
-			sm.dbd_queue_size = floatValue
-		case patterns["lastCycle"].MatchString(key):
-			if lastCycleCount == 0 {
-				sm.last_cycle = floatValue
-				lastCycleCount++
-			} else {
-				sm.backfill_last_cycle = floatValue
-			}
-		case patterns["meanCycle"].MatchString(key):
-			if meanCycleCount == 0 {
-				sm.mean_cycle = floatValue
-				meanCycleCount++
-			} else {
-				sm.backfill_mean_cycle = floatValue
-			}
-		case patterns["cyclesPer"].MatchString(key):
-			sm.cycle_per_minute = floatValue
-		case patterns["depthMean"].MatchString(key):
-			sm.backfill_depth_mean = floatValue
-		case patterns["totalStart"].MatchString(key):
-			sm.total_backfilled_jobs_since_start = floatValue
-		case patterns["totalCycle"].MatchString(key):
-			sm.total_backfilled_jobs_since_cycle = floatValue
-		case patterns["totalHetero"].MatchString(key):
-			sm.total_backfilled_heterogeneous = floatValue
+		field, ok := table[strings.TrimSpace(key)]
+		if !ok {
+			continue
+		}
+		// Values may be followed by a unit, such as "21 microseconds"
+		if words := strings.Fields(value); len(words) > 0 {
+			*field, _ = strconv.ParseFloat(words[0], 64)
 		}
 	}
 
@@ -116,6 +183,12 @@ func ParseSchedulerMetrics(input []byte) *SchedulerMetrics {
 	sm.user_rpc_stats_count = rpcStats[3]
 	sm.user_rpc_stats_avg_time = rpcStats[4]
 	sm.user_rpc_stats_total_time = rpcStats[5]
+	queueStats := ParseRpcQueueStats(lines)
+	sm.rpc_stats_queued = queueStats[0]
+	sm.rpc_stats_dropped = queueStats[1]
+	sm.rpc_stats_cycle_last = queueStats[2]
+	sm.rpc_stats_cycle_max = queueStats[3]
+	sm.rpc_pending = ParsePendingRpcStats(lines)
 
 	return &sm
 }
@@ -147,7 +220,8 @@ func ParseRpcStats(lines []string) []map[string]float64 {
 	inRPCPerUser := false
 
 	// Regex to match RPC statistics lines
-	statLineRe := regexp.MustCompile(`^\s*([A-Za-z0-9_]*).*count:([0-9]*)\s*ave_time:([0-9]*)\s\s*total_time:([0-9]*)\s*$`)
+	// With the RPC queue enabled, queue statistics come between count and ave_time
+	statLineRe := regexp.MustCompile(`^\s*([A-Za-z0-9_]*).*count:([0-9]*)\s.*ave_time:([0-9]*)\s\s*total_time:([0-9]*)\s*$`)
 
 	for _, line := range lines {
 		// Detect section transitions
@@ -157,6 +231,9 @@ func ParseRpcStats(lines []string) []map[string]float64 {
 		} else if strings.Contains(line, "Remote Procedure Call statistics by user") {
 			inRPC = false
 			inRPCPerUser = true
+		} else if strings.HasPrefix(line, "Pending RPC") {
+			inRPC = false
+			inRPCPerUser = false
 		}
 
 		// Parse statistics lines in current section
@@ -192,15 +269,120 @@ func ParseRpcStats(lines []string) []map[string]float64 {
 	}
 }
 
+// ParseRpcQueueStats parses the RPC queue statistics of the RPC statistics by message type,
+// printed when the RPC queue of slurmctld is enabled.
+// Returns slice of maps: [queued_stats, dropped_stats, cycle_last_stats, cycle_max_stats]
+func ParseRpcQueueStats(lines []string) []map[string]float64 {
+	queuedStats := make(map[string]float64)
+	droppedStats := make(map[string]float64)
+	cycleLastStats := make(map[string]float64)
+	cycleMaxStats := make(map[string]float64)
+
+	inRPC := false
+	statLineRe := regexp.MustCompile(`^\s*([A-Za-z0-9_]*).*queued:([0-9]*)\s*dropped:([0-9]*)\s*cycle_last:([0-9]*)\s*cycle_max:([0-9]*)\s`)
+
+	for _, line := range lines {
+		if strings.Contains(line, "Remote Procedure Call statistics") {
+			inRPC = strings.Contains(line, "by message type")
+			continue
+		}
+		if !inRPC {
+			continue
+		}
+		if match := statLineRe.FindStringSubmatch(line); match != nil {
+			name := match[1]
+			queuedStats[name], _ = strconv.ParseFloat(match[2], 64)
+			droppedStats[name], _ = strconv.ParseFloat(match[3], 64)
+			cycleLastStats[name], _ = strconv.ParseFloat(match[4], 64)
+			cycleMaxStats[name], _ = strconv.ParseFloat(match[5], 64)
+		}
+	}
+
+	return []map[string]float64{
+		queuedStats,
+		droppedStats,
+		cycleLastStats,
+		cycleMaxStats,
+	}
+}
+
+// ParsePendingRpcStats parses the "Pending RPC statistics" section of sdiag output,
+// the RPCs waiting to be sent to the nodes by operation. The individual RPCs of the
+// "Pending RPCs" section are not parsed.
+func ParsePendingRpcStats(lines []string) map[string]float64 {
+	pending := make(map[string]float64)
+	inPending := false
+	statLineRe := regexp.MustCompile(`^\s*([A-Za-z0-9_]*)\s*\(\s*[0-9]*\)\s*count:([0-9]*)\s*$`)
+
+	for _, line := range lines {
+		if line != "" && !strings.HasPrefix(line, "\t") && !strings.HasPrefix(line, " ") {
+			inPending = strings.HasPrefix(line, "Pending RPC statistics")
+			continue
+		}
+		if !inPending {
+			continue
+		}
+		if match := statLineRe.FindStringSubmatch(line); match != nil {
+			pending[match[1]], _ = strconv.ParseFloat(match[2], 64)
+		}
+	}
+	return pending
+}
+
 // SchedulerGetMetrics retrieves and parses scheduler metrics from Slurm
-func SchedulerGetMetrics(logger *logger.Logger) (*SchedulerMetrics, error) {
-	data, err := SchedulerData(logger)
+func SchedulerGetMetrics(logger *logger.Logger, cluster string) (*SchedulerMetrics, error) {
+	data, err := SchedulerData(logger, cluster)
 	if err != nil {
 		return nil, err
 	}
 	return ParseSchedulerMetrics(data), nil
 }
 
+// sdiagCounters keeps the sdiag counters monotonic across the resets of the
+// statistics, at midnight or by "sdiag -r". A reset is detected by a change of
+// "Data since" or a counter going down: the last value of the counter is then
+// added to its base. The RPC statistics are only cleared by "sdiag -r", so a
+// change of "Data since" leaves them alone and only a decrease resets them.
+// Only the increments between the last scrape and a reset are lost.
+type sdiagCounters struct {
+	mu    sync.Mutex
+	since float64
+	last  map[string]float64
+	base  map[string]float64
+}
+
+func newSdiagCounters() *sdiagCounters {
+	return &sdiagCounters{last: make(map[string]float64), base: make(map[string]float64)}
+}
+
+// reset starts a run with the statistics collected since the Unix time since.
+func (c *sdiagCounters) reset(since float64) {
+	if since != c.since && c.since != 0 {
+		for key, value := range c.last {
+			if !sdiagRPCKey(key) {
+				c.base[key] += value
+				delete(c.last, key)
+			}
+		}
+	}
+	c.since = since
+}
+
+// sdiagRPCKey reports whether key is an RPC counter, keyed by its family and
+// its operation or user separated by a NUL byte.
+func sdiagRPCKey(key string) bool {
+	return strings.Contains(key, "\x00")
+}
+
+// value returns the monotonic value of the counter key, whose sdiag value is v.
+func (c *sdiagCounters) value(key string, v float64) float64 {
+	if last := c.last[key]; v < last {
+		c.base[key] += last
+	}
+	c.last[key] = v
+	return c.base[key] + v
+}
+
 // SchedulerCollector implements the Prometheus Collector interface for scheduler metrics
 type SchedulerCollector struct {
 	threads                           *prometheus.Desc
@@ -215,12 +397,46 @@ type SchedulerCollector struct {
 	total_backfilled_jobs_since_start *prometheus.Desc
 	total_backfilled_jobs_since_cycle *prometheus.Desc
 	total_backfilled_heterogeneous    *prometheus.Desc
+	data_since                        *prometheus.Desc
+	agent_count                       *prometheus.Desc
+	agent_thread_count                *prometheus.Desc
+	jobs_pending                      *prometheus.Desc
+	jobs_running                      *prometheus.Desc
+	max_cycle                         *prometheus.Desc
+	mean_depth_cycle                  *prometheus.Desc
+	last_queue_length                 *prometheus.Desc
+	backfill_max_cycle                *prometheus.Desc
+	backfill_last_depth               *prometheus.Desc
+	backfill_last_depth_try           *prometheus.Desc
+	backfill_depth_mean_try           *prometheus.Desc
+	backfill_last_queue_length        *prometheus.Desc
+	backfill_queue_length_mean        *prometheus.Desc
+	backfill_last_table_size          *prometheus.Desc
+	backfill_mean_table_size          *prometheus.Desc
+	gettimeofday_latency              *prometheus.Desc
+	jobs_submitted                    *prometheus.Desc
+	jobs_started                      *prometheus.Desc
+	jobs_completed                    *prometheus.Desc
+	jobs_canceled                     *prometheus.Desc
+	jobs_failed                       *prometheus.Desc
+	total_cycles                      *prometheus.Desc
+	backfill_total_cycles             *prometheus.Desc
 	rpc_stats_count                   *prometheus.Desc
 	rpc_stats_avg_time                *prometheus.Desc
 	rpc_stats_total_time              *prometheus.Desc
 	user_rpc_stats_count              *prometheus.Desc
 	user_rpc_stats_avg_time           *prometheus.Desc
 	user_rpc_stats_total_time         *prometheus.Desc
+	rpc_stats_queued                  *prometheus.Desc
+	rpc_stats_cycle_last              *prometheus.Desc
+	rpc_stats_cycle_max               *prometheus.Desc
+	rpc_pending                       *prometheus.Desc
+	rpc_calls                         *prometheus.Desc
+	rpc_time                          *prometheus.Desc
+	rpc_dropped                       *prometheus.Desc
+	user_rpc_calls                    *prometheus.Desc
+	user_rpc_time                     *prometheus.Desc
+	counters                          *sdiagCounters
 	logger                            *logger.Logger
 }
 
@@ -237,19 +453,55 @@ func (c *SchedulerCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- c.total_backfilled_jobs_since_start
 	ch <- c.total_backfilled_jobs_since_cycle
 	ch <- c.total_backfilled_heterogeneous
+	ch <- c.data_since
+	ch <- c.agent_count
+	ch <- c.agent_thread_count
+	ch <- c.jobs_pending
+	ch <- c.jobs_running
+	ch <- c.max_cycle
+	ch <- c.mean_depth_cycle
+	ch <- c.last_queue_length
+	ch <- c.backfill_max_cycle
+	ch <- c.backfill_last_depth
+	ch <- c.backfill_last_depth_try
+	ch <- c.backfill_depth_mean_try
+	ch <- c.backfill_last_queue_length
+	ch <- c.backfill_queue_length_mean
+	ch <- c.backfill_last_table_size
+	ch <- c.backfill_mean_table_size
+	ch <- c.gettimeofday_latency
+	ch <- c.jobs_submitted
+	ch <- c.jobs_started
+	ch <- c.jobs_completed
+	ch <- c.jobs_canceled
+	ch <- c.jobs_failed
+	ch <- c.total_cycles
+	ch <- c.backfill_total_cycles
 	ch <- c.rpc_stats_count
 	ch <- c.rpc_stats_avg_time
 	ch <- c.rpc_stats_total_time
 	ch <- c.user_rpc_stats_count
 	ch <- c.user_rpc_stats_avg_time
 	ch <- c.user_rpc_stats_total_time
+	ch <- c.rpc_stats_queued
+	ch <- c.rpc_stats_cycle_last
+	ch <- c.rpc_stats_cycle_max
+	ch <- c.rpc_pending
+	ch <- c.rpc_calls
+	ch <- c.rpc_time
+	ch <- c.rpc_dropped
+	ch <- c.user_rpc_calls
+	ch <- c.user_rpc_time
 }
 
-func (sc *SchedulerCollector) Collect(ch chan<- prometheus.Metric) {
-	sm, err := SchedulerGetMetrics(sc.logger)
+func (sc *SchedulerCollector) Update(s *Snapshot, ch chan<- prometheus.Metric) error {
+	// sdiag runs under the lock of the counters so that concurrent scrapes
+	// apply their outputs in the order they were read.
+	sc.counters.mu.Lock()
+	defer sc.counters.mu.Unlock()
+	sm, err := SchedulerGetMetrics(sc.logger, s.Cluster())
 	if err != nil {
-		sc.logger.Error("Failed to get scheduler metrics", "err", err)
-		return
+		return err
 	}
 	ch <- prometheus.MustNewConstMetric(sc.threads, prometheus.GaugeValue, sm.threads)
 	ch <- prometheus.MustNewConstMetric(sc.queue_size, prometheus.GaugeValue, sm.queue_size)
@@ -263,6 +515,23 @@ func (sc *SchedulerCollector) Collect(ch chan<- prometheus.Metric) {
 	ch <- prometheus.MustNewConstMetric(sc.total_backfilled_jobs_since_start, prometheus.GaugeValue, sm.total_backfilled_jobs_since_start)
 	ch <- prometheus.MustNewConstMetric(sc.total_backfilled_jobs_since_cycle, prometheus.GaugeValue, sm.total_backfilled_jobs_since_cycle)
 	ch <- prometheus.MustNewConstMetric(sc.total_backfilled_heterogeneous, prometheus.GaugeValue, sm.total_backfilled_heterogeneous)
+	ch <- prometheus.MustNewConstMetric(sc.data_since, prometheus.GaugeValue, sm.data_since)
+	ch <- prometheus.MustNewConstMetric(sc.agent_count, prometheus.GaugeValue, sm.agent_count)
+	ch <- prometheus.MustNewConstMetric(sc.agent_thread_count, prometheus.GaugeValue, sm.agent_thread_count)
+	ch <- prometheus.MustNewConstMetric(sc.jobs_pending, prometheus.GaugeValue, sm.jobs_pending)
+	ch <- prometheus.MustNewConstMetric(sc.jobs_running, prometheus.GaugeValue, sm.jobs_running)
+	ch <- prometheus.MustNewConstMetric(sc.max_cycle, prometheus.GaugeValue, sm.max_cycle)
+	ch <- prometheus.MustNewConstMetric(sc.mean_depth_cycle, prometheus.GaugeValue, sm.mean_depth_cycle)
+	ch <- prometheus.MustNewConstMetric(sc.last_queue_length, prometheus.GaugeValue, sm.last_queue_length)
+	ch <- prometheus.MustNewConstMetric(sc.backfill_max_cycle, prometheus.GaugeValue, sm.backfill_max_cycle)
+	ch <- prometheus.MustNewConstMetric(sc.backfill_last_depth, prometheus.GaugeValue, sm.backfill_last_depth)
+	ch <- prometheus.MustNewConstMetric(sc.backfill_last_depth_try, prometheus.GaugeValue, sm.backfill_last_depth_try)
+	ch <- prometheus.MustNewConstMetric(sc.backfill_depth_mean_try, prometheus.GaugeValue, sm.backfill_depth_mean_try)
+	ch <- prometheus.MustNewConstMetric(sc.backfill_last_queue_length, prometheus.GaugeValue, sm.backfill_last_queue_length)
+	ch <- prometheus.MustNewConstMetric(sc.backfill_queue_length_mean, prometheus.GaugeValue, sm.backfill_queue_length_mean)
+	ch <- prometheus.MustNewConstMetric(sc.backfill_last_table_size, prometheus.GaugeValue, sm.backfill_last_table_size)
+	ch <- prometheus.MustNewConstMetric(sc.backfill_mean_table_size, prometheus.GaugeValue, sm.backfill_mean_table_size)
+	ch <- prometheus.MustNewConstMetric(sc.gettimeofday_latency, prometheus.GaugeValue, sm.gettimeofday_latency)
 	for rpc_type, value := range sm.rpc_stats_count {
 		ch <- prometheus.MustNewConstMetric(sc.rpc_stats_count, prometheus.GaugeValue, value, rpc_type)
 	}
@@ -281,7 +550,43 @@ func (sc *SchedulerCollector) Collect(ch chan<- prometheus.Metric) {
 	for user, value := range sm.user_rpc_stats_total_time {
 		ch <- prometheus.MustNewConstMetric(sc.user_rpc_stats_total_time, prometheus.GaugeValue, value, user)
 	}
+	for rpc_type, value := range sm.rpc_stats_queued {
+		ch <- prometheus.MustNewConstMetric(sc.rpc_stats_queued, prometheus.GaugeValue, value, rpc_type)
+	}
+	for rpc_type, value := range sm.rpc_stats_cycle_last {
+		ch <- prometheus.MustNewConstMetric(sc.rpc_stats_cycle_last, prometheus.GaugeValue, value, rpc_type)
+	}
+	for rpc_type, value := range sm.rpc_stats_cycle_max {
+		ch <- prometheus.MustNewConstMetric(sc.rpc_stats_cycle_max, prometheus.GaugeValue, value, rpc_type)
+	}
+	for rpc_type, value := range sm.rpc_pending {
+		ch <- prometheus.MustNewConstMetric(sc.rpc_pending, prometheus.GaugeValue, value, rpc_type)
+	}
 
+	sc.counters.reset(sm.data_since)
+	ch <- prometheus.MustNewConstMetric(sc.jobs_submitted, prometheus.CounterValue, sc.counters.value("jobs_submitted", sm.jobs_submitted))
+	ch <- prometheus.MustNewConstMetric(sc.jobs_started, prometheus.CounterValue, sc.counters.value("jobs_started", sm.jobs_started))
+	ch <- prometheus.MustNewConstMetric(sc.jobs_completed, prometheus.CounterValue, sc.counters.value("jobs_completed", sm.jobs_completed))
+	ch <- prometheus.MustNewConstMetric(sc.jobs_canceled, prometheus.CounterValue, sc.counters.value("jobs_canceled", sm.jobs_canceled))
+	ch <- prometheus.MustNewConstMetric(sc.jobs_failed, prometheus.CounterValue, sc.counters.value("jobs_failed", sm.jobs_failed))
+	ch <- prometheus.MustNewConstMetric(sc.total_cycles, prometheus.CounterValue, sc.counters.value("total_cycles", sm.total_cycles))
+	ch <- prometheus.MustNewConstMetric(sc.backfill_total_cycles, prometheus.CounterValue, sc.counters.value("backfill_total_cycles", sm.backfill_total_cycles))
+	for rpc_type, value := range sm.rpc_stats_count {
+		ch <- prometheus.MustNewConstMetric(sc.rpc_calls, prometheus.CounterValue, sc.counters.value("rpc_calls\x00"+rpc_type, value), rpc_type)
+	}
+	for rpc_type, value := range sm.rpc_stats_total_time {
+		ch <- prometheus.MustNewConstMetric(sc.rpc_time, prometheus.CounterValue, sc.counters.value("rpc_time\x00"+rpc_type, value)/1e6, rpc_type)
+	}
+	for rpc_type, value := range sm.rpc_stats_dropped {
+		ch <- prometheus.MustNewConstMetric(sc.rpc_dropped, prometheus.CounterValue, sc.counters.value("rpc_dropped\x00"+rpc_type, value), rpc_type)
+	}
+	for user, value := range sm.user_rpc_stats_count {
+		ch <- prometheus.MustNewConstMetric(sc.user_rpc_calls, prometheus.CounterValue, sc.counters.value("user_rpc_calls\x00"+user, value), user)
+	}
+	for user, value := range sm.user_rpc_stats_total_time {
+		ch <- prometheus.MustNewConstMetric(sc.user_rpc_time, prometheus.CounterValue, sc.counters.value("user_rpc_time\x00"+user, value)/1e6, user)
+	}
+	return nil
 }
 
 func NewSchedulerCollector(logger *logger.Logger) *SchedulerCollector {
@@ -350,6 +655,126 @@ func NewSchedulerCollector(logger *logger.Logger) *SchedulerCollector {
 			"Information provided by the Slurm sdiag command, number of heterogeneous job components started thanks to backfilling since last Slurm start",
 			nil,
 			nil),
+		data_since: prometheus.NewDesc(
+			"slurm_scheduler_stats_reset_timestamp_seconds",
+			"Information provided by the Slurm sdiag command, time the statistics were last reset (Data since)",
+			nil,
+			nil),
+		agent_count: prometheus.NewDesc(
+			"slurm_scheduler_agent_count",
+			"Information provided by the Slurm sdiag command, number of agents",
+			nil,
+			nil),
+		agent_thread_count: prometheus.NewDesc(
+			"slurm_scheduler_agent_thread_count",
+			"Information provided by the Slurm sdiag command, number of agent threads",
+			nil,
+			nil),
+		jobs_pending: prometheus.NewDesc(
+			"slurm_scheduler_jobs_pending",
+			"Information provided by the Slurm sdiag command, number of pending jobs",
+			nil,
+			nil),
+		jobs_running: prometheus.NewDesc(
+			"slurm_scheduler_jobs_running",
+			"Information provided by the Slurm sdiag command, number of running jobs",
+			nil,
+			nil),
+		max_cycle: prometheus.NewDesc(
+			"slurm_scheduler_max_cycle",
+			"Information provided by the Slurm sdiag command, scheduler max cycle time in (microseconds)",
+			nil,
+			nil),
+		mean_depth_cycle: prometheus.NewDesc(
+			"slurm_scheduler_mean_depth_cycle",
+			"Information provided by the Slurm sdiag command, scheduler mean number of jobs tested per cycle",
+			nil,
+			nil),
+		last_queue_length: prometheus.NewDesc(
+			"slurm_scheduler_last_queue_length",
+			"Information provided by the Slurm sdiag command, length of the job queue of the last scheduler cycle",
+			nil,
+			nil),
+		backfill_max_cycle: prometheus.NewDesc(
+			"slurm_scheduler_backfill_max_cycle",
+			"Information provided by the Slurm sdiag command, scheduler backfill max cycle time in (microseconds)",
+			nil,
+			nil),
+		backfill_last_depth: prometheus.NewDesc(
+			"slurm_scheduler_backfill_last_depth",
+			"Information provided by the Slurm sdiag command, number of jobs considered by the last backfill cycle",
+			nil,
+			nil),
+		backfill_last_depth_try: prometheus.NewDesc(
+			"slurm_scheduler_backfill_last_depth_try",
+			"Information provided by the Slurm sdiag command, number of jobs tested by the last backfill cycle",
+			nil,
+			nil),
+		backfill_depth_mean_try: prometheus.NewDesc(
+			"slurm_scheduler_backfill_depth_mean_try",
+			"Information provided by the Slurm sdiag command, scheduler backfill mean number of jobs tested per cycle",
+			nil,
+			nil),
+		backfill_last_queue_length: prometheus.NewDesc(
+			"slurm_scheduler_backfill_last_queue_length",
+			"Information provided by the Slurm sdiag command, length of the job queue of the last backfill cycle",
+			nil,
+			nil),
+		backfill_queue_length_mean: prometheus.NewDesc(
+			"slurm_scheduler_backfill_queue_length_mean",
+			"Information provided by the Slurm sdiag command, scheduler backfill mean length of the job queue",
+			nil,
+			nil),
+		backfill_last_table_size: prometheus.NewDesc(
+			"slurm_scheduler_backfill_last_table_size",
+			"Information provided by the Slurm sdiag command, size of the time slot table of the last backfill cycle",
+			nil,
+			nil),
+		backfill_mean_table_size: prometheus.NewDesc(
+			"slurm_scheduler_backfill_mean_table_size",
+			"Information provided by the Slurm sdiag command, scheduler backfill mean size of the time slot table",
+			nil,
+			nil),
+		gettimeofday_latency: prometheus.NewDesc(
+			"slurm_scheduler_gettimeofday_latency",
+			"Information provided by the Slurm sdiag command, latency of 1000 calls to gettimeofday() in (microseconds)",
+			nil,
+			nil),
+		jobs_submitted: prometheus.NewDesc(
+			"slurm_scheduler_jobs_submitted_total",
+			"Information provided by the Slurm sdiag command, number of jobs submitted, kept across resets of the statistics",
+			nil,
+			nil),
+		jobs_started: prometheus.NewDesc(
+			"slurm_scheduler_jobs_started_total",
+			"Information provided by the Slurm sdiag command, number of jobs started, kept across resets of the statistics",
+			nil,
+			nil),
+		jobs_completed: prometheus.NewDesc(
+			"slurm_scheduler_jobs_completed_total",
+			"Information provided by the Slurm sdiag command, number of jobs completed, kept across resets of the statistics",
+			nil,
+			nil),
+		jobs_canceled: prometheus.NewDesc(
+			"slurm_scheduler_jobs_canceled_total",
+			"Information provided by the Slurm sdiag command, number of jobs canceled, kept across resets of the statistics",
+			nil,
+			nil),
+		jobs_failed: prometheus.NewDesc(
+			"slurm_scheduler_jobs_failed_total",
+			"Information provided by the Slurm sdiag command, number of jobs failed, kept across resets of the statistics",
+			nil,
+			nil),
+		total_cycles: prometheus.NewDesc(
+			"slurm_scheduler_cycles_total",
+			"Information provided by the Slurm sdiag command, number of scheduler cycles, kept across resets of the statistics",
+			nil,
+			nil),
+		backfill_total_cycles: prometheus.NewDesc(
+			"slurm_scheduler_backfill_cycles_total",
+			"Information provided by the Slurm sdiag command, number of backfill cycles, kept across resets of the statistics",
+			nil,
+			nil),
 		rpc_stats_count: prometheus.NewDesc(
 			"slurm_rpc_stats",
 			"Information provided by the Slurm sdiag command, rpc count statistic",
@@ -380,6 +805,52 @@ func NewSchedulerCollector(logger *logger.Logger) *SchedulerCollector {
 			"Information provided by the Slurm sdiag command, rpc total time statistic per user",
 			user_rpc_stats_labels,
 			nil),
-		logger: logger,
+		rpc_stats_queued: prometheus.NewDesc(
+			"slurm_rpc_queued",
+			"Information provided by the Slurm sdiag command, rpcs waiting in the rpc queue",
+			rpc_stats_labels,
+			nil),
+		rpc_stats_cycle_last: prometheus.NewDesc(
+			"slurm_rpc_cycle_last",
+			"Information provided by the Slurm sdiag command, rpcs processed by the last rpc queue cycle",
+			rpc_stats_labels,
+			nil),
+		rpc_stats_cycle_max: prometheus.NewDesc(
+			"slurm_rpc_cycle_max",
+			"Information provided by the Slurm sdiag command, max rpcs processed by an rpc queue cycle",
+			rpc_stats_labels,
+			nil),
+		rpc_pending: prometheus.NewDesc(
+			"slurm_rpc_pending",
+			"Information provided by the Slurm sdiag command, rpcs pending to be sent to the nodes",
+			rpc_stats_labels,
+			nil),
+		rpc_calls: prometheus.NewDesc(
+			"slurm_rpc_calls_total",
+			"Information provided by the Slurm sdiag command, number of rpcs, kept across resets of the statistics",
+			rpc_stats_labels,
+			nil),
+		rpc_time: prometheus.NewDesc(
+			"slurm_rpc_time_seconds_total",
+			"Information provided by the Slurm sdiag command, time spent processing rpcs in seconds, kept across resets of the statistics",
+			rpc_stats_labels,
+			nil),
+		rpc_dropped: prometheus.NewDesc(
+			"slurm_rpc_dropped_total",
+			"Information provided by the Slurm sdiag command, number of rpcs dropped from the rpc queue, kept across resets of the statistics",
+			rpc_stats_labels,
+			nil),
+		user_rpc_calls: prometheus.NewDesc(
+			"slurm_user_rpc_calls_total",
+			"Information provided by the Slurm sdiag command, number of rpcs per user, kept across resets of the statistics",
+			user_rpc_stats_labels,
+			nil),
+		user_rpc_time: prometheus.NewDesc(
+			"slurm_user_rpc_time_seconds_total",
+			"Information provided by the Slurm sdiag command, time spent processing rpcs in seconds per user, kept across resets of the statistics",
+			user_rpc_stats_labels,
+			nil),
+		counters: newSdiagCounters(),
+		logger:   logger,
 	}
 }
@@ -16,9 +16,18 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>. */
 package collector
 
 import (
+	"fmt"
 	"io"
 	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestSchedulerMetrics(t *testing.T) {
@@ -32,4 +41,162 @@ func TestSchedulerMetrics(t *testing.T) {
 		t.Fatalf("Can not read test data: %v", err)
 	}
 	t.Logf("%+v", ParseSchedulerMetrics(data))
+
+	sm := ParseSchedulerMetrics(data)
+	assert.Equal(t, 1491955200.0, sm.data_since)
+	assert.Equal(t, 3.0, sm.threads)
+	assert.Equal(t, 2.0, sm.agent_count)
+	assert.Equal(t, 6.0, sm.agent_thread_count)
+	assert.Equal(t, 9706.0, sm.jobs_submitted)
+	assert.Equal(t, 2835.0, sm.jobs_canceled)
+	assert.Equal(t, 2154.0, sm.jobs_running)
+	assert.Equal(t, 21.0, sm.gettimeofday_latency)
+
+	// Fields of the main and backfill sections share their names
+	assert.Equal(t, 97209.0, sm.last_cycle)
+	assert.Equal(t, 1407590.0, sm.max_cycle)
+	assert.Equal(t, 34585.0, sm.total_cycles)
+	assert.Equal(t, 57011.0, sm.last_queue_length)
+	assert.Equal(t, 1942890.0, sm.backfill_last_cycle)
+	assert.Equal(t, 5933334.0, sm.backfill_max_cycle)
+	assert.Equal(t, 529.0, sm.backfill_total_cycles)
+	assert.Equal(t, 57064.0, sm.backfill_last_queue_length)
+	assert.Equal(t, 29324.0, sm.backfill_depth_mean)
+	assert.Equal(t, 1659.0, sm.backfill_depth_mean_try)
+	assert.Equal(t, 40772.0, sm.backfill_queue_length_mean)
+	assert.Equal(t, 793.0, sm.total_backfilled_jobs_since_cycle)
+
+	// RPC statistics with the RPC queue enabled
+	assert.Equal(t, 11650.0, sm.rpc_stats_count["REQUEST_JOB_INFO"])
+	assert.Equal(t, 61339622.0, sm.rpc_stats_total_time["REQUEST_JOB_INFO"])
+	assert.Equal(t, 2.0, sm.rpc_stats_queued["REQUEST_JOB_INFO"])
+	assert.Equal(t, 1.0, sm.rpc_stats_dropped["REQUEST_JOB_INFO"])
+	assert.Equal(t, 12.0, sm.rpc_stats_cycle_max["REQUEST_JOB_INFO"])
+	assert.Equal(t, 2308.0, sm.user_rpc_stats_count["alice"])
+	assert.Equal(t, map[string]float64{"REQUEST_TERMINATE_JOB": 10, "REQUEST_LAUNCH_PROLOG": 2}, sm.rpc_pending)
+}
+
+func TestParseRpcStatsWithoutQueue(t *testing.T) {
+	lines := strings.Split(`Remote Procedure Call statistics by message type
+	REQUEST_PARTITION_INFO                  ( 2009) count:29080  ave_time:179    total_time:5222452
+`, "\n")
+	stats := ParseRpcStats(lines)
+	assert.Equal(t, 29080.0, stats[0]["REQUEST_PARTITION_INFO"])
+	assert.Equal(t, 179.0, stats[1]["REQUEST_PARTITION_INFO"])
+	assert.Empty(t, ParseRpcQueueStats(lines)[0])
+	assert.Empty(t, ParsePendingRpcStats(lines))
+}
+
+func TestSchedulerCollectorResets(t *testing.T) {
+	data, err := os.ReadFile("../../test_data/sdiag.txt")
+	assert.NoError(t, err)
+	oldExecute := Execute
+	defer func() { Execute = oldExecute }()
+	output := string(data)
+	Execute = func(logger *logger.Logger, command string, args []string) ([]byte, error) {
+		return []byte(output), nil
+	}
+
+	sc := NewSchedulerCollector(logger.NewLogger("error"))
+	submitted := func(value string) error {
+		expected := `
+# HELP slurm_scheduler_jobs_submitted_total Information provided by the Slurm sdiag command, number of jobs submitted, kept across resets of the statistics
+# TYPE slurm_scheduler_jobs_submitted_total counter
+slurm_scheduler_jobs_submitted_total ` + value + "\n"
+		return testutil.CollectAndCompare(updater{sc}, strings.NewReader(expected), "slurm_scheduler_jobs_submitted_total")
+	}
+	assert.NoError(t, submitted("9706"))
+
+	// The statistics were reset: the counter keeps growing from its last value
+	output = strings.Replace(output, "Wed Apr 12 02:00:00 2017 (1491955200)", "Thu Apr 13 02:00:00 2017 (1492041600)", 1)
+	output = strings.Replace(output, "Jobs submitted: 9706", "Jobs submitted: 12000", 1)
+	assert.NoError(t, submitted("21706"))
+
+	// A counter going down without a new Data since is a reset too
+	output = strings.Replace(output, "Jobs submitted: 12000", "Jobs submitted: 5", 1)
+	assert.NoError(t, submitted("21711"))
+}
+
+func TestSchedulerCollectorRPCResets(t *testing.T) {
+	data, err := os.ReadFile("../../test_data/sdiag.txt")
+	assert.NoError(t, err)
+	oldExecute := Execute
+	defer func() { Execute = oldExecute }()
+	output := string(data)
+	Execute = func(logger *logger.Logger, command string, args []string) ([]byte, error) {
+		return []byte(output), nil
+	}
+
+	sc := NewSchedulerCollector(logger.NewLogger("error"))
+	calls := func() float64 {
+		registry := prometheus.NewPedanticRegistry()
+		registry.MustRegister(updater{sc})
+		families, err := registry.Gather()
+		assert.NoError(t, err)
+		for _, family := range families {
+			if family.GetName() != "slurm_rpc_calls_total" {
+				continue
+			}
+			for _, m := range family.GetMetric() {
+				if m.GetLabel()[0].GetValue() == "REQUEST_JOB_INFO" {
+					return m.GetCounter().GetValue()
+				}
+			}
+		}
+		return 0
+	}
+	assert.Equal(t, 11650.0, calls())
+
+	// The midnight reset of Data since does not clear the RPC statistics
+	output = strings.Replace(output, "Wed Apr 12 02:00:00 2017 (1491955200)", "Thu Apr 13 02:00:00 2017 (1492041600)", 1)
+	output = strings.Replace(output, "count:11650 ", "count:11700 ", 1)
+	assert.Equal(t, 11700.0, calls())
+
+	// sdiag -r does, which shows as a decrease
+	output = strings.Replace(output, "count:11700 ", "count:10    ", 1)
+	assert.Equal(t, 11710.0, calls())
+}
+
+// TestSchedulerCollectorConcurrentScrapes checks that an older sdiag output
+// is never applied after a newer one, which would look like a reset.
+func TestSchedulerCollectorConcurrentScrapes(t *testing.T) {
+	data, err := os.ReadFile("../../test_data/sdiag.txt")
+	assert.NoError(t, err)
+	oldExecute := Execute
+	defer func() { Execute = oldExecute }()
+	var mu sync.Mutex
+	runs := 0
+	Execute = func(logger *logger.Logger, command string, args []string) ([]byte, error) {
+		mu.Lock()
+		runs++
+		run := runs
+		mu.Unlock()
+		if run == 1 {
+			// The first scrape is slow, the second one would overtake it.
+			time.Sleep(50 * time.Millisecond)
+		}
+		return []byte(strings.Replace(string(data), "Jobs submitted: 9706", fmt.Sprintf("Jobs submitted: %d", run*100), 1)), nil
+	}
+
+	sc := NewSchedulerCollector(logger.NewLogger("error"))
+	update := func() {
+		ch := make(chan prometheus.Metric, 1000)
+		assert.NoError(t, sc.Update(NewSnapshot(logger.NewLogger("error")), ch))
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		update()
+	}()
+	time.Sleep(10 * time.Millisecond)
+	update()
+	wg.Wait()
+
+	expected := `
+# HELP slurm_scheduler_jobs_submitted_total Information provided by the Slurm sdiag command, number of jobs submitted, kept across resets of the statistics
+# TYPE slurm_scheduler_jobs_submitted_total counter
+slurm_scheduler_jobs_submitted_total 300
+`
+	assert.NoError(t, testutil.CollectAndCompare(updater{sc}, strings.NewReader(expected), "slurm_scheduler_jobs_submitted_total"))
 }
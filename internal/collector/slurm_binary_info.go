@@ -35,7 +35,7 @@ func (c *SlurmInfoCollector) Describe(ch chan<- *prometheus.Desc) {
 }
 
 
-func (c *SlurmInfoCollector) Collect(ch chan<- prometheus.Metric) {
+func (c *SlurmInfoCollector) Update(s *Snapshot, ch chan<- prometheus.Metric) error {
 	
 	version, found := GetBinaryVersion(c.logger, "sinfo")
 	versionValue := 0.0
@@ -54,6 +54,7 @@ func (c *SlurmInfoCollector) Collect(ch chan<- prometheus.Metric) {
 		}
 		ch <- prometheus.MustNewConstMetric(c.slurmInfo, prometheus.GaugeValue, binValue, "binary", binary, binVersion)
 	}
+	return nil
 }
 
 
@@ -0,0 +1,346 @@
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+const (
+	// jobsFormat lists every squeue field used by the job-oriented
+	// collectors. The job name is last since it may contain the separator.
+	// tres-alloc prints the requested TRES of jobs that are not running.
+	jobsFormat = "JobArrayID:|,Partition:|,State:|,NumCPUs:|,Reason:|,UserName:|,Account:|,QOS:|,NumNodes:|,tres-alloc:|,tres-per-node:|,SubmitTime:|,EligibleTime:|,StartTime:|,TimeLimit:|,Name:"
+
+	// nodesFormat lists every sinfo field used by the node-oriented
+	// collectors. The reason is last since it may contain the separator.
+	// PartitionName prints the default partition without the "*" of
+	// Partition, as squeue does.
+	nodesFormat = "NodeList:|,PartitionName:|,StateLong:|,CPUsState:|,AllocMem:|,Memory:|,FeaturesAct:|,Gres:|,GresUsed:|,UserLong:|,Timestamp:|,Reason:"
+)
+
+// Job is a single line of the squeue snapshot. Array jobs are expanded,
+// so every task is a separate Job.
+type Job struct {
+	JobID     string
+	Partition string
+	State     string
+	CPUs      float64
+	Reason    string
+	User      string
+	Account   string
+	QOS       string
+	Nodes     float64
+	// TRES holds the allocated TRES of running jobs and the requested TRES
+	// of other jobs, memory in MB.
+	TRES map[string]float64
+	// TRESPerNode is the tres-per-node request, such as "gres/gpu:a100:2".
+	TRESPerNode string
+	SubmitTime  time.Time
+	// EligibleTime is zero while the job is not eligible, e.g. held by a
+	// dependency.
+	EligibleTime time.Time
+	// StartTime is the actual start of running jobs, and the start expected
+	// by the scheduler for pending jobs, as printed by "squeue --start". It
+	// is zero when the scheduler has no estimate.
+	StartTime time.Time
+	// TimeLimit is the time limit in seconds, zero when unlimited.
+	TimeLimit float64
+	Name      string
+}
+
+// NodeRecord is a single line of the sinfo snapshot: a node as listed in one
+// of its partitions. Nodes in several partitions have one record each.
+type NodeRecord struct {
+	Name      string
+	Partition string
+	State     string
+	CPUs      CPUsMetrics
+	AllocMem  float64
+	Memory    float64
+	Features  string
+	Gres      string
+	GresUsed  string
+	User      string
+	Timestamp string
+	Reason    string
+}
+
+// NodeDetail is a single line of the scontrol node snapshot: every field
+// scontrol prints for a node, by name.
+type NodeDetail struct {
+	Name   string
+	Fields map[string]string
+}
+
+// nodeDetailKey matches the start of a field of "scontrol show nodes -o".
+// Values such as OS and Reason may contain spaces, but no such key.
+var nodeDetailKey = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*=`)
+
+// Snapshot holds the squeue, sinfo and scontrol node data shared by the
+// collectors of a single scrape. Each command runs at most once, the first
+// time its data is requested; concurrent callers wait for that execution.
+type Snapshot struct {
+	logger  *logger.Logger
+	cluster string
+
+	jobsOnce sync.Once
+	jobs     []Job
+	jobsErr  error
+
+	nodesOnce sync.Once
+	nodes     []NodeRecord
+	nodesErr  error
+	nodesTime time.Time
+
+	nodeDetailsOnce sync.Once
+	nodeDetails     []NodeDetail
+	nodeDetailsErr  error
+}
+
+func NewSnapshot(logger *logger.Logger) *Snapshot {
+	return &Snapshot{logger: logger}
+}
+
+// NewClusterSnapshot creates a Snapshot of another cluster of the slurmdbd,
+// queried with -M. An empty cluster is the default one.
+func NewClusterSnapshot(logger *logger.Logger, cluster string) *Snapshot {
+	return &Snapshot{logger: logger, cluster: cluster}
+}
+
+// Cluster returns the cluster of the snapshot, empty for the default one.
+// Collectors running their own commands pass it to the Data functions.
+func (s *Snapshot) Cluster() string {
+	return s.cluster
+}
+
+// Jobs returns the jobs known to slurmctld, from a single squeue call.
+func (s *Snapshot) Jobs() ([]Job, error) {
+	s.jobsOnce.Do(func() {
+		data, err := JobsData(s.logger, s.cluster)
+		if err != nil {
+			s.jobsErr = err
+			return
+		}
+		s.jobs = ParseJobs(data)
+	})
+	return s.jobs, s.jobsErr
+}
+
+// Nodes returns one record per node and partition, from a single sinfo call.
+func (s *Snapshot) Nodes() ([]NodeRecord, error) {
+	s.nodesOnce.Do(func() {
+		s.nodesTime = time.Now()
+		data, err := NodesInfoData(s.logger, s.cluster)
+		if err != nil {
+			s.nodesErr = err
+			return
+		}
+		s.nodes = ParseNodeRecords(data)
+	})
+	return s.nodes, s.nodesErr
+}
+
+// NodesTime returns the time the sinfo call of Nodes was started, which
+// orders the node states of concurrent scrapes.
+func (s *Snapshot) NodesTime() time.Time {
+	s.Nodes()
+	return s.nodesTime
+}
+
+// NodeDetails returns every node with all its fields, from a single
+// scontrol call.
+func (s *Snapshot) NodeDetails() ([]NodeDetail, error) {
+	s.nodeDetailsOnce.Do(func() {
+		data, err := NodeDetailsData(s.logger, s.cluster)
+		if err != nil {
+			s.nodeDetailsErr = err
+			return
+		}
+		s.nodeDetails = ParseNodeDetails(data)
+	})
+	return s.nodeDetails, s.nodeDetailsErr
+}
+
+/*
+JobsData executes the squeue command shared by all job-oriented collectors.
+Expected squeue output format: the fields of jobsFormat separated by "|" (ID|Partition|State|CPUs|Reason|User|Account|QOS|Nodes|TRES|TRESPerNode|Submit|Eligible|Start|TimeLimit|Name).
+*/
+func JobsData(logger *logger.Logger, cluster string) ([]byte, error) {
+	return executeOn(logger, cluster, "squeue", []string{"-a", "-r", "-h", "-O", jobsFormat})
+}
+
+/*
+NodesInfoData executes the sinfo command shared by all node-oriented collectors.
+Expected sinfo output format: one line per node and partition with the fields of nodesFormat separated by "|".
+*/
+func NodesInfoData(logger *logger.Logger, cluster string) ([]byte, error) {
+	return executeOn(logger, cluster, "sinfo", []string{"-a", "-h", "-N", "-O", nodesFormat})
+}
+
+/*
+NodeDetailsData executes the scontrol command shared by the collectors that need more than sinfo prints.
+Expected scontrol output format: one line of key=value pairs per node.
+*/
+func NodeDetailsData(logger *logger.Logger, cluster string) ([]byte, error) {
+	return executeOn(logger, cluster, "scontrol", []string{"show", "nodes", "-o"})
+}
+
+// ParseJobs parses the output of JobsData.
+func ParseJobs(input []byte) []Job {
+	var jobs []Job
+	for _, line := range strings.Split(string(input), "\n") {
+		fields := strings.SplitN(line, "|", 16)
+		if len(fields) < 16 {
+			continue
+		}
+		cpus, _ := strconv.ParseFloat(strings.TrimSpace(fields[3]), 64)
+		nodes, _ := strconv.ParseFloat(strings.TrimSpace(fields[8]), 64)
+		jobs = append(jobs, Job{
+			JobID:        strings.TrimSpace(fields[0]),
+			Partition:    strings.TrimSpace(fields[1]),
+			State:        strings.TrimSpace(fields[2]),
+			CPUs:         cpus,
+			Reason:       strings.TrimSpace(fields[4]),
+			User:         strings.TrimSpace(fields[5]),
+			Account:      strings.TrimSpace(fields[6]),
+			QOS:          strings.TrimSpace(fields[7]),
+			Nodes:        nodes,
+			TRES:         ParseNodeTRES(strings.TrimSpace(fields[9])),
+			TRESPerNode:  strings.TrimSpace(fields[10]),
+			SubmitTime:   parseSlurmTime(strings.TrimSpace(fields[11])),
+			EligibleTime: parseSlurmTime(strings.TrimSpace(fields[12])),
+			StartTime:    parseSlurmTime(strings.TrimSpace(fields[13])),
+			TimeLimit:    parseSlurmDuration(strings.TrimSpace(fields[14])),
+			Name:         fields[15],
+		})
+	}
+	return jobs
+}
+
+// ParseNodeRecords parses the output of NodesInfoData.
+func ParseNodeRecords(input []byte) []NodeRecord {
+	var nodes []NodeRecord
+	for _, line := range strings.Split(string(input), "\n") {
+		fields := strings.SplitN(line, "|", 12)
+		if len(fields) < 12 {
+			continue
+		}
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		allocMem, _ := strconv.ParseFloat(fields[4], 64)
+		memory, _ := strconv.ParseFloat(fields[5], 64)
+		nodes = append(nodes, NodeRecord{
+			Name:      fields[0],
+			Partition: strings.TrimSuffix(fields[1], "*"),
+			State:     fields[2],
+			CPUs:      *ParseCPUsMetrics([]byte(fields[3])),
+			AllocMem:  allocMem,
+			Memory:    memory,
+			Features:  fields[6],
+			Gres:      fields[7],
+			GresUsed:  fields[8],
+			User:      fields[9],
+			Timestamp: fields[10],
+			Reason:    fields[11],
+		})
+	}
+	return nodes
+}
+
+// ParseNodeDetails parses the output of NodeDetailsData. Words that do not
+// start a new key=value pair belong to the value of the previous one.
+func ParseNodeDetails(input []byte) []NodeDetail {
+	var nodes []NodeDetail
+	for _, line := range strings.Split(string(input), "\n") {
+		fields := make(map[string]string)
+		var key string
+		for _, word := range strings.Fields(line) {
+			if nodeDetailKey.MatchString(word) {
+				var value string
+				key, value, _ = strings.Cut(word, "=")
+				fields[key] = value
+			} else if key != "" {
+				fields[key] += " " + word
+			}
+		}
+		if name := fields["NodeName"]; name != "" {
+			nodes = append(nodes, NodeDetail{Name: name, Fields: fields})
+		}
+	}
+	return nodes
+}
+
+// uniqueNodes returns the first record of every node, for cluster-wide
+// figures where nodes in several partitions must only be counted once.
+func uniqueNodes(records []NodeRecord) []NodeRecord {
+	seen := make(map[string]bool)
+	var nodes []NodeRecord
+	for _, r := range records {
+		if !seen[r.Name] {
+			seen[r.Name] = true
+			nodes = append(nodes, r)
+		}
+	}
+	return nodes
+}
+
+// collapseArrays folds the pending tasks of every job array back into one
+// Job per partition and reason, as squeue prints them without -r, for the
+// collectors that counted array jobs once. The JobID of a folded Job lists
+// its tasks, such as "1234_[3-5,8]".
+func collapseArrays(jobs []Job) []Job {
+	var collapsed []Job
+	index := make(map[string]int)
+	tasks := make(map[string][]int)
+	for _, job := range jobs {
+		arrayID, taskID, isTask := strings.Cut(job.JobID, "_")
+		task, err := strconv.Atoi(taskID)
+		if !isTask || err != nil || job.State != "PENDING" {
+			collapsed = append(collapsed, job)
+			continue
+		}
+		key := arrayID + "|" + job.Partition + "|" + job.Reason
+		if _, ok := index[key]; !ok {
+			index[key] = len(collapsed)
+			collapsed = append(collapsed, job)
+		}
+		tasks[key] = append(tasks[key], task)
+	}
+	for key, ids := range tasks {
+		if len(ids) < 2 {
+			continue
+		}
+		job := &collapsed[index[key]]
+		arrayID, _, _ := strings.Cut(job.JobID, "_")
+		job.JobID = arrayID + "_[" + formatTaskRanges(ids) + "]"
+	}
+	return collapsed
+}
+
+// formatTaskRanges formats array task IDs the way squeue does, with
+// consecutive IDs as ranges: "3-5,8".
+func formatTaskRanges(ids []int) string {
+	sort.Ints(ids)
+	var ranges []string
+	for i := 0; i < len(ids); {
+		j := i
+		for j+1 < len(ids) && ids[j+1] <= ids[j]+1 {
+			j++
+		}
+		if ids[j] == ids[i] {
+			ranges = append(ranges, strconv.Itoa(ids[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", ids[i], ids[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(ranges, ",")
+}
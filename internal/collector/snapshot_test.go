@@ -0,0 +1,152 @@
+package collector
+
+import (
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseJobs(t *testing.T) {
+	jobs := ParseJobs([]byte("1003_1|gpu|PENDING|8|Resources|alice|physics|normal|1|cpu=8,mem=32G,node=1,gres/gpu=2|gres/gpu:a100:2|2024-05-02T10:00:00|Unknown|N/A|1-12:00:00|md|run\n\n"))
+	assert.Equal(t, []Job{{
+		JobID:       "1003_1",
+		Partition:   "gpu",
+		State:       "PENDING",
+		CPUs:        8,
+		Reason:      "Resources",
+		User:        "alice",
+		Account:     "physics",
+		QOS:         "normal",
+		Nodes:       1,
+		TRES:        map[string]float64{"cpu": 8, "mem": 32768, "node": 1, "gres/gpu": 2},
+		TRESPerNode: "gres/gpu:a100:2",
+		SubmitTime:  parseSlurmTime("2024-05-02T10:00:00"),
+		TimeLimit:   129600,
+		Name:        "md|run",
+	}}, jobs)
+}
+
+func TestCollapseArrays(t *testing.T) {
+	jobs := collapseArrays([]Job{
+		{JobID: "1003_1", Partition: "gpu", State: "RUNNING", CPUs: 8},
+		{JobID: "1003_2", Partition: "gpu", State: "PENDING", Reason: "Resources", CPUs: 8},
+		{JobID: "1003_3", Partition: "gpu", State: "PENDING", Reason: "Resources", CPUs: 8},
+		{JobID: "1003_4", Partition: "gpu", State: "PENDING", Reason: "Resources", CPUs: 8},
+		{JobID: "1003_7", Partition: "gpu", State: "PENDING", Reason: "Resources", CPUs: 8},
+		{JobID: "1003_5", Partition: "gpu", State: "PENDING", Reason: "JobHeldUser", CPUs: 8},
+		{JobID: "1004", Partition: "batch", State: "PENDING", Reason: "Priority", CPUs: 4},
+	})
+	// Running tasks and lone pending tasks keep their own JobID.
+	assert.Equal(t, []Job{
+		{JobID: "1003_1", Partition: "gpu", State: "RUNNING", CPUs: 8},
+		{JobID: "1003_[2-4,7]", Partition: "gpu", State: "PENDING", Reason: "Resources", CPUs: 8},
+		{JobID: "1003_5", Partition: "gpu", State: "PENDING", Reason: "JobHeldUser", CPUs: 8},
+		{JobID: "1004", Partition: "batch", State: "PENDING", Reason: "Priority", CPUs: 4},
+	}, jobs)
+}
+
+func TestParseNodeRecords(t *testing.T) {
+	data, err := os.ReadFile("../../test_data/sinfo_mem.txt")
+	if err != nil {
+		t.Fatalf("Can not open test data: %v", err)
+	}
+	nodes := ParseNodeRecords(data)
+	assert.Len(t, nodes, 22)
+	assert.Equal(t, "a048", nodes[0].Name)
+	assert.Equal(t, "long", nodes[0].Partition)
+	assert.Equal(t, CPUsMetrics{alloc: 16, idle: 0, other: 0, total: 16}, nodes[0].CPUs)
+	assert.Equal(t, float64(193000), nodes[0].Memory)
+
+	cpus := SumCPUsMetrics(nodes)
+	assert.Equal(t, CPUsMetrics{alloc: 157, idle: 19, other: 0, total: 176}, *cpus)
+}
+
+func TestParseNodeDetails(t *testing.T) {
+	data, err := os.ReadFile("../../test_data/scontrol_nodes.txt")
+	if err != nil {
+		t.Fatalf("Can not open test data: %v", err)
+	}
+	nodes := ParseNodeDetails(data)
+	assert.Len(t, nodes, 3)
+	assert.Equal(t, "node001", nodes[0].Name)
+	assert.Equal(t, "47.85", nodes[0].Fields["CPULoad"])
+	assert.Equal(t, "cpu=48,mem=187.50G", nodes[0].Fields["AllocTRES"])
+	// Values with spaces are kept whole.
+	assert.Equal(t, "Linux 5.14.0-427.13.1.el9_4.x86_64 #1 SMP PREEMPT_DYNAMIC Wed May 1 19:11:28 UTC 2024", nodes[0].Fields["OS"])
+	assert.Equal(t, "Not responding [slurm@2025-08-25T22:15:00]", nodes[2].Fields["Reason"])
+	assert.Equal(t, "", nodes[2].Fields["AllocTRES"])
+}
+
+// TestSnapshotSharedPerScrape checks that all collectors of a scrape share a
+// single squeue, sinfo and scontrol execution.
+func TestSnapshotSharedPerScrape(t *testing.T) {
+	oldExecute := Execute
+	defer func() { Execute = oldExecute }()
+
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	Execute = func(logger *logger.Logger, command string, args []string) ([]byte, error) {
+		mu.Lock()
+		calls[command]++
+		mu.Unlock()
+		switch command {
+		case "squeue":
+			return os.ReadFile("../../test_data/squeue.txt")
+		case "sinfo":
+			return os.ReadFile("../../test_data/sinfo_mem.txt")
+		case "scontrol":
+			return os.ReadFile("../../test_data/scontrol_nodes.txt")
+		}
+		return []byte("a048\n"), nil
+	}
+
+	testLogger := logger.NewLogger("debug")
+	sc := NewSlurmCollector(testLogger, "", map[string]Collector{
+		"accounts":     NewAccountsCollector(testLogger),
+		"cpus":         NewCPUsCollector(testLogger),
+		"gpus":         NewGPUsCollector(testLogger, false, false),
+		"job":          NewJobCollector(testLogger),
+		"node":         NewNodeCollector(testLogger),
+		"node_details": NewNodeDetailsCollector(testLogger),
+		"nodes":        NewNodesCollector(testLogger),
+		"partitions":   NewPartitionsCollector(testLogger),
+		"queue":        NewQueueCollector(testLogger, nil),
+		"users":        NewUsersCollector(testLogger),
+	})
+	ch := make(chan prometheus.Metric)
+	go func() {
+		sc.Collect(ch)
+		close(ch)
+	}()
+	count := 0
+	for range ch {
+		count++
+	}
+
+	assert.Greater(t, count, 0)
+	assert.Equal(t, 1, calls["squeue"])
+	assert.Equal(t, 1, calls["sinfo"])
+	assert.Equal(t, 1, calls["scontrol"])
+}
+
+func TestClusterSnapshot(t *testing.T) {
+	oldExecute := Execute
+	defer func() { Execute = oldExecute }()
+
+	squeue, err := os.ReadFile("../../test_data/squeue.txt")
+	assert.NoError(t, err)
+	Execute = func(logger *logger.Logger, command string, args []string) ([]byte, error) {
+		assert.Equal(t, []string{"-M", "beta"}, args[:2])
+		return append([]byte("CLUSTER: beta\n"), squeue...), nil
+	}
+
+	s := NewClusterSnapshot(logger.NewLogger("error"), "beta")
+	assert.Equal(t, "beta", s.Cluster())
+	jobs, err := s.Jobs()
+	assert.NoError(t, err)
+	assert.Equal(t, ParseJobs(squeue), jobs)
+}
@@ -0,0 +1,172 @@
+package collector
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+)
+
+// sprioComponents lists the priority components exported by the sprio
+// collector, in the order of the weighted factors of SprioData.
+var sprioComponents = []string{"total", "age", "fairshare", "jobsize", "partition", "qos", "tres", "site"}
+
+// sprioQuantiles are the quantiles of the aggregated priority summaries.
+var sprioQuantiles = []float64{0.5, 0.9, 0.99}
+
+// JobPriority holds the weighted priority components of a pending job in
+// one of its partitions, indexed like sprioComponents.
+type JobPriority struct {
+	JobID      string
+	Partition  string
+	User       string
+	Account    string
+	Components []float64
+}
+
+/*
+SprioData executes the sprio command to retrieve the priority of pending jobs.
+Expected sprio output format: "%i|%r|%u|%o|%Y|%A|%F|%J|%P|%Q|%T|%S"
+(ID|Partition|User|Account|Priority|Age|FairShare|JobSize|Partition|QOS|TRES|Site).
+*/
+func SprioData(logger *logger.Logger, cluster string) ([]byte, error) {
+	return executeOn(logger, cluster, "sprio", []string{"-h", "-o", "%i|%r|%u|%o|%Y|%A|%F|%J|%P|%Q|%T|%S"})
+}
+
+/*
+ParseJobPriorities parses the output of the sprio command.
+Jobs pending in several partitions have one line per partition. The weighted TRES
+factor is printed per TRES ("cpu=10,gres/gpu=100") and summed up.
+*/
+func ParseJobPriorities(input []byte) []JobPriority {
+	var jobs []JobPriority
+	for _, line := range strings.Split(string(input), "\n") {
+		fields := strings.Split(line, "|")
+		if len(fields) < 12 {
+			continue
+		}
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		job := JobPriority{
+			JobID:     fields[0],
+			Partition: fields[1],
+			User:      fields[2],
+			Account:   fields[3],
+		}
+		for i, value := range fields[4:12] {
+			if sprioComponents[i] == "tres" {
+				job.Components = append(job.Components, parseTRESFactor(value))
+				continue
+			}
+			factor, _ := strconv.ParseFloat(value, 64)
+			job.Components = append(job.Components, factor)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs
+}
+
+// parseTRESFactor sums the per-TRES weighted factors printed by sprio.
+func parseTRESFactor(value string) float64 {
+	var sum float64
+	for _, tres := range strings.Split(value, ",") {
+		_, factor, found := strings.Cut(tres, "=")
+		if !found {
+			continue
+		}
+		f, err := strconv.ParseFloat(factor, 64)
+		if err == nil {
+			sum += f
+		}
+	}
+	return sum
+}
+
+// quantile returns the q-quantile of sorted values, using the nearest rank.
+func quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return math.NaN()
+	}
+	rank := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+/*
+ * Implement the Prometheus Collector interface and feed the
+ * Slurm priority metrics into it.
+ * https://godoc.org/github.com/prometheus/client_golang/prometheus#Collector
+ */
+
+// SprioCollector exports the weighted priority components of pending jobs,
+// summarized per partition and account, and optionally per job.
+type SprioCollector struct {
+	priority    *prometheus.Desc
+	jobPriority *prometheus.Desc
+	perJob      bool
+	logger      *logger.Logger
+}
+
+func NewSprioCollector(logger *logger.Logger, perJob bool) *SprioCollector {
+	return &SprioCollector{
+		priority: prometheus.NewDesc("slurm_sprio_priority",
+			"Weighted priority component of the pending jobs", []string{"partition", "account", "component"}, nil),
+		jobPriority: prometheus.NewDesc("slurm_sprio_job_priority",
+			"Weighted priority component of a pending job", []string{"job_id", "partition", "user", "account", "component"}, nil),
+		perJob: perJob,
+		logger: logger,
+	}
+}
+
+func (sc *SprioCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- sc.priority
+	ch <- sc.jobPriority
+}
+
+func (sc *SprioCollector) Update(s *Snapshot, ch chan<- prometheus.Metric) error {
+	data, err := SprioData(sc.logger, s.Cluster())
+	if err != nil {
+		return err
+	}
+	jobs := ParseJobPriorities(data)
+
+	type group struct{ partition, account string }
+	values := make(map[group][][]float64)
+	for _, job := range jobs {
+		g := group{job.Partition, job.Account}
+		if values[g] == nil {
+			values[g] = make([][]float64, len(sprioComponents))
+		}
+		for i, v := range job.Components {
+			values[g][i] = append(values[g][i], v)
+		}
+		if sc.perJob {
+			for i, component := range sprioComponents {
+				ch <- prometheus.MustNewConstMetric(sc.jobPriority, prometheus.GaugeValue, job.Components[i], job.JobID, job.Partition, job.User, job.Account, component)
+			}
+		}
+	}
+
+	for g, components := range values {
+		for i, component := range sprioComponents {
+			sorted := components[i]
+			sort.Float64s(sorted)
+			var sum float64
+			for _, v := range sorted {
+				sum += v
+			}
+			quantiles := make(map[float64]float64, len(sprioQuantiles))
+			for _, q := range sprioQuantiles {
+				quantiles[q] = quantile(sorted, q)
+			}
+			ch <- prometheus.MustNewConstSummary(sc.priority, uint64(len(sorted)), sum, quantiles, g.partition, g.account, component)
+		}
+	}
+	return nil
+}
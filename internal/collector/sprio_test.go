@@ -0,0 +1,70 @@
+package collector
+
+import (
+	"os"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sckyzo/slurm_exporter/internal/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseJobPriorities(t *testing.T) {
+	data, err := os.ReadFile("../../test_data/sprio.txt")
+	assert.NoError(t, err)
+
+	jobs := ParseJobPriorities(data)
+	assert.Len(t, jobs, 5)
+
+	assert.Equal(t, "4001", jobs[0].JobID)
+	assert.Equal(t, "batch", jobs[0].Partition)
+	assert.Equal(t, "alice", jobs[0].User)
+	assert.Equal(t, "physics", jobs[0].Account)
+	assert.Equal(t, []float64{10650, 150, 8000, 500, 1000, 1000, 0, 0}, jobs[0].Components)
+
+	// A job pending in two partitions has one line per partition.
+	assert.Equal(t, "4003", jobs[3].JobID)
+	assert.Equal(t, "gpu", jobs[3].Partition)
+
+	// TRES factors are summed, the site factor may be negative.
+	assert.Equal(t, []float64{12700, 900, 7500, 300, 3000, 1000, 100, -100}, jobs[4].Components)
+}
+
+func TestQuantile(t *testing.T) {
+	sorted := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	assert.Equal(t, 5.0, quantile(sorted, 0.5))
+	assert.Equal(t, 9.0, quantile(sorted, 0.9))
+	assert.Equal(t, 10.0, quantile(sorted, 0.99))
+	assert.Equal(t, 1.0, quantile(sorted, 0))
+	assert.Equal(t, 4.0, quantile([]float64{4}, 0.5))
+}
+
+func TestSprioCollector(t *testing.T) {
+	oldExecute := Execute
+	defer func() { Execute = oldExecute }()
+	Execute = func(logger *logger.Logger, command string, args []string) ([]byte, error) {
+		return os.ReadFile("../../test_data/sprio.txt")
+	}
+
+	// Three partition/account groups, eight components each.
+	sc := NewSprioCollector(logger.NewLogger("error"), false)
+	assert.Equal(t, 24, testutil.CollectAndCount(updater{sc}, "slurm_sprio_priority"))
+	assert.Equal(t, 0, testutil.CollectAndCount(updater{sc}, "slurm_sprio_job_priority"))
+
+	sc = NewSprioCollector(logger.NewLogger("error"), true)
+	assert.Equal(t, 40, testutil.CollectAndCount(updater{sc}, "slurm_sprio_job_priority"))
+}
+
+// updater adapts a Collector to the Prometheus Collector interface.
+type updater struct {
+	c Collector
+}
+
+func (u updater) Describe(ch chan<- *prometheus.Desc) {
+	u.c.Describe(ch)
+}
+
+func (u updater) Collect(ch chan<- prometheus.Metric) {
+	_ = u.c.Update(NewSnapshot(logger.NewLogger("error")), ch)
+}
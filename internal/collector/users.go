@@ -2,84 +2,84 @@ package collector
 
 import (
 	"regexp"
-	"strconv"
 	"strings"
 
-	
-	
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sckyzo/slurm_exporter/internal/logger"
 )
 
-/*
-UsersData executes the squeue command to retrieve job information by user.
-Expected squeue output format: "%A|%u|%T|%C" (Job ID|User|State|CPUs).
-*/
-func UsersData(logger *logger.Logger) ([]byte, error) {
-	return Execute(logger, "squeue", []string{"-a", "-r", "-h", "-o", "%A|%u|%T|%C"})
-}
-
 type UserJobMetrics struct {
-	pending      float64
-	running      float64
-	running_cpus float64
-	suspended    float64
+	pending       float64
+	running       float64
+	running_cpus  float64
+	suspended     float64
+	running_mem   float64
+	running_nodes float64
+	running_gpus  map[string]float64
+	pending_gpus  map[string]float64
 }
 
 /*
-ParseUsersMetrics parses the output of the squeue command for user-specific job metrics.
-It expects input in the format: "JobID|User|State|CPUs".
+ParseUsersMetrics aggregates the jobs of the squeue snapshot by user.
 */
-func ParseUsersMetrics(logger *logger.Logger) (map[string]*UserJobMetrics, error) {
+func ParseUsersMetrics(jobs []Job) map[string]*UserJobMetrics {
 	users := make(map[string]*UserJobMetrics)
-	usersData, err := UsersData(logger)
-	if err != nil {
-		return nil, err
-	}
-	lines := strings.Split(string(usersData), "\n")
-	for _, line := range lines {
-		if strings.Contains(line, "|") {
-			user := strings.Split(line, "|")[1]
-			_, key := users[user]
-			if !key {
-				users[user] = &UserJobMetrics{0, 0, 0, 0}
+	for _, job := range jobs {
+		user := job.User
+		_, key := users[user]
+		if !key {
+			users[user] = &UserJobMetrics{running_gpus: make(map[string]float64), pending_gpus: make(map[string]float64)}
+		}
+		state := strings.ToLower(job.State)
+		pending := regexp.MustCompile(`^pending`)
+		running := regexp.MustCompile(`^running`)
+		suspended := regexp.MustCompile(`^suspended`)
+		switch {
+		case pending.MatchString(state):
+			users[user].pending++
+			for gpuType, gpus := range jobGPUTypes(job) {
+				users[user].pending_gpus[gpuType] += gpus
 			}
-			state := strings.Split(line, "|")[2]
-			state = strings.ToLower(state)
-			cpus, _ := strconv.ParseFloat(strings.Split(line, "|")[3], 64)
-			pending := regexp.MustCompile(`^pending`)
-			running := regexp.MustCompile(`^running`)
-			suspended := regexp.MustCompile(`^suspended`)
-			switch {
-			case pending.MatchString(state):
-				users[user].pending++
-			case running.MatchString(state):
-				users[user].running++
-				users[user].running_cpus += cpus
-			case suspended.MatchString(state):
-				users[user].suspended++
+		case running.MatchString(state):
+			users[user].running++
+			users[user].running_cpus += job.CPUs
+			users[user].running_mem += job.TRES["mem"]
+			users[user].running_nodes += job.Nodes
+			for gpuType, gpus := range jobGPUTypes(job) {
+				users[user].running_gpus[gpuType] += gpus
 			}
+		case suspended.MatchString(state):
+			users[user].suspended++
 		}
 	}
-	return users, nil
+	return users
 }
 
 type UsersCollector struct {
-	pending      *prometheus.Desc
-	running      *prometheus.Desc
-	running_cpus *prometheus.Desc
-	suspended    *prometheus.Desc
-	logger       *logger.Logger
+	pending       *prometheus.Desc
+	running       *prometheus.Desc
+	running_cpus  *prometheus.Desc
+	suspended     *prometheus.Desc
+	running_mem   *prometheus.Desc
+	running_nodes *prometheus.Desc
+	running_gpus  *prometheus.Desc
+	pending_gpus  *prometheus.Desc
+	logger        *logger.Logger
 }
 
 func NewUsersCollector(logger *logger.Logger) *UsersCollector {
 	labels := []string{"user"}
+	gpuLabels := []string{"user", "gpu_type"}
 	return &UsersCollector{
-		pending:      prometheus.NewDesc("slurm_user_jobs_pending", "Pending jobs for user", labels, nil),
-		running:      prometheus.NewDesc("slurm_user_jobs_running", "Running jobs for user", labels, nil),
-		running_cpus: prometheus.NewDesc("slurm_user_cpus_running", "Running cpus for user", labels, nil),
-		suspended:    prometheus.NewDesc("slurm_user_jobs_suspended", "Suspended jobs for user", labels, nil),
-		logger:       logger,
+		pending:       prometheus.NewDesc("slurm_user_jobs_pending", "Pending jobs for user", labels, nil),
+		running:       prometheus.NewDesc("slurm_user_jobs_running", "Running jobs for user", labels, nil),
+		running_cpus:  prometheus.NewDesc("slurm_user_cpus_running", "Running cpus for user", labels, nil),
+		suspended:     prometheus.NewDesc("slurm_user_jobs_suspended", "Suspended jobs for user", labels, nil),
+		running_mem:   prometheus.NewDesc("slurm_user_mem_running", "Running memory for user in MB", labels, nil),
+		running_nodes: prometheus.NewDesc("slurm_user_nodes_running", "Running nodes for user", labels, nil),
+		running_gpus:  prometheus.NewDesc("slurm_user_gpus_running", "Running gpus for user", gpuLabels, nil),
+		pending_gpus:  prometheus.NewDesc("slurm_user_gpus_pending", "Pending gpus for user", gpuLabels, nil),
+		logger:        logger,
 	}
 }
 
@@ -88,14 +88,18 @@ func (uc *UsersCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- uc.running
 	ch <- uc.running_cpus
 	ch <- uc.suspended
+	ch <- uc.running_mem
+	ch <- uc.running_nodes
+	ch <- uc.running_gpus
+	ch <- uc.pending_gpus
 }
 
-func (uc *UsersCollector) Collect(ch chan<- prometheus.Metric) {
-	um, err := ParseUsersMetrics(uc.logger)
+func (uc *UsersCollector) Update(s *Snapshot, ch chan<- prometheus.Metric) error {
+	jobs, err := s.Jobs()
 	if err != nil {
-		uc.logger.Error("Failed to parse users metrics", "err", err)
-		return
+		return err
 	}
+	um := ParseUsersMetrics(jobs)
 	for u := range um {
 		if um[u].pending > 0 {
 			ch <- prometheus.MustNewConstMetric(uc.pending, prometheus.GaugeValue, um[u].pending, u)
@@ -109,5 +113,18 @@ func (uc *UsersCollector) Collect(ch chan<- prometheus.Metric) {
 		if um[u].suspended > 0 {
 			ch <- prometheus.MustNewConstMetric(uc.suspended, prometheus.GaugeValue, um[u].suspended, u)
 		}
+		if um[u].running_mem > 0 {
+			ch <- prometheus.MustNewConstMetric(uc.running_mem, prometheus.GaugeValue, um[u].running_mem, u)
+		}
+		if um[u].running_nodes > 0 {
+			ch <- prometheus.MustNewConstMetric(uc.running_nodes, prometheus.GaugeValue, um[u].running_nodes, u)
+		}
+		for gpuType, gpus := range um[u].running_gpus {
+			ch <- prometheus.MustNewConstMetric(uc.running_gpus, prometheus.GaugeValue, gpus, u, gpuType)
+		}
+		for gpuType, gpus := range um[u].pending_gpus {
+			ch <- prometheus.MustNewConstMetric(uc.pending_gpus, prometheus.GaugeValue, gpus, u, gpuType)
+		}
 	}
-}
\ No newline at end of file
+	return nil
+}
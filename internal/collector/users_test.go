@@ -0,0 +1,44 @@
+package collector
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseUsersMetrics(t *testing.T) {
+	data, err := os.ReadFile("../../test_data/squeue.txt")
+	assert.NoError(t, err)
+
+	users := ParseUsersMetrics(ParseJobs(data))
+	assert.Len(t, users, 2)
+
+	foo := users["foo"]
+	assert.Equal(t, 19.0, foo.running)
+	assert.Equal(t, 19.0, foo.running_nodes)
+	assert.Equal(t, 19*48*1024.0, foo.running_mem)
+	assert.Empty(t, foo.running_gpus)
+
+	// One of the running jobs of bar spans two nodes with four GPUs.
+	bar := users["bar"]
+	assert.Equal(t, 10.0, bar.running_nodes)
+	assert.Equal(t, (8*96+192)*1024.0, bar.running_mem)
+	assert.Equal(t, map[string]float64{"a100": 20}, bar.running_gpus)
+	// Pending jobs only request untyped GPUs in their TRES, the type comes
+	// from tres-per-node.
+	assert.Equal(t, map[string]float64{"h100": 8}, bar.pending_gpus)
+}
+
+func TestJobGPUTypes(t *testing.T) {
+	assert.Empty(t, jobGPUTypes(Job{TRES: map[string]float64{"cpu": 4}, TRESPerNode: "N/A"}))
+	assert.Equal(t, map[string]float64{"": 2}, jobGPUTypes(Job{TRES: map[string]float64{"gres/gpu": 2}, TRESPerNode: "gres/gpu:2"}))
+	// Requests of several types are left untyped.
+	assert.Equal(t, map[string]float64{"": 3}, jobGPUTypes(Job{
+		TRES:        map[string]float64{"gres/gpu": 3},
+		TRESPerNode: "gres/gpu:a100:1,gres/gpu:h100:2",
+	}))
+	assert.Equal(t, map[string]float64{"a100": 1, "h100": 2}, jobGPUTypes(Job{
+		TRES: map[string]float64{"gres/gpu": 3, "gres/gpu:a100": 1, "gres/gpu:h100": 2},
+	}))
+}
@@ -0,0 +1,107 @@
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// timeoutCollector fails the runs of a Collector that take longer than timeout.
+type timeoutCollector struct {
+	Collector
+	timeout time.Duration
+}
+
+// WithTimeout bounds every run of c to timeout. The metrics of a run are
+// only sent once it completes in time; a late run is left to finish in the
+// background and its metrics are dropped.
+func WithTimeout(c Collector, timeout time.Duration) Collector {
+	if timeout <= 0 {
+		return c
+	}
+	return &timeoutCollector{Collector: c, timeout: timeout}
+}
+
+func (tc *timeoutCollector) Update(s *Snapshot, ch chan<- prometheus.Metric) error {
+	metrics := make(chan prometheus.Metric)
+	var err error
+	go func() {
+		err = tc.Collector.Update(s, metrics)
+		close(metrics)
+	}()
+
+	timer := time.NewTimer(tc.timeout)
+	defer timer.Stop()
+	var buffered []prometheus.Metric
+	for {
+		select {
+		case m, ok := <-metrics:
+			if !ok {
+				for _, m := range buffered {
+					ch <- m
+				}
+				return err
+			}
+			buffered = append(buffered, m)
+		case <-timer.C:
+			go func() {
+				for range metrics {
+				}
+			}()
+			return fmt.Errorf("collector timed out after %s", tc.timeout)
+		}
+	}
+}
+
+// filterCollector drops the series of a Collector by label value.
+type filterCollector struct {
+	Collector
+	include map[string]*regexp.Regexp
+	exclude map[string]*regexp.Regexp
+}
+
+// WithLabelFilters keeps the series of c whose labels match every include
+// filter they have, and none of the exclude filters.
+func WithLabelFilters(c Collector, include, exclude map[string]*regexp.Regexp) Collector {
+	if len(include) == 0 && len(exclude) == 0 {
+		return c
+	}
+	return &filterCollector{Collector: c, include: include, exclude: exclude}
+}
+
+func (fc *filterCollector) Update(s *Snapshot, ch chan<- prometheus.Metric) error {
+	metrics := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		for m := range metrics {
+			if fc.keep(m) {
+				ch <- m
+			}
+		}
+		close(done)
+	}()
+	err := fc.Collector.Update(s, metrics)
+	close(metrics)
+	<-done
+	return err
+}
+
+// keep reports whether the labels of m pass the filters.
+func (fc *filterCollector) keep(m prometheus.Metric) bool {
+	var pb dto.Metric
+	if err := m.Write(&pb); err != nil {
+		return true
+	}
+	for _, label := range pb.GetLabel() {
+		if re, ok := fc.include[label.GetName()]; ok && !re.MatchString(label.GetValue()) {
+			return false
+		}
+		if re, ok := fc.exclude[label.GetName()]; ok && re.MatchString(label.GetValue()) {
+			return false
+		}
+	}
+	return true
+}
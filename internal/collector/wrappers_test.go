@@ -0,0 +1,67 @@
+package collector
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// partitionCollector exports one series per partition after an optional delay.
+type partitionCollector struct {
+	desc       *prometheus.Desc
+	partitions []string
+	delay      time.Duration
+}
+
+func newPartitionCollector(delay time.Duration, partitions ...string) *partitionCollector {
+	return &partitionCollector{
+		desc:       prometheus.NewDesc("slurm_partition_fake", "Fake metric", []string{"partition"}, nil),
+		partitions: partitions,
+		delay:      delay,
+	}
+}
+
+func (fc *partitionCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- fc.desc
+}
+
+func (fc *partitionCollector) Update(s *Snapshot, ch chan<- prometheus.Metric) error {
+	time.Sleep(fc.delay)
+	for _, p := range fc.partitions {
+		ch <- prometheus.MustNewConstMetric(fc.desc, prometheus.GaugeValue, 1, p)
+	}
+	return nil
+}
+
+func TestWithTimeout(t *testing.T) {
+	c := newPartitionCollector(0, "batch")
+	assert.Same(t, Collector(c), WithTimeout(c, 0), "no timeout leaves the collector unwrapped")
+
+	ch := make(chan prometheus.Metric, 10)
+	assert.NoError(t, WithTimeout(c, time.Second).Update(nil, ch))
+	assert.Len(t, ch, 1)
+
+	slow := WithTimeout(newPartitionCollector(200*time.Millisecond, "batch"), 10*time.Millisecond)
+	ch = make(chan prometheus.Metric, 10)
+	assert.ErrorContains(t, slow.Update(nil, ch), "timed out")
+	time.Sleep(300 * time.Millisecond)
+	assert.Len(t, ch, 0, "metrics of a late run are dropped")
+}
+
+func TestWithLabelFilters(t *testing.T) {
+	c := WithLabelFilters(newPartitionCollector(0, "batch", "gpu", "debug"),
+		map[string]*regexp.Regexp{"partition": regexp.MustCompile("^(?:batch|debug)$")},
+		map[string]*regexp.Regexp{"partition": regexp.MustCompile("^(?:debug)$")})
+
+	expected := `
+# HELP slurm_partition_fake Fake metric
+# TYPE slurm_partition_fake gauge
+slurm_partition_fake{partition="batch"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(updater{c}, strings.NewReader(expected)))
+}
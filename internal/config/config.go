@@ -0,0 +1,99 @@
+// Package config loads the YAML configuration file of the exporter
+// (--config.file). Every setting is optional; unset settings keep the value
+// of the corresponding command-line flag.
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the content of the configuration file.
+type Config struct {
+	// Commands maps Slurm commands such as "squeue" to the path of the
+	// binary to execute.
+	Commands map[string]string `yaml:"commands"`
+	// CommandPolicies overrides the timeout and retries of Slurm commands,
+	// by command name or by command and leading arguments such as
+	// "scontrol show assoc_mgr".
+	CommandPolicies map[string]CommandPolicy `yaml:"command_policies"`
+	Collectors      map[string]Collector     `yaml:"collectors"`
+}
+
+// CommandPolicy configures the execution of a Slurm command. Unset settings
+// keep --command.timeout, --command.retries and --command.retry-backoff.
+type CommandPolicy struct {
+	Timeout      time.Duration `yaml:"timeout"`
+	Retries      *int          `yaml:"retries"`
+	RetryBackoff time.Duration `yaml:"retry_backoff"`
+}
+
+// Collector configures a single collector.
+type Collector struct {
+	// Enabled overrides --collector.<name> when set.
+	Enabled *bool `yaml:"enabled"`
+	// Timeout bounds a whole run of the collector. Runs that take longer
+	// fail and their metrics are dropped.
+	Timeout time.Duration `yaml:"timeout"`
+	// Interval is how long the metrics of the collector are cached in
+	// background mode, overriding --scrape.collector-interval.
+	Interval time.Duration `yaml:"interval"`
+	// Labels chooses the label dimensions of the queue collector families,
+	// overriding --collector.queue.labels.
+	Labels map[string]string `yaml:"labels"`
+	// IncludeLabels and ExcludeLabels filter the series of the collector by
+	// label value, with fully anchored regular expressions. A series is kept
+	// when every included label it has matches and no excluded label does.
+	IncludeLabels map[string]string `yaml:"include_labels"`
+	ExcludeLabels map[string]string `yaml:"exclude_labels"`
+}
+
+// Load reads and validates the configuration file at path.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	for command, p := range cfg.CommandPolicies {
+		if p.Timeout < 0 || p.RetryBackoff < 0 || (p.Retries != nil && *p.Retries < 0) {
+			return nil, fmt.Errorf("command %q: timeout, retries and retry_backoff must not be negative", command)
+		}
+	}
+	for name, c := range cfg.Collectors {
+		if c.Timeout < 0 || c.Interval < 0 {
+			return nil, fmt.Errorf("collector %q: timeout and interval must not be negative", name)
+		}
+		if _, err := CompileFilters(c.IncludeLabels); err != nil {
+			return nil, fmt.Errorf("collector %q: include_labels: %w", name, err)
+		}
+		if _, err := CompileFilters(c.ExcludeLabels); err != nil {
+			return nil, fmt.Errorf("collector %q: exclude_labels: %w", name, err)
+		}
+	}
+	return cfg, nil
+}
+
+// CompileFilters compiles label filters into fully anchored regular
+// expressions, by label name.
+func CompileFilters(filters map[string]string) (map[string]*regexp.Regexp, error) {
+	if len(filters) == 0 {
+		return nil, nil
+	}
+	compiled := make(map[string]*regexp.Regexp, len(filters))
+	for label, expr := range filters {
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("label %q: %w", label, err)
+		}
+		compiled[label] = re
+	}
+	return compiled, nil
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	cfg, err := Load("../../test_data/config.yml")
+	assert.NoError(t, err)
+
+	assert.Equal(t, "/opt/slurm/bin/squeue", cfg.Commands["squeue"])
+	assert.Len(t, cfg.Collectors, 4)
+
+	assert.Equal(t, time.Minute, cfg.CommandPolicies["sacctmgr"].Timeout)
+	assert.Nil(t, cfg.CommandPolicies["sacctmgr"].Retries)
+	assert.Equal(t, 0, *cfg.CommandPolicies["scontrol show assoc_mgr"].Retries)
+	assert.Equal(t, 1, *cfg.CommandPolicies["squeue"].Retries)
+	assert.Equal(t, 500*time.Millisecond, cfg.CommandPolicies["squeue"].RetryBackoff)
+
+	queue := cfg.Collectors["queue"]
+	assert.Nil(t, queue.Enabled)
+	assert.Equal(t, 10*time.Second, queue.Timeout)
+	assert.Equal(t, "partition,reason", queue.Labels["pending"])
+	assert.Equal(t, "debug|test", queue.ExcludeLabels["partition"])
+
+	assert.True(t, *cfg.Collectors["sprio"].Enabled)
+	assert.Equal(t, 5*time.Minute, cfg.Collectors["sprio"].Interval)
+	assert.False(t, *cfg.Collectors["users"].Enabled)
+}
+
+func TestLoadInvalid(t *testing.T) {
+	for name, content := range map[string]string{
+		"unknown field":    "collectors:\n  queue:\n    timout: 10s\n",
+		"invalid duration": "collectors:\n  queue:\n    timeout: soon\n",
+		"negative timeout": "collectors:\n  queue:\n    timeout: -1s\n",
+		"negative retries": "command_policies:\n  sacct:\n    retries: -1\n",
+		"invalid filter":   "collectors:\n  queue:\n    include_labels:\n      user: \"(\"\n",
+	} {
+		path := filepath.Join(t.TempDir(), "config.yml")
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		_, err := Load(path)
+		assert.Error(t, err, name)
+	}
+
+	_, err := Load("missing.yml")
+	assert.Error(t, err)
+}
+
+func TestCompileFilters(t *testing.T) {
+	filters, err := CompileFilters(map[string]string{"partition": "gpu|debug"})
+	assert.NoError(t, err)
+	assert.True(t, filters["partition"].MatchString("gpu"))
+	assert.False(t, filters["partition"].MatchString("gpu2"), "filters are anchored")
+
+	filters, err = CompileFilters(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, filters)
+}
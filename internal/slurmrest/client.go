@@ -0,0 +1,233 @@
+/*
+Package slurmrest implements a collector backend that talks to slurmrestd
+instead of running the Slurm client binaries.
+
+The client renders the JSON returned by the slurmrestd OpenAPI endpoints into
+the same text the CLI tools print, so every collector keeps using its existing
+parser and exports the same metric families in both modes.
+*/
+package slurmrest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// DefaultAPIVersion is the slurmrestd OpenAPI version used when none is configured.
+const DefaultAPIVersion = "v0.0.40"
+
+// Config holds the settings needed to reach slurmrestd.
+type Config struct {
+	URL        string // Base URL of slurmrestd, e.g. http://slurmrestd:6820
+	APIVersion string // OpenAPI plugin version, e.g. v0.0.40
+	User       string // Value of the X-SLURM-USER-NAME header (optional)
+	TokenFile  string // File holding the JWT, re-read on every request
+	Token      string // JWT used when no token file is configured
+}
+
+// Client fetches data from slurmrestd and renders it as CLI output.
+type Client struct {
+	cfg        Config
+	httpClient *http.Client
+}
+
+// NewClient creates a slurmrestd client from the given configuration.
+func NewClient(cfg Config) (*Client, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("slurmrestd URL must not be empty")
+	}
+	if cfg.APIVersion == "" {
+		cfg.APIVersion = DefaultAPIVersion
+	}
+	cfg.URL = strings.TrimSuffix(cfg.URL, "/")
+	return &Client{cfg: cfg, httpClient: &http.Client{}}, nil
+}
+
+// Run returns the output the given Slurm command would have printed. Its
+// signature matches collector.Runner so it can be used as a drop-in backend.
+func (c *Client) Run(ctx context.Context, command string, args []string) ([]byte, error) {
+	for _, arg := range args {
+		if arg == "--version" {
+			return c.version(ctx)
+		}
+	}
+
+	switch command {
+	case "squeue":
+		var resp jobsResponse
+		if err := c.get(ctx, "/slurm/"+c.cfg.APIVersion+"/jobs", &resp); err != nil {
+			return nil, err
+		}
+		return renderSqueue(resp.Jobs, args)
+	case "sinfo":
+		var resp nodesResponse
+		if err := c.get(ctx, "/slurm/"+c.cfg.APIVersion+"/nodes", &resp); err != nil {
+			return nil, err
+		}
+		return renderSinfo(resp.Nodes, args)
+	case "sdiag":
+		var resp diagResponse
+		if err := c.get(ctx, "/slurm/"+c.cfg.APIVersion+"/diag", &resp); err != nil {
+			return nil, err
+		}
+		return renderSdiag(resp.Statistics), nil
+	case "sshare":
+		var resp sharesResponse
+		if err := c.get(ctx, "/slurm/"+c.cfg.APIVersion+"/shares", &resp); err != nil {
+			return nil, err
+		}
+		return renderSshare(resp.Shares.Shares, args)
+	case "scontrol":
+		return c.scontrol(ctx, args)
+	case "sacctmgr":
+		return c.sacctmgr(ctx, args)
+	}
+	return nil, unsupported(command, args)
+}
+
+// scontrol handles the "scontrol show ..." subcommands used by the collectors.
+func (c *Client) scontrol(ctx context.Context, args []string) ([]byte, error) {
+	if len(args) == 1 && args[0] == "ping" {
+		var resp pingResponse
+		if err := c.get(ctx, "/slurm/"+c.cfg.APIVersion+"/ping", &resp); err != nil {
+			return nil, err
+		}
+		return renderPing(resp.Pings), nil
+	}
+	if len(args) < 2 || args[0] != "show" {
+		return nil, unsupported("scontrol", args)
+	}
+	switch args[1] {
+	case "node", "nodes":
+		var resp nodesResponse
+		if err := c.get(ctx, "/slurm/"+c.cfg.APIVersion+"/nodes", &resp); err != nil {
+			return nil, err
+		}
+		return renderScontrolNodes(resp.Nodes), nil
+	case "reservation", "reservations":
+		var resp reservationsResponse
+		if err := c.get(ctx, "/slurm/"+c.cfg.APIVersion+"/reservations", &resp); err != nil {
+			return nil, err
+		}
+		return renderReservations(resp.Reservations), nil
+	case "license", "licenses":
+		var resp licensesResponse
+		if err := c.get(ctx, "/slurm/"+c.cfg.APIVersion+"/licenses", &resp); err != nil {
+			return nil, err
+		}
+		return renderLicenses(resp.Licenses), nil
+	}
+	return nil, unsupported("scontrol", args)
+}
+
+// sacctmgr handles "sacctmgr show cluster", the clusters registered in slurmdbd.
+func (c *Client) sacctmgr(ctx context.Context, args []string) ([]byte, error) {
+	show := -1
+	for i, arg := range args {
+		if arg == "show" {
+			show = i
+		}
+	}
+	if show < 0 || show+1 >= len(args) || args[show+1] != "cluster" {
+		return nil, unsupported("sacctmgr", args)
+	}
+	var resp clustersResponse
+	if err := c.get(ctx, "/slurmdb/"+c.cfg.APIVersion+"/clusters", &resp); err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	for _, cluster := range resp.Clusters {
+		b.WriteString(cluster.Name + "\n")
+	}
+	return []byte(b.String()), nil
+}
+
+// version renders the "slurm X.Y.Z" line printed by every binary's --version flag.
+func (c *Client) version(ctx context.Context) ([]byte, error) {
+	var resp pingResponse
+	if err := c.get(ctx, "/slurm/"+c.cfg.APIVersion+"/ping", &resp); err != nil {
+		return nil, err
+	}
+	release := resp.Meta.Slurm.Release
+	if release == "" {
+		v := resp.Meta.Slurm.Version
+		release = fmt.Sprintf("%s.%s.%s", v.Major, v.Minor, v.Micro)
+	}
+	return []byte("slurm " + release + "\n"), nil
+}
+
+// get performs an authenticated GET request and decodes the JSON response into v.
+func (c *Client) get(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.cfg.URL+path, nil)
+	if err != nil {
+		return err
+	}
+	token, err := c.token()
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-SLURM-USER-TOKEN", token)
+	}
+	if c.cfg.User != "" {
+		req.Header.Set("X-SLURM-USER-NAME", c.cfg.User)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var envelope response
+	// slurmrestd reports failures in the errors array, usually together with a
+	// non-2xx status; prefer its description over the bare status code.
+	if jsonErr := json.Unmarshal(body, &envelope); jsonErr == nil && len(envelope.Errors) > 0 {
+		e := envelope.Errors[0]
+		msg := e.Description
+		if msg == "" {
+			msg = e.Error
+		}
+		return fmt.Errorf("slurmrestd %s: %s (error %d)", path, msg, e.ErrorNumber)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("slurmrestd %s: unexpected status %s", path, resp.Status)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("slurmrestd %s: %w", path, err)
+	}
+	return nil
+}
+
+// token returns the JWT to authenticate with. The token file is re-read on
+// every request so that rotated tokens are picked up without a restart. Both
+// a bare token and the "SLURM_JWT=<token>" line printed by "scontrol token"
+// are accepted.
+func (c *Client) token() (string, error) {
+	token := c.cfg.Token
+	if c.cfg.TokenFile != "" {
+		data, err := os.ReadFile(c.cfg.TokenFile)
+		if err != nil {
+			return "", fmt.Errorf("reading slurmrestd token: %w", err)
+		}
+		token = string(data)
+	}
+	token = strings.TrimSpace(token)
+	return strings.TrimPrefix(token, "SLURM_JWT="), nil
+}
+
+func unsupported(command string, args []string) error {
+	return fmt.Errorf("%s %s is not supported by the slurmrestd backend", command, strings.Join(args, " "))
+}
@@ -0,0 +1,205 @@
+package slurmrest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestServer serves the recorded slurmrestd responses from test_data/slurmrest.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-SLURM-USER-TOKEN") != "test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"errors":[{"description":"Authentication failure","error_number":1007}]}`))
+			return
+		}
+		name := strings.TrimPrefix(r.URL.Path, "/slurm/"+DefaultAPIVersion+"/")
+		name = strings.TrimPrefix(name, "/slurmdb/"+DefaultAPIVersion+"/")
+		data, err := os.ReadFile(filepath.Join("../../test_data/slurmrest", name+".json"))
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+	client, err := NewClient(Config{URL: newTestServer(t).URL, Token: "test-token"})
+	if err != nil {
+		t.Fatalf("NewClient() error: %v", err)
+	}
+	return client
+}
+
+func run(t *testing.T, c *Client, command string, args ...string) string {
+	t.Helper()
+	out, err := c.Run(context.Background(), command, args)
+	if err != nil {
+		t.Fatalf("Run(%s %v) error: %v", command, args, err)
+	}
+	return string(out)
+}
+
+func TestRunVersion(t *testing.T) {
+	c := newTestClient(t)
+	assert.Equal(t, "slurm 23.11.10\n", run(t, c, "sinfo", "--version"))
+}
+
+func TestRunSqueue(t *testing.T) {
+	c := newTestClient(t)
+
+	out := run(t, c, "squeue", "-h", "-o", "%P,%T,%C,%r,%u")
+	assert.Equal(t, strings.Join([]string{
+		"batch,RUNNING,32,None,alice",
+		"batch,PENDING,16,Priority,bob",
+		"gpu,PENDING,8,Resources,alice",
+		"gpu,RUNNING,8,None,alice",
+		"batch,COMPLETING,4,None,carol",
+	}, "\n")+"\n", out)
+
+	out = run(t, c, "squeue", "-a", "-r", "-h", "-o", "%i|%a|%T", "--states=PENDING")
+	assert.Equal(t, "1002|chemistry|PENDING\n1003_1|physics|PENDING\n1003_2|physics|PENDING\n1003_3|physics|PENDING\n", out)
+
+	out = run(t, c, "squeue", "-h", "-o", "%i")
+	assert.Contains(t, out, "1003_[1-3]\n")
+	assert.Contains(t, out, "1003_0\n")
+
+	// Jobs without an allocation print their requested TRES.
+	out = run(t, c, "squeue", "-h", "-O", "JobArrayID:|,NumNodes:|,tres-alloc:|,tres-per-node:", "--states=PENDING,RUNNING")
+	assert.Equal(t, strings.Join([]string{
+		"1001|1|cpu=32,mem=128G,node=1,billing=32|N/A",
+		"1002|2|cpu=16,mem=64G,node=2,billing=16|N/A",
+		"1003_[1-3]|1|cpu=8,mem=32G,node=1,billing=8,gres/gpu=1|gres/gpu:a100:1",
+		"1003_0|1|cpu=8,mem=32G,node=1,billing=8,gres/gpu=1,gres/gpu:a100=1|gres/gpu:a100:1",
+	}, "\n")+"\n", out)
+
+	// Pending jobs print their expected start time, N/A without estimate.
+	at := func(sec int64) string { return time.Unix(sec, 0).Format(slurmTimeLayout) }
+	out = run(t, c, "squeue", "-h", "-O", "JobID:|,SubmitTime:|,EligibleTime:|,StartTime:", "--states=PENDING")
+	assert.Equal(t, strings.Join([]string{
+		"1002|" + at(1735603600) + "|" + at(1735603600) + "|" + at(1735610800),
+		"1003|" + at(1735603000) + "|Unknown|N/A",
+	}, "\n")+"\n", out)
+
+	out = run(t, c, "squeue", "-h", "-o", "%i|%l")
+	assert.Equal(t, "1001|1-00:00:00\n1002|2:00:00\n1003_[1-3]|30:00\n1003_0|UNLIMITED\n1004|2-00:00:00\n", out)
+}
+
+func TestRunSinfo(t *testing.T) {
+	c := newTestClient(t)
+
+	// Nodes in several partitions are only counted once without %R.
+	assert.Equal(t, "64/96/96/256\n", run(t, c, "sinfo", "-h", "-o", "%C"))
+
+	out := run(t, c, "sinfo", "-h", "-o", "%R,%C")
+	assert.Equal(t, "batch,32/96/64/192\nall,64/96/0/160\ngpu,32/0/32/64\n", out)
+
+	out = run(t, c, "sinfo", "-h", "-o", "%D|%T|%b", "-p", "batch")
+	assert.Equal(t, "1|idle|skylake\n1|mixed|skylake\n1|drained|skylake\n", out)
+
+	out = run(t, c, "sinfo", "-h", "-o", "%D|%T|%b", "-p", "gpu")
+	assert.Equal(t, "1|allocated|ampere,nvlink\n1|down*|hopper\n", out)
+
+	out = run(t, c, "sinfo", "-a", "-h", "--Format=Nodes: ,Gres: ,GresUsed:", "--state=idle,allocated")
+	assert.Equal(t, "2 (null) (null)\n1 gpu:a100:4(S:0-1) gpu:a100:4(IDX:0-3)\n", out)
+
+	out = run(t, c, "sinfo", "-h", "-N", "-O", "NodeList:10,CPUsState:|,StateLong:|,Reason:|,UserLong:|,Partition:")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	assert.Len(t, lines, 8)
+	assert.Equal(t, "cn003     0/0/64/64|drained|bad dimm|root|batch", lines[4])
+}
+
+func TestRunSdiag(t *testing.T) {
+	c := newTestClient(t)
+	out := run(t, c, "sdiag")
+	assert.Contains(t, out, "Server thread count:  3\n")
+	assert.Contains(t, out, "\tLast cycle:   97209\n")
+	assert.Contains(t, out, "\tTotal backfilled jobs (since last slurm start): 111544\n")
+	assert.Contains(t, out, "\tDepth Mean: 29324\n")
+	assert.Regexp(t, `REQUEST_JOB_INFO\s+\( 2003\) count:11650\s+ave_time:5265\s+total_time:61339622`, out)
+	assert.Regexp(t, `alice\s+\(    1001\) count:2308\s+ave_time:2058\s+total_time:4751906`, out)
+	assert.Regexp(t, `REQUEST_TERMINATE_JOB\s+\( 6011\) count:10\n`, out)
+}
+
+func TestRunSshare(t *testing.T) {
+	c := newTestClient(t)
+	out := run(t, c, "sshare", "-n", "-P", "-o", "account,fairshare")
+	assert.Equal(t, strings.Join([]string{
+		"root|0.000000",
+		" physics|0.250000",
+		"  physics|0.250000",
+		" chemistry|0.750000",
+		"  chemistry|0.750000",
+	}, "\n")+"\n", out)
+
+	out = run(t, c, "sshare", "-a", "-l", "-m", "-P")
+	assert.True(t, strings.HasPrefix(out, "Account|User|Partition|RawShares|NormShares|"))
+}
+
+func TestRunScontrol(t *testing.T) {
+	c := newTestClient(t)
+
+	out := run(t, c, "scontrol", "show", "nodes", "-o")
+	assert.Len(t, strings.Split(strings.TrimSpace(out), "\n"), 5)
+	assert.Contains(t, out, "NodeName=gpu002 ")
+	assert.Contains(t, out, " CPULoad=31.5 AvailableFeatures=ampere,nvlink ActiveFeatures=ampere,nvlink ")
+	assert.Contains(t, out, " FreeMem=98000 ")
+	assert.Contains(t, out, " CfgTRES=cpu=32,mem=515000M,billing=32,gres/gpu=4 AllocTRES=cpu=32,mem=400000M,gres/gpu=4 CurrentWatts=1450 AveWatts=1210 ")
+	assert.Contains(t, out, "NodeName=gpu002 CPUAlloc=0 CPUTot=32 CPULoad=N/A ")
+	assert.Contains(t, out, " State=IDLE+DRAIN NextState=RESUME Partitions=batch ")
+	assert.NotContains(t, out, "State=MIXED NextState")
+
+	out = run(t, c, "scontrol", "show", "reservation")
+	assert.Contains(t, out, "ReservationName=pre-reservation-maintenance ")
+	assert.Contains(t, out, "NodeCnt=102 CoreCnt=25152 ")
+	assert.Contains(t, out, "Flags=SPEC_NODES,ALL_NODES")
+	assert.Contains(t, out, "Users=user01 ")
+
+	out = run(t, c, "scontrol", "show", "licenses", "-o")
+	assert.Len(t, strings.Split(strings.TrimSpace(out), "\n"), 2)
+	assert.Contains(t, out, "LicenseName=matlab Total=50 Used=12 Free=38 Reserved=0 Remote=no ")
+	assert.Contains(t, out, "LicenseName=ansys@slurmdb Total=100 Used=85 Free=5 Reserved=10 Remote=yes LastConsumed=95 LastDeficit=10 ")
+}
+
+func TestRunPing(t *testing.T) {
+	c := newTestClient(t)
+	assert.Equal(t, "Slurmctld(primary) at slurmctld-1 is UP\n", run(t, c, "scontrol", "ping"))
+	assert.Equal(t, "cluster01\n", run(t, c, "sacctmgr", "-n", "-P", "show", "cluster", "format=Cluster"))
+}
+
+func TestRunErrors(t *testing.T) {
+	c := newTestClient(t)
+
+	_, err := c.Run(context.Background(), "sacct", []string{"-a"})
+	assert.ErrorContains(t, err, "not supported by the slurmrestd backend")
+
+	_, err = c.Run(context.Background(), "squeue", []string{"-h", "-o", "%Z"})
+	assert.ErrorContains(t, err, "%Z")
+
+	unauthenticated, err := NewClient(Config{URL: c.cfg.URL})
+	assert.NoError(t, err)
+	_, err = unauthenticated.Run(context.Background(), "sdiag", nil)
+	assert.ErrorContains(t, err, "Authentication failure")
+}
+
+func TestTokenFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, os.WriteFile(path, []byte("SLURM_JWT=test-token\n"), 0o600))
+
+	c, err := NewClient(Config{URL: newTestServer(t).URL, TokenFile: path, Token: "ignored"})
+	assert.NoError(t, err)
+	assert.Equal(t, "slurm 23.11.10\n", run(t, c, "sdiag", "--version"))
+}
@@ -0,0 +1,272 @@
+package slurmrest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// slurmTimeLayout is the timestamp format printed by the Slurm CLI tools.
+const slurmTimeLayout = "2006-01-02T15:04:05"
+
+// field is a single column of a -o/--format or -O/--Format specification.
+type field struct {
+	name   string // canonical lower-case field name, empty for trailing literal text
+	prefix string // literal text printed before the field (-o formats only)
+	width  int
+	right  bool
+	suffix string
+}
+
+// options holds the command-line options understood by the renderers.
+type options struct {
+	noHeader     bool
+	nodeOriented bool // sinfo -N
+	expandArrays bool // squeue -r
+	format       []field
+	partitions   []string
+	states       []string
+}
+
+// squeueCodes maps squeue -o format letters to -O field names.
+var squeueCodes = map[byte]string{
+	'A': "jobid",
+	'a': "account",
+	'b': "tres-per-node",
+	'C': "numcpus",
+	'D': "numnodes",
+	'i': "jobarrayid",
+	'j': "name",
+	'l': "timelimit",
+	'P': "partition",
+	'q': "qos",
+	'r': "reason",
+	'S': "starttime",
+	'T': "state",
+	't': "statecompact",
+	'u': "username",
+	'V': "submittime",
+}
+
+// sinfoCodes maps sinfo -o format letters to -O field names.
+var sinfoCodes = map[byte]string{
+	'b': "featuresact",
+	'C': "cpusstate",
+	'c': "cpus",
+	'D': "nodes",
+	'E': "reason",
+	'f': "features",
+	'G': "gres",
+	'H': "timestamp",
+	'm': "memory",
+	'N': "nodelist",
+	'n': "nodehost",
+	'P': "partition",
+	'R': "partitionname",
+	'T': "statelong",
+	't': "statecompact",
+}
+
+// parseOptions parses the arguments passed to squeue or sinfo.
+func parseOptions(args []string, codes map[byte]string) (*options, error) {
+	opts := &options{}
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(args[i], "=")
+		if !strings.HasPrefix(name, "--") {
+			hasValue = false
+			name = args[i]
+		}
+		next := func() (string, error) {
+			if hasValue {
+				return value, nil
+			}
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("option %s requires an argument", name)
+			}
+			i++
+			return args[i], nil
+		}
+
+		var err error
+		var v string
+		switch name {
+		case "-h", "--noheader":
+			opts.noHeader = true
+		case "-a", "--all":
+			// Hidden partitions are always visible through the REST API.
+		case "-r", "--array":
+			opts.expandArrays = true
+		case "-N", "--Node":
+			opts.nodeOriented = true
+		case "-o", "--format":
+			if v, err = next(); err == nil {
+				opts.format, err = parseShortFormat(v, codes)
+			}
+		case "-O", "--Format":
+			if v, err = next(); err == nil {
+				opts.format = parseLongFormat(v)
+			}
+		case "-p", "--partition":
+			if v, err = next(); err == nil {
+				opts.partitions = splitList(v)
+			}
+		case "-t", "--state", "--states":
+			if v, err = next(); err == nil {
+				opts.states = splitList(strings.ToLower(v))
+			}
+		default:
+			return nil, fmt.Errorf("option %s is not supported by the slurmrestd backend", args[i])
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(opts.format) == 0 {
+		return nil, fmt.Errorf("an explicit output format is required by the slurmrestd backend")
+	}
+	return opts, nil
+}
+
+// parseShortFormat parses a -o specification such as "%P,%.5T|%C".
+func parseShortFormat(spec string, codes map[byte]string) ([]field, error) {
+	var fields []field
+	var literal strings.Builder
+	for i := 0; i < len(spec); i++ {
+		if spec[i] != '%' || i+1 >= len(spec) {
+			literal.WriteByte(spec[i])
+			continue
+		}
+		f := field{prefix: literal.String()}
+		literal.Reset()
+		i++
+		if spec[i] == '.' {
+			f.right = true
+			i++
+		}
+		start := i
+		for i < len(spec) && spec[i] >= '0' && spec[i] <= '9' {
+			i++
+		}
+		f.width, _ = strconv.Atoi(spec[start:i])
+		if i >= len(spec) {
+			return nil, fmt.Errorf("truncated format specification %q", spec)
+		}
+		name, ok := codes[spec[i]]
+		if !ok {
+			return nil, fmt.Errorf("format field %%%c is not supported by the slurmrestd backend", spec[i])
+		}
+		f.name = name
+		fields = append(fields, f)
+	}
+	if literal.Len() > 0 {
+		fields = append(fields, field{prefix: literal.String()})
+	}
+	return fields, nil
+}
+
+// parseLongFormat parses a -O specification such as "NodeList:25,Gres: ,GresUsed:".
+// Fields without an explicit size use the CLI default of 20 characters
+// followed by a single space.
+func parseLongFormat(spec string) []field {
+	var fields []field
+	for _, item := range strings.Split(spec, ",") {
+		name, size, hasSize := strings.Cut(item, ":")
+		f := field{name: strings.ToLower(strings.TrimSpace(name))}
+		if !hasSize {
+			f.width = 20
+			f.suffix = " "
+		} else {
+			if strings.HasPrefix(size, ".") {
+				f.right = true
+				size = size[1:]
+			}
+			end := 0
+			for end < len(size) && size[end] >= '0' && size[end] <= '9' {
+				end++
+			}
+			f.width, _ = strconv.Atoi(size[:end])
+			f.suffix = size[end:]
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// writeLine renders a single output line, resolving field values through value.
+func writeLine(b *strings.Builder, fields []field, value func(name string) (string, error)) error {
+	for _, f := range fields {
+		b.WriteString(f.prefix)
+		if f.name == "" {
+			continue
+		}
+		v, err := value(f.name)
+		if err != nil {
+			return err
+		}
+		switch {
+		case len(v) >= f.width:
+			b.WriteString(v)
+		case f.right:
+			b.WriteString(strings.Repeat(" ", f.width-len(v)) + v)
+		default:
+			b.WriteString(v + strings.Repeat(" ", f.width-len(v)))
+		}
+		b.WriteString(f.suffix)
+	}
+	b.WriteByte('\n')
+	return nil
+}
+
+func unknownField(command, name string) error {
+	return fmt.Errorf("%s field %q is not supported by the slurmrestd backend", command, name)
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// formatTime renders a Unix timestamp like the CLI tools, or "Unknown" when unset.
+func formatTime(n number) string {
+	if n.Value() <= 0 {
+		return "Unknown"
+	}
+	return time.Unix(int64(n.Value()), 0).Format(slurmTimeLayout)
+}
+
+// formatTimeLimit formats a time limit in minutes like squeue %l, e.g.
+// "1-00:00:00", "2:00:00" or "30:00".
+func formatTimeLimit(n number) string {
+	if n.Infinite {
+		return "UNLIMITED"
+	}
+	if !n.Set {
+		return "NOT_SET"
+	}
+	minutes := int64(n.Value())
+	days, hours, mins := minutes/1440, minutes%1440/60, minutes%60
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%d-%02d:%02d:00", days, hours, mins)
+	case hours > 0:
+		return fmt.Sprintf("%d:%02d:00", hours, mins)
+	}
+	return fmt.Sprintf("%d:00", mins)
+}
+
+func orDefault(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
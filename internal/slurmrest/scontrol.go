@@ -0,0 +1,118 @@
+package slurmrest
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// renderScontrolNodes renders nodes as "scontrol show nodes -o" output, one
+// line of key=value pairs per node. slurmrestd reports the CPU load times 100.
+func renderScontrolNodes(nodes []node) []byte {
+	var b strings.Builder
+	for _, n := range nodes {
+		cpuLoad, freeMem, nextState := "N/A", "N/A", ""
+		if n.CPULoad.Set {
+			cpuLoad = formatFloat(n.CPULoad.Value() / 100)
+		}
+		if n.FreeMemory.Set {
+			freeMem = formatFloat(n.FreeMemory.Value())
+		}
+		if len(n.NextState) > 0 {
+			nextState = " NextState=" + strings.Join(n.NextState, "+")
+		}
+		fmt.Fprintf(&b, "NodeName=%s CPUAlloc=%s CPUTot=%s CPULoad=%s AvailableFeatures=%s ActiveFeatures=%s Gres=%s RealMemory=%s AllocMem=%s FreeMem=%s State=%s%s Partitions=%s BootTime=%s SlurmdStartTime=%s LastBusyTime=%s CfgTRES=%s AllocTRES=%s CurrentWatts=%s AveWatts=%s Reason=%s\n",
+			n.Name,
+			formatFloat(n.AllocCPUs.Value()),
+			formatFloat(n.CPUs.Value()),
+			cpuLoad,
+			orDefault(strings.Join(n.Features, ","), "(null)"),
+			orDefault(strings.Join(n.ActiveFeatures, ","), "(null)"),
+			orDefault(n.Gres, "(null)"),
+			formatFloat(n.RealMemory.Value()),
+			formatFloat(n.AllocMemory.Value()),
+			freeMem,
+			orDefault(strings.Join(n.State, "+"), "UNKNOWN"),
+			nextState,
+			strings.Join(n.Partitions, ","),
+			formatTime(n.BootTime),
+			formatTime(n.SlurmdStartTime),
+			formatTime(n.LastBusy),
+			n.TRES,
+			n.TRESUsed,
+			formatFloat(n.Energy.CurrentWatts.Value()),
+			formatFloat(n.Energy.AverageWatts.Value()),
+			orDefault(n.Reason, "(null)"),
+		)
+	}
+	return []byte(b.String())
+}
+
+// renderReservations renders reservations as "scontrol show reservation"
+// output: key=value records separated by blank lines.
+func renderReservations(reservations []reservation) []byte {
+	now := time.Now()
+	var records []string
+	for _, r := range reservations {
+		state := "INACTIVE"
+		start := time.Unix(int64(r.StartTime.Value()), 0)
+		end := time.Unix(int64(r.EndTime.Value()), 0)
+		if !now.Before(start) && now.Before(end) {
+			state = "ACTIVE"
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "ReservationName=%s StartTime=%s EndTime=%s\n", r.Name, formatTime(r.StartTime), formatTime(r.EndTime))
+		fmt.Fprintf(&b, "   Nodes=%s NodeCnt=%s CoreCnt=%s Features=%s PartitionName=%s Flags=%s\n",
+			orDefault(r.NodeList, "(null)"),
+			formatFloat(r.NodeCount.Value()),
+			formatFloat(r.CoreCount.Value()),
+			orDefault(r.Features, "(null)"),
+			orDefault(r.Partition, "(null)"),
+			strings.Join(r.Flags, ","),
+		)
+		fmt.Fprintf(&b, "   TRES=%s\n", orDefault(r.TRES, "(null)"))
+		fmt.Fprintf(&b, "   Users=%s Accounts=%s Licenses=%s State=%s",
+			orDefault(r.Users, "(null)"),
+			orDefault(r.Accounts, "(null)"),
+			orDefault(r.Licenses, "(null)"),
+			state,
+		)
+		records = append(records, b.String())
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(records, "\n\n") + "\n")
+}
+
+// renderLicenses renders licenses as "scontrol show licenses -o" output.
+func renderLicenses(licenses []license) []byte {
+	var b strings.Builder
+	for _, l := range licenses {
+		remote := "no"
+		if l.Remote {
+			remote = "yes"
+		}
+		fmt.Fprintf(&b, "LicenseName=%s Total=%s Used=%s Free=%s Reserved=%s Remote=%s LastConsumed=%s LastDeficit=%s LastUpdate=%s\n",
+			l.Name,
+			formatFloat(l.Total.Value()),
+			formatFloat(l.Used.Value()),
+			formatFloat(l.Free.Value()),
+			formatFloat(l.Reserved.Value()),
+			remote,
+			formatFloat(l.LastConsumed.Value()),
+			formatFloat(l.LastDeficit.Value()),
+			formatTime(l.LastUpdate),
+		)
+	}
+	return []byte(b.String())
+}
+
+// renderPing renders the controllers pinged by slurmrestd as "scontrol ping" output.
+func renderPing(pings []ping) []byte {
+	var b strings.Builder
+	for _, p := range pings {
+		fmt.Fprintf(&b, "Slurmctld(%s) at %s is %s\n", p.Mode, p.Hostname, p.Pinged)
+	}
+	return []byte(b.String())
+}
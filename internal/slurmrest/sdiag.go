@@ -0,0 +1,103 @@
+package slurmrest
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// sdiagTimeLayout is the timestamp format used in the sdiag header.
+const sdiagTimeLayout = "Mon Jan 2 15:04:05 2006"
+
+// renderSdiag renders the diag statistics in the layout printed by sdiag.
+func renderSdiag(s diagStatistics) []byte {
+	var b strings.Builder
+	line := func(format string, a ...interface{}) {
+		fmt.Fprintf(&b, format+"\n", a...)
+	}
+	unix := func(n number) string {
+		return time.Unix(int64(n.Value()), 0).Format(sdiagTimeLayout)
+	}
+	v := func(n number) string {
+		return formatFloat(n.Value())
+	}
+
+	line("*******************************************************")
+	line("sdiag output at %s (%s)", unix(s.ReqTime), v(s.ReqTime))
+	line("Data since      %s (%s)", unix(s.ReqTimeStart), v(s.ReqTimeStart))
+	line("*******************************************************")
+	line("Server thread count:  %s", v(s.ServerThreadCount))
+	line("Agent queue size:     %s", v(s.AgentQueueSize))
+	line("Agent count:          %s", v(s.AgentCount))
+	line("Agent thread count:   %s", v(s.AgentThreadCount))
+	line("DBD Agent queue size: %s", v(s.DBDAgentQueueSize))
+	line("")
+	line("Jobs submitted: %s", v(s.JobsSubmitted))
+	line("Jobs started:   %s", v(s.JobsStarted))
+	line("Jobs completed: %s", v(s.JobsCompleted))
+	line("Jobs canceled:  %s", v(s.JobsCanceled))
+	line("Jobs failed:    %s", v(s.JobsFailed))
+	line("")
+	line("Jobs pending:   %s", v(s.JobsPending))
+	line("Jobs running:   %s", v(s.JobsRunning))
+	line("")
+	line("Main schedule statistics (microseconds):")
+	line("\tLast cycle:   %s", v(s.ScheduleCycleLast))
+	line("\tMax cycle:    %s", v(s.ScheduleCycleMax))
+	line("\tTotal cycles: %s", v(s.ScheduleCycleTotal))
+	line("\tMean cycle:   %s", v(s.ScheduleCycleMean))
+	line("\tMean depth cycle:  %s", v(s.ScheduleCycleDepth))
+	line("\tCycles per minute: %s", v(s.ScheduleCyclePerMin))
+	line("\tLast queue length: %s", v(s.ScheduleQueueLength))
+	line("")
+	line("Backfilling stats")
+	line("\tTotal backfilled jobs (since last slurm start): %s", v(s.BfBackfilledJobs))
+	line("\tTotal backfilled jobs (since last stats cycle start): %s", v(s.BfLastBackfilledJobs))
+	line("\tTotal backfilled heterogeneous job components: %s", v(s.BfBackfilledHetJobs))
+	line("\tTotal cycles: %s", v(s.BfCycleCounter))
+	line("\tLast cycle when: %s (%s)", unix(s.BfWhenLastCycle), v(s.BfWhenLastCycle))
+	line("\tLast cycle: %s", v(s.BfCycleLast))
+	line("\tMax cycle:  %s", v(s.BfCycleMax))
+	line("\tMean cycle: %s", v(s.BfCycleMean))
+	line("\tLast depth cycle: %s", v(s.BfLastDepth))
+	line("\tLast depth cycle (try sched): %s", v(s.BfLastDepthTry))
+	line("\tDepth Mean: %s", v(s.BfDepthMean))
+	line("\tDepth Mean (try depth): %s", v(s.BfDepthMeanTry))
+	line("\tLast queue length: %s", v(s.BfQueueLen))
+	line("\tQueue length mean: %s", v(s.BfQueueLenMean))
+	line("\tLast table size: %s", v(s.BfTableSize))
+	line("\tMean table size: %s", v(s.BfTableSizeMean))
+	line("")
+	line("Latency for 1000 calls to gettimeofday(): %s microseconds", v(s.GettimeofdayLatency))
+	line("")
+	line("Remote Procedure Call statistics by message type")
+	// sdiag only prints the RPC queue statistics when the queue is enabled,
+	// which slurmrestd does not report: they are printed when any is set.
+	queue := false
+	for _, r := range s.RPCsByMessageType {
+		queue = queue || r.Queued.Value() > 0 || r.Dropped.Value() > 0 || r.CycleLast.Value() > 0 || r.CycleMax.Value() > 0
+	}
+	for _, r := range s.RPCsByMessageType {
+		if queue {
+			line("\t%-40s(%5s) count:%-6s queued:%-6s dropped:%-6s cycle_last:%-6s cycle_max:%-6s ave_time:%-6s total_time:%s",
+				r.MessageType, v(r.TypeID), v(r.Count), v(r.Queued), v(r.Dropped), v(r.CycleLast), v(r.CycleMax), v(r.AverageTime), v(r.TotalTime))
+		} else {
+			line("\t%-40s(%5s) count:%-6s ave_time:%-6s total_time:%s",
+				r.MessageType, v(r.TypeID), v(r.Count), v(r.AverageTime), v(r.TotalTime))
+		}
+	}
+	line("")
+	line("Remote Procedure Call statistics by user")
+	for _, r := range s.RPCsByUser {
+		line("\t%-16s(%8s) count:%-6s ave_time:%-6s total_time:%s",
+			r.User, v(r.UserID), v(r.Count), v(r.AverageTime), v(r.TotalTime))
+	}
+	if len(s.PendingRPCs) > 0 {
+		line("")
+		line("Pending RPC statistics")
+		for _, r := range s.PendingRPCs {
+			line("\t%-40s(%5s) count:%s", r.MessageType, v(r.TypeID), v(r.Count))
+		}
+	}
+	return []byte(b.String())
+}
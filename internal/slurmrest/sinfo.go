@@ -0,0 +1,276 @@
+package slurmrest
+
+import (
+	"fmt"
+	"strings"
+)
+
+// nodeStateSuffixes maps node state flags to the markers sinfo appends to
+// the state name.
+var nodeStateSuffixes = []struct {
+	flag   string
+	suffix string
+}{
+	{"NOT_RESPONDING", "*"},
+	{"POWERED_DOWN", "~"},
+	{"POWERING_UP", "#"},
+	{"POWERING_DOWN", "%"},
+	{"POWER_DOWN", "!"},
+	{"REBOOT_REQUESTED", "@"},
+	{"REBOOT_ISSUED", "^"},
+}
+
+// nodeStateCompact maps long state names to the abbreviations of sinfo %t.
+var nodeStateCompact = map[string]string{
+	"allocated":  "alloc",
+	"completing": "comp",
+	"down":       "down",
+	"drained":    "drain",
+	"draining":   "drng",
+	"error":      "err",
+	"fail":       "fail",
+	"failing":    "failg",
+	"future":     "futr",
+	"idle":       "idle",
+	"maint":      "maint",
+	"mixed":      "mix",
+	"planned":    "plnd",
+	"reserved":   "resv",
+	"unknown":    "unk",
+}
+
+// aggregateFields are computed over all nodes of a group instead of being
+// part of the grouping key when sinfo is not node oriented.
+var aggregateFields = map[string]bool{
+	"nodes":     true,
+	"cpusstate": true,
+	"nodelist":  true,
+}
+
+// nodeRecord is a node as listed in a single partition.
+type nodeRecord struct {
+	node      *node
+	partition string
+}
+
+// nodeGroup is a set of records printed as a single line by sinfo.
+type nodeGroup struct {
+	first *nodeRecord
+	nodes []*node
+	seen  map[string]bool
+}
+
+// renderSinfo renders nodes as "sinfo -h -o/-O <format>" output. Without -N,
+// nodes sharing the same printed values are summarized on one line and
+// partitions are only told apart when a partition field is printed.
+func renderSinfo(nodes []node, args []string) ([]byte, error) {
+	opts, err := parseOptions(args, sinfoCodes)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*nodeRecord
+	for i := range nodes {
+		n := &nodes[i]
+		if !matchNodeState(n, opts.states) {
+			continue
+		}
+		for _, p := range n.Partitions {
+			if len(opts.partitions) > 0 && !contains(opts.partitions, p) {
+				continue
+			}
+			records = append(records, &nodeRecord{node: n, partition: p})
+		}
+	}
+
+	var b strings.Builder
+	if opts.nodeOriented {
+		for _, r := range records {
+			if err := writeLine(&b, opts.format, func(name string) (string, error) {
+				return nodeValue(r, []*node{r.node}, name)
+			}); err != nil {
+				return nil, err
+			}
+		}
+		return []byte(b.String()), nil
+	}
+
+	var order []string
+	groups := make(map[string]*nodeGroup)
+	for _, r := range records {
+		var key []string
+		for _, f := range opts.format {
+			if f.name == "" || aggregateFields[f.name] {
+				continue
+			}
+			v, err := nodeValue(r, []*node{r.node}, f.name)
+			if err != nil {
+				return nil, err
+			}
+			key = append(key, v)
+		}
+		k := strings.Join(key, "\x00")
+		g, ok := groups[k]
+		if !ok {
+			g = &nodeGroup{first: r, seen: make(map[string]bool)}
+			groups[k] = g
+			order = append(order, k)
+		}
+		if !g.seen[r.node.Name] {
+			g.seen[r.node.Name] = true
+			g.nodes = append(g.nodes, r.node)
+		}
+	}
+	for _, k := range order {
+		g := groups[k]
+		if err := writeLine(&b, opts.format, func(name string) (string, error) {
+			return nodeValue(g.first, g.nodes, name)
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return []byte(b.String()), nil
+}
+
+// nodeValue returns the value of a sinfo field. Per-node fields are taken
+// from the record, aggregate fields are computed over nodes.
+func nodeValue(r *nodeRecord, nodes []*node, name string) (string, error) {
+	n := r.node
+	switch name {
+	case "nodes":
+		return fmt.Sprint(len(nodes)), nil
+	case "cpusstate":
+		var alloc, idle, other, total float64
+		for _, n := range nodes {
+			a, i, o, t := cpusState(n)
+			alloc, idle, other, total = alloc+a, idle+i, other+o, total+t
+		}
+		return fmt.Sprintf("%s/%s/%s/%s", formatFloat(alloc), formatFloat(idle), formatFloat(other), formatFloat(total)), nil
+	case "nodelist", "nodehost", "nodeaddr":
+		var names []string
+		for _, n := range nodes {
+			names = append(names, n.Name)
+		}
+		return strings.Join(names, ","), nil
+	case "partition", "partitionname":
+		return r.partition, nil
+	case "statelong", "state":
+		return nodeStateLong(n), nil
+	case "statecompact":
+		base, suffix := nodeStateParts(n)
+		return nodeStateCompact[base] + suffix, nil
+	case "cpus":
+		return formatFloat(n.CPUs.Value()), nil
+	case "allocmem":
+		return formatFloat(n.AllocMemory.Value()), nil
+	case "memory":
+		return formatFloat(n.RealMemory.Value()), nil
+	case "gres":
+		return orDefault(n.Gres, "(null)"), nil
+	case "gresused":
+		return orDefault(n.GresUsed, "(null)"), nil
+	case "features":
+		return orDefault(strings.Join(n.Features, ","), "(null)"), nil
+	case "featuresact":
+		return orDefault(strings.Join(n.ActiveFeatures, ","), "(null)"), nil
+	case "reason":
+		return orDefault(n.Reason, "none"), nil
+	case "userlong", "user":
+		return orDefault(n.ReasonSetByUser, "Unknown"), nil
+	case "timestamp":
+		return formatTime(n.ReasonChangedAt), nil
+	}
+	return "", unknownField("sinfo", name)
+}
+
+// nodeStateParts returns the long base state name printed by sinfo %T and
+// the markers appended for power and responsiveness flags.
+func nodeStateParts(n *node) (string, string) {
+	base := "unknown"
+	if len(n.State) > 0 {
+		base = strings.ToLower(n.State[0])
+	}
+	switch {
+	case hasFlag(n, "DRAIN") && (base == "idle" || base == "down"):
+		base = "drained"
+	case hasFlag(n, "DRAIN"):
+		base = "draining"
+	case hasFlag(n, "FAIL") && base == "idle":
+		base = "fail"
+	case hasFlag(n, "FAIL"):
+		base = "failing"
+	case hasFlag(n, "COMPLETING"):
+		base = "completing"
+	case hasFlag(n, "MAINTENANCE"), hasFlag(n, "MAINT"):
+		base = "maint"
+	case hasFlag(n, "PLANNED"):
+		base = "planned"
+	case hasFlag(n, "RESERVED") && base == "idle":
+		base = "reserved"
+	}
+	var suffix string
+	for _, s := range nodeStateSuffixes {
+		if hasFlag(n, s.flag) {
+			suffix = s.suffix
+			break
+		}
+	}
+	return base, suffix
+}
+
+func nodeStateLong(n *node) string {
+	base, suffix := nodeStateParts(n)
+	return base + suffix
+}
+
+// cpusState returns the allocated, idle, other and total CPUs of a node the
+// way sinfo %C counts them: CPUs of unavailable nodes are reported as other.
+func cpusState(n *node) (alloc, idle, other, total float64) {
+	total = n.CPUs.Value()
+	alloc = n.AllocCPUs.Value()
+	base := ""
+	if len(n.State) > 0 {
+		base = strings.ToUpper(n.State[0])
+	}
+	if base == "DOWN" || base == "ERROR" || hasFlag(n, "DRAIN") || hasFlag(n, "FAIL") {
+		return alloc, 0, total - alloc, total
+	}
+	return alloc, total - alloc, 0, total
+}
+
+// matchNodeState reports whether any of the node's states or flags starts
+// with one of the --states filters (sinfo accepts abbreviations).
+func matchNodeState(n *node, filters []string) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	for _, f := range filters {
+		if f == "all" {
+			return true
+		}
+		for _, s := range n.State {
+			if strings.HasPrefix(strings.ToLower(s), f) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasFlag(n *node, flag string) bool {
+	for _, s := range n.State {
+		if strings.EqualFold(s, flag) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
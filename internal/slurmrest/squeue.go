@@ -0,0 +1,172 @@
+package slurmrest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jobStateCodes maps job states to the compact codes printed by squeue %t.
+var jobStateCodes = map[string]string{
+	"BOOT_FAIL":     "BF",
+	"CANCELLED":     "CA",
+	"COMPLETED":     "CD",
+	"COMPLETING":    "CG",
+	"CONFIGURING":   "CF",
+	"DEADLINE":      "DL",
+	"FAILED":        "F",
+	"NODE_FAIL":     "NF",
+	"OUT_OF_MEMORY": "OOM",
+	"PENDING":       "PD",
+	"PREEMPTED":     "PR",
+	"REQUEUED":      "RQ",
+	"RESIZING":      "RS",
+	"RUNNING":       "R",
+	"SUSPENDED":     "S",
+	"TIMEOUT":       "TO",
+}
+
+// renderSqueue renders jobs as "squeue -h -o/-O <format>" output.
+func renderSqueue(jobs []job, args []string) ([]byte, error) {
+	opts, err := parseOptions(args, squeueCodes)
+	if err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	for _, j := range jobs {
+		state := jobState(j)
+		if !matchJobState(state, opts.states) {
+			continue
+		}
+		for _, id := range jobArrayIDs(j, opts.expandArrays) {
+			err := writeLine(&b, opts.format, func(name string) (string, error) {
+				switch name {
+				case "jobid":
+					return formatFloat(j.JobID.Value()), nil
+				case "jobarrayid":
+					return id, nil
+				case "account":
+					return j.Account, nil
+				case "name":
+					return j.Name, nil
+				case "numcpus":
+					return formatFloat(j.CPUs.Value()), nil
+				case "numnodes":
+					return formatFloat(j.NodeCount.Value()), nil
+				case "partition":
+					return j.Partition, nil
+				case "qos":
+					return j.QOS, nil
+				case "reason":
+					return orDefault(j.StateReason, "None"), nil
+				case "state":
+					return state, nil
+				case "statecompact":
+					return jobStateCodes[state], nil
+				case "username":
+					return j.UserName, nil
+				case "tres-alloc":
+					// Like squeue, fall back to the requested TRES of jobs
+					// without an allocation.
+					return orDefault(orDefault(j.TRESAllocStr, j.TRESReqStr), "N/A"), nil
+				case "tres-per-node":
+					return orDefault(j.TRESPerNode, "N/A"), nil
+				case "submittime":
+					return formatTime(j.SubmitTime), nil
+				case "eligibletime":
+					return formatTime(j.EligibleTime), nil
+				case "timelimit":
+					return formatTimeLimit(j.TimeLimit), nil
+				case "starttime":
+					// Pending jobs without an expected start time.
+					if j.StartTime.Value() <= 0 {
+						return "N/A", nil
+					}
+					return formatTime(j.StartTime), nil
+				}
+				return "", unknownField("squeue", name)
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return []byte(b.String()), nil
+}
+
+// jobState returns the base state of a job, e.g. RUNNING.
+func jobState(j job) string {
+	if len(j.JobState) == 0 {
+		return "UNKNOWN"
+	}
+	return strings.ToUpper(j.JobState[0])
+}
+
+// matchJobState reports whether state matches one of the --states filters,
+// given either as full names or compact codes.
+func matchJobState(state string, filters []string) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	for _, f := range filters {
+		f = strings.ToUpper(f)
+		if f == "ALL" || f == state || f == jobStateCodes[state] {
+			return true
+		}
+	}
+	return false
+}
+
+// jobArrayIDs returns the %i identifiers of a job record. Pending array
+// records cover several tasks; they are printed as "<id>_[<tasks>]" or, when
+// expand is set (squeue -r), as one "<id>_<task>" line per task.
+func jobArrayIDs(j job, expand bool) []string {
+	jobID := formatFloat(j.JobID.Value())
+	if !j.ArrayJobID.Set || j.ArrayJobID.Value() == 0 {
+		return []string{jobID}
+	}
+	arrayID := formatFloat(j.ArrayJobID.Value())
+	if j.ArrayTaskID.Set && !j.ArrayTaskID.Infinite {
+		return []string{arrayID + "_" + formatFloat(j.ArrayTaskID.Value())}
+	}
+	if j.ArrayTaskString == "" {
+		return []string{jobID}
+	}
+	if !expand {
+		return []string{fmt.Sprintf("%s_[%s]", arrayID, j.ArrayTaskString)}
+	}
+	var ids []string
+	for _, task := range expandTaskString(j.ArrayTaskString) {
+		ids = append(ids, arrayID+"_"+strconv.Itoa(task))
+	}
+	return ids
+}
+
+// expandTaskString expands an array task specification such as "1-7:2,10%4".
+func expandTaskString(spec string) []int {
+	spec, _, _ = strings.Cut(spec, "%")
+	var tasks []int
+	for _, part := range strings.Split(spec, ",") {
+		rng, stepStr, _ := strings.Cut(part, ":")
+		step, err := strconv.Atoi(stepStr)
+		if err != nil || step < 1 {
+			step = 1
+		}
+		lowStr, highStr, isRange := strings.Cut(rng, "-")
+		low, err := strconv.Atoi(lowStr)
+		if err != nil {
+			continue
+		}
+		high := low
+		if isRange {
+			if high, err = strconv.Atoi(highStr); err != nil {
+				continue
+			}
+		}
+		for t := low; t <= high; t += step {
+			tasks = append(tasks, t)
+		}
+	}
+	return tasks
+}
@@ -0,0 +1,125 @@
+package slurmrest
+
+import (
+	"fmt"
+	"strings"
+)
+
+var (
+	sshareDefaultColumns = []string{"Account", "User", "RawShares", "NormShares", "RawUsage", "EffectvUsage", "FairShare"}
+	sshareLongColumns    = []string{"Account", "User", "RawShares", "NormShares", "RawUsage", "NormUsage", "EffectvUsage", "FairShare", "LevelFS", "GrpTRESMins", "TRESRawUsage"}
+)
+
+// renderSshare renders the association tree as "sshare -P" output. Account
+// names are indented by one space per level like sshare does, user rows show
+// the account they belong to.
+func renderSshare(shares []share, args []string) ([]byte, error) {
+	columns := sshareDefaultColumns
+	noHeader, partitions, format := false, false, false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-n", "--noheader":
+			noHeader = true
+		case "-l", "--long":
+			columns = sshareLongColumns
+		case "-o", "--format":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("option %s requires an argument", args[i])
+			}
+			i++
+			columns = splitList(args[i])
+			format = true
+		case "-m", "--partition":
+			partitions = true
+		case "-a", "--all", "-P", "--parsable2", "-p", "--parsable":
+		default:
+			return nil, fmt.Errorf("option %s is not supported by the slurmrestd backend", args[i])
+		}
+	}
+	if partitions && !format {
+		// sshare prints the partition of the associations after the user.
+		columns = append([]string{"Account", "User", "Partition"}, columns[2:]...)
+	}
+
+	accounts := make(map[string]*share)
+	for i := range shares {
+		if !isUserShare(&shares[i]) {
+			accounts[shares[i].Name] = &shares[i]
+		}
+	}
+	var depth func(name string, seen int) int
+	depth = func(name string, seen int) int {
+		a, ok := accounts[name]
+		if !ok || a.Parent == "" || seen > len(accounts) {
+			return 0
+		}
+		return depth(a.Parent, seen+1) + 1
+	}
+
+	var b strings.Builder
+	if !noHeader {
+		b.WriteString(strings.Join(columns, "|") + "\n")
+	}
+	for i := range shares {
+		s := &shares[i]
+		values := make([]string, 0, len(columns))
+		for _, col := range columns {
+			v, err := shareValue(s, col, depth)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		b.WriteString(strings.Join(values, "|") + "\n")
+	}
+	return []byte(b.String()), nil
+}
+
+func shareValue(s *share, column string, depth func(string, int) int) (string, error) {
+	switch strings.ToLower(column) {
+	case "account":
+		if isUserShare(s) {
+			return strings.Repeat(" ", depth(s.Parent, 0)+1) + s.Parent, nil
+		}
+		return strings.Repeat(" ", depth(s.Name, 0)) + s.Name, nil
+	case "user":
+		if isUserShare(s) {
+			return s.Name, nil
+		}
+		return "", nil
+	case "partition":
+		return s.Partition, nil
+	case "rawshares":
+		if s.Shares.Infinite {
+			return "parent", nil
+		}
+		return formatFloat(s.Shares.Value()), nil
+	case "normshares":
+		return fmt.Sprintf("%f", s.SharesNormalized.Value()), nil
+	case "rawusage":
+		return formatFloat(s.Usage.Value()), nil
+	case "normusage":
+		return fmt.Sprintf("%f", s.UsageNormalized.Value()), nil
+	case "effectvusage":
+		return fmt.Sprintf("%f", s.EffectiveUsage.Value()), nil
+	case "fairshare":
+		return fmt.Sprintf("%f", s.Fairshare.Factor.Value()), nil
+	case "levelfs":
+		if s.Fairshare.Level.Infinite {
+			return "inf", nil
+		}
+		return fmt.Sprintf("%f", s.Fairshare.Level.Value()), nil
+	case "grptresmins", "tresrawusage":
+		return "", nil
+	}
+	return "", unknownField("sshare", column)
+}
+
+func isUserShare(s *share) bool {
+	for _, t := range s.Type {
+		if strings.EqualFold(t, "USER") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,304 @@
+package slurmrest
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// number decodes the {"set","infinite","number"} objects used by slurmrestd
+// v0.0.39 and later as well as the plain JSON numbers of older API versions.
+type number struct {
+	Set      bool
+	Infinite bool
+	Number   float64
+}
+
+func (n *number) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*n = number{}
+		return nil
+	}
+	var plain float64
+	if err := json.Unmarshal(data, &plain); err == nil {
+		*n = number{Set: true, Number: plain}
+		return nil
+	}
+	var obj struct {
+		Set      bool    `json:"set"`
+		Infinite bool    `json:"infinite"`
+		Number   float64 `json:"number"`
+	}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	*n = number{Set: obj.Set, Infinite: obj.Infinite, Number: obj.Number}
+	return nil
+}
+
+// Value returns the number, or 0 when it is unset or infinite.
+func (n number) Value() float64 {
+	if !n.Set || n.Infinite {
+		return 0
+	}
+	return n.Number
+}
+
+// list decodes fields that are a JSON array of strings in recent API
+// versions and a comma separated string in older ones.
+type list []string
+
+func (l *list) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*l = nil
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*l = nil
+		for _, v := range strings.Split(s, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				*l = append(*l, v)
+			}
+		}
+		return nil
+	}
+	var a []string
+	if err := json.Unmarshal(data, &a); err != nil {
+		return err
+	}
+	*l = a
+	return nil
+}
+
+// restError is a single entry of the errors array returned by slurmrestd.
+type restError struct {
+	Error       string `json:"error"`
+	ErrorNumber int    `json:"error_number"`
+	Description string `json:"description"`
+	Source      string `json:"source"`
+}
+
+type response struct {
+	Errors []restError `json:"errors"`
+}
+
+type ping struct {
+	Hostname string `json:"hostname"`
+	Pinged   string `json:"pinged"`
+	Mode     string `json:"mode"`
+}
+
+type pingResponse struct {
+	response
+	Pings []ping `json:"pings"`
+	Meta  struct {
+		Slurm struct {
+			Release string `json:"release"`
+			Version struct {
+				Major json.Number `json:"major"`
+				Minor json.Number `json:"minor"`
+				Micro json.Number `json:"micro"`
+			} `json:"version"`
+		} `json:"slurm"`
+	} `json:"meta"`
+}
+
+type cluster struct {
+	Name string `json:"name"`
+}
+
+type clustersResponse struct {
+	response
+	Clusters []cluster `json:"clusters"`
+}
+
+type job struct {
+	JobID           number `json:"job_id"`
+	ArrayJobID      number `json:"array_job_id"`
+	ArrayTaskID     number `json:"array_task_id"`
+	ArrayTaskString string `json:"array_task_string"`
+	Name            string `json:"name"`
+	Partition       string `json:"partition"`
+	JobState        list   `json:"job_state"`
+	StateReason     string `json:"state_reason"`
+	UserName        string `json:"user_name"`
+	Account         string `json:"account"`
+	QOS             string `json:"qos"`
+	CPUs            number `json:"cpus"`
+	NodeCount       number `json:"node_count"`
+	TRESAllocStr    string `json:"tres_alloc_str"`
+	TRESReqStr      string `json:"tres_req_str"`
+	TRESPerNode     string `json:"tres_per_node"`
+	SubmitTime      number `json:"submit_time"`
+	EligibleTime    number `json:"eligible_time"`
+	StartTime       number `json:"start_time"`
+	TimeLimit       number `json:"time_limit"` // Minutes
+}
+
+type jobsResponse struct {
+	response
+	Jobs []job `json:"jobs"`
+}
+
+type node struct {
+	Name            string `json:"name"`
+	Partitions      list   `json:"partitions"`
+	State           list   `json:"state"`
+	NextState       list   `json:"next_state_after_reboot"`
+	CPUs            number `json:"cpus"`
+	AllocCPUs       number `json:"alloc_cpus"`
+	AllocIdleCPUs   number `json:"alloc_idle_cpus"`
+	RealMemory      number `json:"real_memory"`
+	AllocMemory     number `json:"alloc_memory"`
+	Gres            string `json:"gres"`
+	GresUsed        string `json:"gres_used"`
+	Features        list   `json:"features"`
+	ActiveFeatures  list   `json:"active_features"`
+	Reason          string `json:"reason"`
+	ReasonSetByUser string `json:"reason_set_by_user"`
+	ReasonChangedAt number `json:"reason_changed_at"`
+	CPULoad         number `json:"cpu_load"`
+	FreeMemory      number `json:"free_mem"`
+	BootTime        number `json:"boot_time"`
+	SlurmdStartTime number `json:"slurmd_start_time"`
+	LastBusy        number `json:"last_busy"`
+	TRES            string `json:"tres"`
+	TRESUsed        string `json:"tres_used"`
+	Energy          energy `json:"energy"`
+}
+
+type energy struct {
+	CurrentWatts number `json:"current_watts"`
+	AverageWatts number `json:"average_watts"`
+}
+
+type nodesResponse struct {
+	response
+	Nodes []node `json:"nodes"`
+}
+
+type reservation struct {
+	Name      string `json:"name"`
+	NodeList  string `json:"node_list"`
+	NodeCount number `json:"node_count"`
+	CoreCount number `json:"core_count"`
+	Partition string `json:"partition"`
+	Flags     list   `json:"flags"`
+	Users     string `json:"users"`
+	Accounts  string `json:"accounts"`
+	StartTime number `json:"start_time"`
+	EndTime   number `json:"end_time"`
+	Features  string `json:"features"`
+	Licenses  string `json:"licenses"`
+	TRES      string `json:"tres"`
+}
+
+type reservationsResponse struct {
+	response
+	Reservations []reservation `json:"reservations"`
+}
+
+type license struct {
+	Name         string `json:"LicenseName"`
+	Total        number `json:"Total"`
+	Used         number `json:"Used"`
+	Free         number `json:"Free"`
+	Remote       bool   `json:"Remote"`
+	Reserved     number `json:"Reserved"`
+	LastConsumed number `json:"LastConsumed"`
+	LastDeficit  number `json:"LastDeficit"`
+	LastUpdate   number `json:"LastUpdate"`
+}
+
+type licensesResponse struct {
+	response
+	Licenses []license `json:"licenses"`
+}
+
+type rpcStat struct {
+	MessageType string `json:"message_type"`
+	TypeID      number `json:"type_id"`
+	User        string `json:"user"`
+	UserID      number `json:"user_id"`
+	Count       number `json:"count"`
+	Queued      number `json:"queued"`
+	Dropped     number `json:"dropped"`
+	CycleLast   number `json:"cycle_last"`
+	CycleMax    number `json:"cycle_max"`
+	AverageTime number `json:"average_time"`
+	TotalTime   number `json:"total_time"`
+}
+
+type diagStatistics struct {
+	ReqTime              number    `json:"req_time"`
+	ReqTimeStart         number    `json:"req_time_start"`
+	ServerThreadCount    number    `json:"server_thread_count"`
+	AgentQueueSize       number    `json:"agent_queue_size"`
+	AgentCount           number    `json:"agent_count"`
+	AgentThreadCount     number    `json:"agent_thread_count"`
+	DBDAgentQueueSize    number    `json:"dbd_agent_queue_size"`
+	GettimeofdayLatency  number    `json:"gettimeofday_latency"`
+	JobsSubmitted        number    `json:"jobs_submitted"`
+	JobsStarted          number    `json:"jobs_started"`
+	JobsCompleted        number    `json:"jobs_completed"`
+	JobsCanceled         number    `json:"jobs_canceled"`
+	JobsFailed           number    `json:"jobs_failed"`
+	JobsPending          number    `json:"jobs_pending"`
+	JobsRunning          number    `json:"jobs_running"`
+	ScheduleCycleLast    number    `json:"schedule_cycle_last"`
+	ScheduleCycleMax     number    `json:"schedule_cycle_max"`
+	ScheduleCycleTotal   number    `json:"schedule_cycle_total"`
+	ScheduleCycleMean    number    `json:"schedule_cycle_mean"`
+	ScheduleCycleDepth   number    `json:"schedule_cycle_mean_depth"`
+	ScheduleCyclePerMin  number    `json:"schedule_cycle_per_minute"`
+	ScheduleQueueLength  number    `json:"schedule_queue_length"`
+	BfBackfilledJobs     number    `json:"bf_backfilled_jobs"`
+	BfLastBackfilledJobs number    `json:"bf_last_backfilled_jobs"`
+	BfBackfilledHetJobs  number    `json:"bf_backfilled_het_jobs"`
+	BfCycleCounter       number    `json:"bf_cycle_counter"`
+	BfCycleMean          number    `json:"bf_cycle_mean"`
+	BfDepthMean          number    `json:"bf_depth_mean"`
+	BfDepthMeanTry       number    `json:"bf_depth_mean_try"`
+	BfCycleLast          number    `json:"bf_cycle_last"`
+	BfCycleMax           number    `json:"bf_cycle_max"`
+	BfLastDepth          number    `json:"bf_last_depth"`
+	BfLastDepthTry       number    `json:"bf_last_depth_try"`
+	BfQueueLen           number    `json:"bf_queue_len"`
+	BfQueueLenMean       number    `json:"bf_queue_len_mean"`
+	BfTableSize          number    `json:"bf_table_size"`
+	BfTableSizeMean      number    `json:"bf_table_size_mean"`
+	BfWhenLastCycle      number    `json:"bf_when_last_cycle"`
+	RPCsByMessageType    []rpcStat `json:"rpcs_by_message_type"`
+	RPCsByUser           []rpcStat `json:"rpcs_by_user"`
+	PendingRPCs          []rpcStat `json:"pending_rpcs"`
+}
+
+type diagResponse struct {
+	response
+	Statistics diagStatistics `json:"statistics"`
+}
+
+type share struct {
+	ID               number `json:"id"`
+	Cluster          string `json:"cluster"`
+	Name             string `json:"name"`
+	Parent           string `json:"parent"`
+	Partition        string `json:"partition"`
+	SharesNormalized number `json:"shares_normalized"`
+	Shares           number `json:"shares"`
+	EffectiveUsage   number `json:"effective_usage"`
+	UsageNormalized  number `json:"usage_normalized"`
+	Usage            number `json:"usage"`
+	Fairshare        struct {
+		Factor number `json:"factor"`
+		Level  number `json:"level"`
+	} `json:"fairshare"`
+	Type list `json:"type"`
+}
+
+type sharesResponse struct {
+	response
+	Shares struct {
+		Shares []share `json:"shares"`
+	} `json:"shares"`
+}